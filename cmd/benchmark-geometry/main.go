@@ -0,0 +1,166 @@
+// benchmark-geometry compares the time it takes to decode the polygons stored in the rtree table of a SQLite
+// spatial database using the JSON and binary geometry encodings, and the space each encoding requires.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"log"
+	"net/url"
+	"os"
+	"time"
+)
+
+func main() {
+
+	dsn := flag.String("dsn", "", "The path to a SQLite database with an rtree table.")
+	iterations := flag.Int("iterations", 10, "The number of times to decode every polygon in each encoding.")
+	limit := flag.Int("limit", 0, "The maximum number of polygons to read from the database. If 0 then all the polygons are read.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Compare the JSON and binary geometry encodings for the polygons in a SQLite spatial database.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *dsn == "" {
+		log.Fatal("Missing -dsn flag")
+	}
+
+	if *iterations < 1 {
+		log.Fatal("Invalid -iterations flag")
+	}
+
+	ctx := context.Background()
+
+	// Open the database read-only so that a mistyped path isn't created as an empty database
+
+	_, err := os.Stat(*dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to stat %s, %v", *dsn, err)
+	}
+
+	// The path is escaped so that characters like '?' or '#' aren't mistaken for part of the URI
+
+	u := &url.URL{
+		Path: *dsn,
+	}
+
+	db, err := sqlite_database.NewDB(fmt.Sprintf("file:%s?mode=ro", u.EscapedPath()))
+
+	if err != nil {
+		log.Fatalf("Failed to open database, %v", err)
+	}
+
+	defer db.Close()
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		log.Fatalf("Failed to connect to database, %v", err)
+	}
+
+	q := "SELECT geometry FROM rtree"
+
+	if *limit > 0 {
+		q = fmt.Sprintf("%s LIMIT %d", q, *limit)
+	}
+
+	rows, err := conn.QueryContext(ctx, q)
+
+	if err != nil {
+		log.Fatalf("Failed to query database, %v", err)
+	}
+
+	defer rows.Close()
+
+	encodings := map[string][][]byte{
+		geo.GEOMETRY_FORMAT_JSON:   make([][]byte, 0),
+		geo.GEOMETRY_FORMAT_BINARY: make([][]byte, 0),
+	}
+
+	vertices := 0
+
+	for rows.Next() {
+
+		var body []byte
+
+		err := rows.Scan(&body)
+
+		if err != nil {
+			log.Fatalf("Failed to scan row, %v", err)
+		}
+
+		// Geometries are stored using whichever encoding the database was indexed
+		// with so decode them and then re-encode them using both formats
+
+		poly, err := geo.DecodePolygon(body)
+
+		if err != nil {
+			log.Fatalf("Failed to decode geometry, %v", err)
+		}
+
+		for _, ring := range poly {
+			vertices += len(ring)
+		}
+
+		for format := range encodings {
+
+			enc, err := geo.EncodePolygon(poly, format)
+
+			if err != nil {
+				log.Fatalf("Failed to encode geometry as %s, %v", format, err)
+			}
+
+			encodings[format] = append(encodings[format], enc)
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		log.Fatalf("Failed to iterate rows, %v", err)
+	}
+
+	count := len(encodings[geo.GEOMETRY_FORMAT_JSON])
+
+	if count == 0 {
+		log.Fatal("Database does not contain any polygons")
+	}
+
+	fmt.Printf("polygons: %d vertices: %d iterations: %d\n", count, vertices, *iterations)
+
+	for _, format := range []string{geo.GEOMETRY_FORMAT_JSON, geo.GEOMETRY_FORMAT_BINARY} {
+
+		size := 0
+
+		for _, enc := range encodings[format] {
+			size += len(enc)
+		}
+
+		t1 := time.Now()
+
+		for i := 0; i < *iterations; i++ {
+
+			for _, enc := range encodings[format] {
+
+				_, err := geo.DecodePolygon(enc)
+
+				if err != nil {
+					log.Fatalf("Failed to decode %s geometry, %v", format, err)
+				}
+			}
+		}
+
+		elapsed := time.Since(t1)
+		per_op := elapsed / time.Duration(count*(*iterations))
+
+		fmt.Printf("%-8s bytes: %-12d total: %-14v per polygon: %v\n", format, size, elapsed, per_op)
+	}
+}
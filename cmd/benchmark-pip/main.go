@@ -0,0 +1,193 @@
+// benchmark-pip measures the performance of point-in-polygon queries against an existing SQLite spatial database
+// using different numbers of workers to inflate the candidates for each query.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func main() {
+
+	database_uri := flag.String("spatial-database-uri", "", "A valid sqlite:// spatial database URI. The database must be stored on disk and already be indexed.")
+	str_workers := flag.String("workers", "0,1,2,4,8,16,32", "A comma-separated list of the number of workers to benchmark. 0 means one worker per candidate.")
+	queries := flag.Int("queries", 1000, "The number of (random) point-in-polygon queries to perform for each number of workers.")
+	concurrency := flag.Int("concurrency", 4, "The number of point-in-polygon queries to perform simultaneously.")
+	seed := flag.Int64("seed", 1, "The seed used to generate random coordinates.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Benchmark point-in-polygon queries using different numbers of workers.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	ctx := context.Background()
+
+	u, err := url.Parse(*database_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to parse -spatial-database-uri flag, %v", err)
+	}
+
+	q := u.Query()
+	dsn := q.Get("dsn")
+
+	if dsn == "" || strings.Contains(dsn, ":memory:") {
+		log.Fatal("Invalid -spatial-database-uri flag, the 'dsn' parameter must be a path to a database on disk")
+	}
+
+	if *queries < 1 || *concurrency < 1 {
+		log.Fatal("The -queries and -concurrency flags must be greater than zero")
+	}
+
+	workers := make([]int, 0)
+
+	for _, str_w := range strings.Split(*str_workers, ",") {
+
+		w, err := strconv.Atoi(strings.TrimSpace(str_w))
+
+		if err != nil || w < 0 {
+			log.Fatalf("Invalid -workers value '%s'", str_w)
+		}
+
+		workers = append(workers, w)
+	}
+
+	// Queries are distributed randomly across the extent of the rtree table and the same
+	// coordinates are used for every number of workers
+
+	extent, err := rtreeExtent(ctx, dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to determine extent of database, %v", err)
+	}
+
+	r := rand.New(rand.NewSource(*seed))
+
+	coords := make([][2]float64, *queries)
+
+	for i := 0; i < *queries; i++ {
+		x := extent[0] + r.Float64()*(extent[2]-extent[0])
+		y := extent[1] + r.Float64()*(extent[3]-extent[1])
+		coords[i] = [2]float64{x, y}
+	}
+
+	fmt.Printf("queries: %d concurrency: %d extent: %v\n", *queries, *concurrency, extent)
+
+	for _, w := range workers {
+
+		q.Set("workers", strconv.Itoa(w))
+		u.RawQuery = q.Encode()
+
+		db, err := database.NewSpatialDatabase(ctx, u.String())
+
+		if err != nil {
+			log.Fatalf("Failed to create spatial database, %v", err)
+		}
+
+		timings := make([]time.Duration, *queries)
+		matches := 0
+
+		mu := new(sync.Mutex)
+		wg := new(sync.WaitGroup)
+
+		throttle := make(chan bool, *concurrency)
+
+		t1 := time.Now()
+
+		for i, pt := range coords {
+
+			throttle <- true
+			wg.Add(1)
+
+			go func(i int, pt [2]float64) {
+
+				defer func() {
+					<-throttle
+					wg.Done()
+				}()
+
+				c, err := geo.NewCoordinate(pt[0], pt[1])
+
+				if err != nil {
+					log.Fatalf("Failed to create coordinate, %v", err)
+				}
+
+				t2 := time.Now()
+
+				rsp, err := db.PointInPolygon(ctx, c)
+
+				if err != nil {
+					log.Fatalf("Failed to perform point-in-polygon query, %v", err)
+				}
+
+				mu.Lock()
+				timings[i] = time.Since(t2)
+				matches += len(rsp.Results())
+				mu.Unlock()
+
+			}(i, pt)
+		}
+
+		wg.Wait()
+
+		elapsed := time.Since(t1)
+
+		db.Disconnect(ctx)
+
+		sort.Slice(timings, func(i, j int) bool {
+			return timings[i] < timings[j]
+		})
+
+		p50 := timings[len(timings)/2]
+		p95 := timings[(len(timings)*95)/100]
+		qps := float64(*queries) / elapsed.Seconds()
+
+		fmt.Printf("workers: %-4d total: %-14v queries/sec: %-10.1f p50: %-12v p95: %-12v matches: %d\n", w, elapsed, qps, p50, p95, matches)
+	}
+}
+
+func rtreeExtent(ctx context.Context, dsn string) ([4]float64, error) {
+
+	var extent [4]float64
+
+	db, err := sqlite_database.NewDB(dsn)
+
+	if err != nil {
+		return extent, err
+	}
+
+	defer db.Close()
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return extent, err
+	}
+
+	row := conn.QueryRowContext(ctx, "SELECT MIN(min_x), MIN(min_y), MAX(max_x), MAX(max_y) FROM rtree")
+
+	err = row.Scan(&extent[0], &extent[1], &extent[2], &extent[3])
+
+	if err != nil {
+		return extent, err
+	}
+
+	return extent, nil
+}
@@ -0,0 +1,375 @@
+// build indexes Who's On First (or "plain old" GeoJSON) documents in to a SQLite database, stored on disk, with
+// the rtree, spr, properties and geojson tables used by sqlite:// spatial databases. It uses the same iterator,
+// indexing, filter and property mapping flags as the server tool.
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/flags"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/index"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/server"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	wof_sqlite "github.com/whosonfirst/go-whosonfirst-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-sqlite-features/tables"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// buildDatabase is a database.SpatialDatabase that also indexes the properties for every feature in a
+// properties table, which SQLiteSpatialDatabase instances don't do.
+type buildDatabase struct {
+	database.SpatialDatabase
+	spatial_db       *sqlite.SQLiteSpatialDatabase
+	db               *sqlite_database.SQLiteDatabase
+	properties_table wof_sqlite.Table
+	mu               *sync.Mutex
+}
+
+func (b *buildDatabase) IndexFeature(ctx context.Context, f geojson.Feature) error {
+
+	// The iterator indexes documents concurrently but SQLite only allows one writer at a time
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Features are indexed one at a time so an increase in the number of skipped features means
+	// that this feature hasn't changed, in incremental mode, and its properties don't need updating
+
+	skipped := b.spatial_db.IndexingStats().Skipped
+
+	err := b.spatial_db.IndexFeature(ctx, f)
+
+	if err != nil {
+		return err
+	}
+
+	if b.spatial_db.IndexingStats().Skipped > skipped {
+		return nil
+	}
+
+	return b.properties_table.IndexRecord(b.db, f)
+}
+
+// IndexingStats allows indexing jobs to report the number of features indexed by the underlying spatial database.
+func (b *buildDatabase) IndexingStats() *sqlite.IndexingStats {
+	return b.spatial_db.IndexingStats()
+}
+
+func main() {
+
+	fs, err := spatial_flags.CommonFlags()
+
+	if err != nil {
+		log.Fatalf("Failed to derive common spatial flags, %v", err)
+	}
+
+	err = spatial_flags.AppendIndexingFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to append indexing flags, %v", err)
+	}
+
+	err = flags.AppendIndexingErrorFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to append local indexing flags, %v", err)
+	}
+
+	err = flags.AppendCustomPlacetypesFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to append custom placetypes flags, %v", err)
+	}
+
+	err = flags.AppendPropertyMappingFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to append property mapping flags, %v", err)
+	}
+
+	err = flags.AppendFilterFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to append filter flags, %v", err)
+	}
+
+	analyze := fs.Bool("analyze", true, "Run ANALYZE on the database once indexing is complete.")
+	vacuum := fs.Bool("vacuum", true, "Run VACUUM on the database once indexing is complete.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Index one or more sources of Who's On First (or \"plain old\" GeoJSON) documents in to a SQLite spatial database stored on disk.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options] path(N) path(N)\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	flagset.Parse(fs)
+
+	err = flagset.SetFlagsFromEnvVarsWithFeedback(fs, "WHOSONFIRST", true)
+
+	if err != nil {
+		log.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	err = spatial_flags.ValidateCommonFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to validate common flags, %v", err)
+	}
+
+	err = spatial_flags.ValidateIndexingFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to validate indexing flags, %v", err)
+	}
+
+	err = flags.ValidateIndexingErrorFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to validate local indexing flags, %v", err)
+	}
+
+	err = flags.ValidateCustomPlacetypesFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to validate custom placetypes flags, %v", err)
+	}
+
+	err = flags.ValidatePropertyMappingFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to validate property mapping flags, %v", err)
+	}
+
+	err = flags.ValidateFilterFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to validate filter flags, %v", err)
+	}
+
+	ctx := context.Background()
+
+	paths := fs.Args()
+
+	if len(paths) == 0 {
+		log.Fatal("Nothing to index")
+	}
+
+	database_uri, _ := lookup.StringVar(fs, spatial_flags.SPATIAL_DATABASE_URI)
+	error_report_path, _ := lookup.StringVar(fs, flags.INDEX_ERROR_REPORT)
+
+	dsn, err := databasePath(database_uri)
+
+	if err != nil {
+		log.Fatalf("Invalid -%s flag, %v", spatial_flags.SPATIAL_DATABASE_URI, err)
+	}
+
+	emitter_uri, err := flags.IteratorURIWithFlagSet(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to derive iterator URI, %v", err)
+	}
+
+	err = server.AppendCustomPlacetypesWithFlagSet(ctx, fs)
+
+	if err != nil {
+		log.Fatalf("Failed to append custom placetypes, %v", err)
+	}
+
+	error_policy, err := index.NewErrorPolicyWithFlagSet(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to create indexing error policy, %v", err)
+	}
+
+	sqlite_db, err := sqlite_database.NewDB(dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to open %s, %v", dsn, err)
+	}
+
+	// The database is created using the same URI (and table options) that the server tool uses
+
+	db, err := sqlite.NewSQLiteSpatialDatabaseWithDatabase(ctx, database_uri, sqlite_db)
+
+	if err != nil {
+		log.Fatalf("Failed to create spatial database, %v", err)
+	}
+
+	spatial_db := db.(*sqlite.SQLiteSpatialDatabase)
+
+	defer spatial_db.Disconnect(ctx)
+
+	properties_table, err := tables.NewPropertiesTableWithDatabase(sqlite_db)
+
+	if err != nil {
+		log.Fatalf("Failed to create properties table, %v", err)
+	}
+
+	build_db := &buildDatabase{
+		SpatialDatabase:  spatial_db,
+		spatial_db:       spatial_db,
+		db:               sqlite_db,
+		properties_table: properties_table,
+		mu:               new(sync.Mutex),
+	}
+
+	emitter_cb, err := index.NewIteratorCallbackWithFlagSet(ctx, fs, build_db)
+
+	if err != nil {
+		log.Fatalf("Failed to create iterator callback, %v", err)
+	}
+
+	indexer_opts := &index.IndexerOptions{
+		SpatialDatabase: build_db,
+		EmitterURI:      emitter_uri,
+		EmitterCallback: emitter_cb,
+		ErrorPolicy:     error_policy,
+		ErrorReportPath: error_report_path,
+	}
+
+	indexer, err := index.NewIndexer(ctx, indexer_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create indexer, %v", err)
+	}
+
+	t1 := time.Now()
+
+	job, err := indexer.IndexURIs(ctx, paths...)
+
+	if err != nil {
+		log.Fatalf("Failed to index paths, %v", err)
+	}
+
+	<-job.Done()
+
+	err = job.Err()
+
+	if err != nil {
+		log.Fatalf("Failed to index paths, %v", err)
+	}
+
+	status := job.Status()
+	time_to_index := time.Since(t1)
+
+	// Record how the database was built so that it can be rebuilt, or updated, later on
+
+	metadata, err := index.BuildMetadataWithFlagSet(fs, emitter_uri, paths...)
+
+	if err != nil {
+		log.Fatalf("Failed to derive build metadata, %v", err)
+	}
+
+	metadata[sqlite.METADATA_BUILD_FINISHED] = time.Now().UTC().Format(time.RFC3339)
+
+	for k, v := range metadata {
+
+		err := spatial_db.SetMetadata(ctx, k, v)
+
+		if err != nil {
+			log.Fatalf("Failed to set %s metadata, %v", k, err)
+		}
+	}
+
+	conn, err := sqlite_db.Conn()
+
+	if err != nil {
+		log.Fatalf("Failed to connect to database, %v", err)
+	}
+
+	t2 := time.Now()
+
+	if *analyze {
+
+		_, err := conn.ExecContext(ctx, "ANALYZE")
+
+		if err != nil {
+			log.Fatalf("Failed to analyze database, %v", err)
+		}
+	}
+
+	if *vacuum {
+
+		_, err := conn.ExecContext(ctx, "VACUUM")
+
+		if err != nil {
+			log.Fatalf("Failed to vacuum database, %v", err)
+		}
+	}
+
+	time_to_optimize := time.Since(t2)
+
+	fmt.Printf("database: %s\n", dsn)
+	fmt.Printf("documents: %d seen, %d failed to index\n", status.Seen, status.IndexingErrors)
+
+	if status.Stats != nil {
+		fmt.Printf("features: %d new, %d updated, %d skipped\n", status.Stats.New, status.Stats.Updated, status.Stats.Skipped)
+	}
+
+	for _, name := range []string{"rtree", "points", "spr", "properties", "geojson"} {
+
+		var count int64
+
+		row := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", name))
+		err := row.Scan(&count)
+
+		if err != nil {
+			log.Fatalf("Failed to count rows in %s table, %v", name, err)
+		}
+
+		fmt.Printf("table %s: %d rows\n", name, count)
+	}
+
+	info, err := os.Stat(dsn)
+
+	if err != nil {
+		log.Fatalf("Failed to stat %s, %v", dsn, err)
+	}
+
+	fmt.Printf("size: %d bytes\n", info.Size())
+	fmt.Printf("time to index: %v, time to optimize: %v\n", time_to_index, time_to_optimize)
+}
+
+// databasePath returns the path to the database file defined by the 'dsn' parameter of 'uri', which must be a
+// sqlite:// spatial database URI for a database stored on disk.
+func databasePath(uri string) (string, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "sqlite" {
+		return "", fmt.Errorf("Unsupported scheme '%s', expected sqlite://", u.Scheme)
+	}
+
+	q := u.Query()
+
+	dsn := q.Get("dsn")
+
+	if dsn == "" {
+		return "", fmt.Errorf("Missing 'dsn' parameter")
+	}
+
+	if strings.Contains(dsn, ":memory:") || strings.HasPrefix(dsn, "file:") {
+		return "", fmt.Errorf("The 'dsn' parameter must be the path to a file")
+	}
+
+	if q.Get("mode") == "ro" || q.Get("immutable") != "" {
+		return "", fmt.Errorf("Databases can not be built in read-only mode")
+	}
+
+	return dsn, nil
+}
@@ -0,0 +1,235 @@
+// compare-pip performs the same (random) point-in-polygon queries against two spatial databases and reports
+// how long each database took and the queries for which they returned different results.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func main() {
+
+	database_uri := flag.String("spatial-database-uri", "", "A valid spatial database URI for the database to compare against, for example sqlite://?dsn={PATH}.")
+	compare_uri := flag.String("compare-database-uri", "", "A valid spatial database URI for the database to compare, for example spatialite://?dsn={PATH}.")
+	str_extent := flag.String("extent", "", "An optional comma-separated bounding box ({MINX},{MINY},{MAXX},{MAXY}) to perform queries in. If empty the extent of the rtree (or spr) table in the database defined by -spatial-database-uri is used.")
+	queries := flag.Int("queries", 1000, "The number of (random) point-in-polygon queries to perform.")
+	seed := flag.Int64("seed", 1, "The seed used to generate random coordinates.")
+	verbose := flag.Bool("verbose", false, "Print the coordinates and results for every query with different results.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Compare the results and performance of point-in-polygon queries against two spatial databases.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	ctx := context.Background()
+
+	if *database_uri == "" || *compare_uri == "" {
+		log.Fatal("The -spatial-database-uri and -compare-database-uri flags are both required")
+	}
+
+	if *queries < 1 {
+		log.Fatal("The -queries flag must be greater than zero")
+	}
+
+	var extent [4]float64
+	var err error
+
+	if *str_extent != "" {
+		extent, err = parseExtent(*str_extent)
+	} else {
+		extent, err = databaseExtent(ctx, *database_uri)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to determine extent, %v", err)
+	}
+
+	r := rand.New(rand.NewSource(*seed))
+
+	coords := make([][2]float64, *queries)
+
+	for i := 0; i < *queries; i++ {
+		x := extent[0] + r.Float64()*(extent[2]-extent[0])
+		y := extent[1] + r.Float64()*(extent[3]-extent[1])
+		coords[i] = [2]float64{x, y}
+	}
+
+	fmt.Printf("queries: %d extent: %v\n", *queries, extent)
+
+	results := make([][]string, 0)
+
+	for _, uri := range []string{*database_uri, *compare_uri} {
+
+		db, err := database.NewSpatialDatabase(ctx, uri)
+
+		if err != nil {
+			log.Fatalf("Failed to create spatial database for %s, %v", uri, err)
+		}
+
+		db_results := make([]string, *queries)
+		timings := make([]time.Duration, *queries)
+		matches := 0
+
+		t1 := time.Now()
+
+		for i, pt := range coords {
+
+			c, err := geo.NewCoordinate(pt[0], pt[1])
+
+			if err != nil {
+				log.Fatalf("Failed to create coordinate, %v", err)
+			}
+
+			t2 := time.Now()
+
+			rsp, err := db.PointInPolygon(ctx, c)
+
+			if err != nil {
+				log.Fatalf("Failed to perform point-in-polygon query against %s, %v", uri, err)
+			}
+
+			timings[i] = time.Since(t2)
+			matches += len(rsp.Results())
+
+			db_results[i] = resultsKey(rsp)
+		}
+
+		elapsed := time.Since(t1)
+
+		db.Disconnect(ctx)
+
+		sort.Slice(timings, func(i, j int) bool {
+			return timings[i] < timings[j]
+		})
+
+		p50 := timings[len(timings)/2]
+		p95 := timings[(len(timings)*95)/100]
+		qps := float64(*queries) / elapsed.Seconds()
+
+		fmt.Printf("database: %s\n\ttotal: %-14v queries/sec: %-10.1f p50: %-12v p95: %-12v matches: %d\n", uri, elapsed, qps, p50, p95, matches)
+
+		results = append(results, db_results)
+	}
+
+	differences := 0
+
+	for i, pt := range coords {
+
+		if results[0][i] == results[1][i] {
+			continue
+		}
+
+		differences += 1
+
+		if *verbose {
+			fmt.Printf("%f,%f\t[%s]\t[%s]\n", pt[1], pt[0], results[0][i], results[1][i])
+		}
+	}
+
+	fmt.Printf("queries with different results: %d\n", differences)
+}
+
+// resultsKey returns a string containing the sorted paths for the places in 'rsp' so that results can be compared.
+func resultsKey(rsp spr.StandardPlacesResults) string {
+
+	paths := make([]string, 0)
+
+	for _, s := range rsp.Results() {
+		paths = append(paths, s.Path())
+	}
+
+	sort.Strings(paths)
+	return strings.Join(paths, ",")
+}
+
+func parseExtent(str_extent string) ([4]float64, error) {
+
+	var extent [4]float64
+
+	parts := strings.Split(str_extent, ",")
+
+	if len(parts) != 4 {
+		return extent, fmt.Errorf("Invalid extent '%s'", str_extent)
+	}
+
+	for i, p := range parts {
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+
+		if err != nil {
+			return extent, fmt.Errorf("Invalid extent '%s', %v", str_extent, err)
+		}
+
+		extent[i] = v
+	}
+
+	return extent, nil
+}
+
+// databaseExtent returns the extent of the rtree table for the database defined by 'uri' or, if it doesn't have
+// one, the extent of the spr table which is present for both sqlite:// and spatialite:// databases.
+func databaseExtent(ctx context.Context, uri string) ([4]float64, error) {
+
+	var extent [4]float64
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return extent, err
+	}
+
+	dsn := u.Query().Get("dsn")
+
+	if dsn == "" || strings.Contains(dsn, ":memory:") {
+		return extent, fmt.Errorf("The 'dsn' parameter for %s must be a path to a database on disk, or use the -extent flag", uri)
+	}
+
+	db, err := sqlite_database.NewDB(dsn)
+
+	if err != nil {
+		return extent, err
+	}
+
+	defer db.Close()
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return extent, err
+	}
+
+	row := conn.QueryRowContext(ctx, "SELECT MIN(min_x), MIN(min_y), MAX(max_x), MAX(max_y) FROM rtree")
+
+	err = row.Scan(&extent[0], &extent[1], &extent[2], &extent[3])
+
+	if err == nil {
+		return extent, nil
+	}
+
+	row = conn.QueryRowContext(ctx, "SELECT MIN(min_longitude), MIN(min_latitude), MAX(max_longitude), MAX(max_latitude) FROM spr")
+
+	err = row.Scan(&extent[0], &extent[1], &extent[2], &extent[3])
+
+	if err != nil {
+		return extent, err
+	}
+
+	return extent, nil
+}
@@ -0,0 +1,283 @@
+// query performs a point-in-polygon query against a spatial database, without starting an HTTP server, and
+// prints the results as SPR JSON, a GeoJSON FeatureCollection or a table.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/flags"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/server"
+	"github.com/whosonfirst/go-whosonfirst-spatial-pip"
+	"github.com/whosonfirst/go-whosonfirst-spatial/app"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"github.com/whosonfirst/go-whosonfirst-spr-geojson"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+func main() {
+
+	fs, err := spatial_flags.CommonFlags()
+
+	if err != nil {
+		log.Fatalf("Failed to derive common spatial flags, %v", err)
+	}
+
+	err = spatial_flags.AppendQueryFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to append query flags, %v", err)
+	}
+
+	err = flags.AppendCustomPlacetypesFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to append custom placetypes flags, %v", err)
+	}
+
+	format := fs.String("format", "json", "The format to print results in. Valid options are: json (SPR JSON), geojson (a GeoJSON FeatureCollection), table (columns aligned with spaces, for reading rather than parsing).")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Perform a point-in-polygon query against a spatial database and print the results.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	flagset.Parse(fs)
+
+	err = flagset.SetFlagsFromEnvVarsWithFeedback(fs, "WHOSONFIRST", true)
+
+	if err != nil {
+		log.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	err = spatial_flags.ValidateCommonFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to validate common flags, %v", err)
+	}
+
+	err = spatial_flags.ValidateQueryFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to validate query flags, %v", err)
+	}
+
+	err = flags.ValidateCustomPlacetypesFlags(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to validate custom placetypes flags, %v", err)
+	}
+
+	switch *format {
+	case "json", "geojson", "table":
+		// pass
+	default:
+		log.Fatalf("Invalid -format flag '%s'", *format)
+	}
+
+	ctx := context.Background()
+
+	properties, _ := lookup.MultiStringVar(fs, spatial_flags.PROPERTIES)
+
+	err = server.AppendCustomPlacetypesWithFlagSet(ctx, fs)
+
+	if err != nil {
+		log.Fatalf("Failed to append custom placetypes, %v", err)
+	}
+
+	spatial_db, err := app.NewSpatialDatabaseWithFlagSet(ctx, fs)
+
+	if err != nil {
+		log.Fatalf("Failed to create spatial database, %v", err)
+	}
+
+	defer spatial_db.Disconnect(ctx)
+
+	properties_r, err := app.NewPropertiesReaderWithFlagsSet(ctx, fs)
+
+	if err != nil {
+		log.Fatalf("Failed to create properties reader, %v", err)
+	}
+
+	if properties_r == nil {
+		properties_r = spatial_db
+	}
+
+	// QueryPointInPolygon only needs the spatial database but it expects a spatial application
+
+	spatial_app := &app.SpatialApplication{
+		SpatialDatabase:  spatial_db,
+		PropertiesReader: properties_r,
+	}
+
+	req, err := pip.NewPointInPolygonRequestFromFlagSet(fs)
+
+	if err != nil {
+		log.Fatalf("Failed to create point-in-polygon request, %v", err)
+	}
+
+	rsp, err := pip.QueryPointInPolygon(ctx, spatial_app, req)
+
+	if err != nil {
+		log.Fatalf("Failed to perform point-in-polygon query, %v", err)
+	}
+
+	// GeoJSON features already contain all of their properties so any -property flags are ignored
+
+	if *format == "geojson" {
+
+		geojson_opts := &geojson.AsFeatureCollectionOptions{
+			Reader: spatial_db,
+			Writer: os.Stdout,
+		}
+
+		err := geojson.AsFeatureCollection(ctx, rsp, geojson_opts)
+
+		if err != nil {
+			log.Fatalf("Failed to write GeoJSON, %v", err)
+		}
+
+		return
+	}
+
+	var props_rsp *spatial.PropertiesResponseResults
+
+	if len(properties) > 0 {
+
+		props_opts := &spatial.PropertiesResponseOptions{
+			Reader:       properties_r,
+			Keys:         properties,
+			SourcePrefix: "properties",
+		}
+
+		props_rsp, err = spatial.PropertiesResponseResultsWithStandardPlacesResults(ctx, props_opts, rsp)
+
+		if err != nil {
+			log.Fatalf("Failed to append properties, %v", err)
+		}
+	}
+
+	if *format == "table" {
+
+		err := writeTable(os.Stdout, rsp, properties, props_rsp)
+
+		if err != nil {
+			log.Fatalf("Failed to write table, %v", err)
+		}
+
+		return
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+
+	if props_rsp != nil {
+		err = enc.Encode(props_rsp)
+	} else {
+		err = enc.Encode(rsp)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to write JSON, %v", err)
+	}
+}
+
+// writeTable writes a header row, followed by a row for each result in 'rsp', to 'wr' with columns aligned using spaces.
+// If 'properties' is not empty then a column for each property, with values read from 'props_rsp', is added.
+// Wildcard properties are expanded to the properties they matched (see propertyColumns).
+func writeTable(wr io.Writer, rsp spr.StandardPlacesResults, properties []string, props_rsp *spatial.PropertiesResponseResults) error {
+
+	tw := tabwriter.NewWriter(wr, 0, 4, 2, ' ', 0)
+
+	columns := propertyColumns(properties, props_rsp)
+
+	header := []string{"id", "name", "placetype", "country", "repo", "is_current"}
+	header = append(header, columns...)
+
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for idx, r := range rsp.Results() {
+
+		row := []string{
+			r.Id(),
+			r.Name(),
+			r.Placetype(),
+			r.Country(),
+			r.Repo(),
+			r.IsCurrent().StringFlag(),
+		}
+
+		for _, k := range columns {
+
+			v := ""
+
+			if props_rsp != nil {
+
+				if pv, ok := (*props_rsp.Properties[idx])[k]; ok && pv != nil {
+					v = fmt.Sprintf("%v", pv)
+				}
+			}
+
+			row = append(row, v)
+		}
+
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// propertyColumns returns the table columns for 'properties'. Properties ending in "*" or ":" are prefix matches,
+// as they are for spatial.PropertiesResponseResultsWithStandardPlacesResults, so they are replaced by the sorted list
+// of matching properties found in any of the results in 'props_rsp'.
+func propertyColumns(properties []string, props_rsp *spatial.PropertiesResponseResults) []string {
+
+	columns := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, k := range properties {
+
+		if !strings.HasSuffix(k, "*") && !strings.HasSuffix(k, ":") {
+
+			if !seen[k] {
+				columns = append(columns, k)
+				seen[k] = true
+			}
+
+			continue
+		}
+
+		if props_rsp == nil {
+			continue
+		}
+
+		prefix := strings.Replace(k, "*", "", -1)
+		matches := make([]string, 0)
+
+		for _, props := range props_rsp.Properties {
+
+			for pk := range *props {
+
+				if strings.HasPrefix(pk, prefix) && !seen[pk] {
+					matches = append(matches, pk)
+					seen[pk] = true
+				}
+			}
+		}
+
+		sort.Strings(matches)
+		columns = append(columns, matches...)
+	}
+
+	return columns
+}
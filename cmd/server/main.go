@@ -2,8 +2,9 @@ package main
 
 import (
 	"context"
-	_ "github.com/whosonfirst/go-whosonfirst-spatial-sqlite"
-	"github.com/whosonfirst/go-whosonfirst-spatial-www/server"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/inmemory"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/server"
 	"log"
 )
 
@@ -0,0 +1,61 @@
+// test-database runs the conformance tests in the spatialtest package against one or more spatial databases.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/multi"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/inmemory"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"log"
+	"os"
+)
+
+func main() {
+
+	var database_uris multi.MultiString
+	flag.Var(&database_uris, "spatial-database-uri", "One or more valid spatial database URIs to test. Each database will be created, and disconnected, more than once so it should not contain any data. Default is sqlite://?dsn=:memory: and inmemory://.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Run the spatialtest conformance tests against one or more spatial databases.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	ctx := context.Background()
+
+	if len(database_uris) == 0 {
+		database_uris = multi.MultiString{
+			"sqlite://?dsn=:memory:",
+			"inmemory://",
+		}
+	}
+
+	failed := false
+
+	for _, uri := range database_uris {
+
+		new_db := func(ctx context.Context) (database.SpatialDatabase, error) {
+			return database.NewSpatialDatabase(ctx, uri)
+		}
+
+		err := spatialtest.TestSpatialDatabase(ctx, new_db)
+
+		if err != nil {
+			fmt.Printf("FAIL\t%s\n%v\n", uri, err)
+			failed = true
+			continue
+		}
+
+		fmt.Printf("ok\t%s\n", uri)
+	}
+
+	if failed {
+		log.Fatal("One or more spatial databases failed")
+	}
+}
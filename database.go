@@ -0,0 +1,1325 @@
+package sqlite
+
+// https://www.sqlite.org/rtree.html
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/skelterjohn/geom"
+	"github.com/whosonfirst/go-ioutil"
+	wof_geojson "github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"github.com/whosonfirst/go-whosonfirst-log"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	local_geo "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	local_tables "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/tables"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/timeout"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spatial/timer"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"github.com/whosonfirst/go-whosonfirst-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-sqlite-features/tables"
+	sqlite_spr "github.com/whosonfirst/go-whosonfirst-sqlite-spr"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"io"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	ctx := context.Background()
+	database.RegisterSpatialDatabase(ctx, "sqlite", NewSQLiteSpatialDatabase)
+}
+
+// The default number of workers used to inflate the candidates for a point-in-polygon query. If 0 then every
+// candidate is inflated in its own goroutine.
+var DEFAULT_WORKERS int = runtime.NumCPU() * 4
+
+// ErrReadOnly is returned when trying to add or remove features from a database opened in read-only mode.
+var ErrReadOnly = errors.New("Spatial database is read-only")
+
+type SQLiteSpatialDatabase struct {
+	database.SpatialDatabase
+	Logger         *log.WOFLogger
+	Timer          *timer.Timer
+	mu             *sync.RWMutex
+	db             *sqlite_database.SQLiteDatabase
+	rtree_table    sqlite.Table
+	points_table   sqlite.Table
+	spr_table      sqlite.Table
+	geojson_table  sqlite.Table
+	metadata_table *local_tables.MetadataTable
+	rows_table     *local_tables.FeatureRowsTable
+	gocache        *gocache.Cache
+	polygon_cache  *polygonCache
+	dsn            string
+	dsn_info       os.FileInfo
+	incremental    bool
+	workers        int
+	query_timeout  time.Duration
+	stats          *IndexingStats
+	watch_cancel   context.CancelFunc
+	read_only      bool
+	immutable      bool
+}
+
+// IndexingStats records the number of features that have been indexed, by outcome,
+// since a SQLiteSpatialDatabase instance was created. Updated counts features that had
+// already been indexed. Skipped is only incremented when the database has been created
+// with the "incremental" flag or features are indexed with a context returned by
+// WithIncrementalIndexing.
+type IndexingStats struct {
+	New     int64 `json:"new"`
+	Updated int64 `json:"updated"`
+	Skipped int64 `json:"skipped"`
+}
+
+type RTreeSpatialIndex struct {
+	geometry  []byte
+	bounds    geom.Rect
+	Id        string
+	FeatureId string
+	IsAlt     bool
+	AltLabel  string
+}
+
+func (sp RTreeSpatialIndex) Bounds() geom.Rect {
+	return sp.bounds
+}
+
+func (sp RTreeSpatialIndex) Path() string {
+
+	if sp.IsAlt {
+		return fmt.Sprintf("%s-alt-%s", sp.FeatureId, sp.AltLabel)
+	}
+
+	return sp.FeatureId
+}
+
+type SQLiteResults struct {
+	spr.StandardPlacesResults `json:",omitempty"`
+	Places                    []spr.StandardPlacesResult `json:"places"`
+}
+
+func (r *SQLiteResults) Results() []spr.StandardPlacesResult {
+	return r.Places
+}
+
+type incrementalIndexingKey struct{}
+
+// WithIncrementalIndexing returns a copy of 'ctx' that causes IndexFeature to skip features that have not changed
+// since they were last indexed, as if the database had been created with the "incremental" flag. It is used by
+// reindexing jobs which would otherwise replace every feature in the database.
+func WithIncrementalIndexing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, incrementalIndexingKey{}, true)
+}
+
+func isIncrementalIndexing(ctx context.Context) bool {
+
+	v, ok := ctx.Value(incrementalIndexingKey{}).(bool)
+	return ok && v
+}
+
+func NewSQLiteSpatialDatabase(ctx context.Context, uri string) (database.SpatialDatabase, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+
+	dsn := q.Get("dsn")
+
+	if dsn == "" {
+		return nil, errors.New("Missing 'dsn' parameter")
+	}
+
+	read_only, immutable, err := readOnlyOptions(q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sqlite_db *sqlite_database.SQLiteDatabase
+
+	if read_only {
+		sqlite_db, err = openReadOnlyDatabase(dsn, immutable)
+	} else {
+		sqlite_db, err = sqlite_database.NewDB(dsn)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSQLiteSpatialDatabaseWithDatabase(ctx, uri, sqlite_db)
+}
+
+func NewSQLiteSpatialDatabaseWithDatabase(ctx context.Context, uri string, sqlite_db *sqlite_database.SQLiteDatabase) (database.SpatialDatabase, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+
+	dsn := q.Get("dsn")
+
+	incremental := false
+
+	str_incremental := q.Get("incremental")
+
+	if str_incremental != "" {
+
+		v, err := strconv.ParseBool(str_incremental)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid 'incremental' parameter, %v", err)
+		}
+
+		incremental = v
+	}
+
+	read_only, immutable, err := readOnlyOptions(q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The metadata table records the schema version and the parameters the database was
+	// indexed with, so that they don't need to be specified every time it is opened
+
+	var metadata_table *local_tables.MetadataTable
+
+	if read_only {
+		metadata_table, err = local_tables.NewMetadataTable()
+	} else {
+		metadata_table, err = local_tables.NewMetadataTableWithDatabase(sqlite_db)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := readMetadata(ctx, sqlite_db, metadata_table)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read metadata, %v", err)
+	}
+
+	// Use the local rtree table which splits polygons that cross the antimeridian
+
+	rtree_opts, err := local_tables.DefaultRTreeTableOptions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	geometry_format := q.Get("geometry_format")
+
+	if geometry_format == "" {
+		geometry_format = metadata[METADATA_GEOMETRY_FORMAT]
+	}
+
+	// Databases created before the metadata table was introduced won't have a geometry
+	// format so derive it from the geometries that have already been indexed, if any
+
+	if geometry_format == "" {
+
+		v, err := detectGeometryFormat(ctx, sqlite_db)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to detect geometry format, %v", err)
+		}
+
+		geometry_format = v
+	}
+
+	if geometry_format != "" {
+
+		if !local_geo.IsValidGeometryFormat(geometry_format) {
+			return nil, fmt.Errorf("Invalid 'geometry_format' parameter '%s'", geometry_format)
+		}
+
+		rtree_opts.GeometryFormat = geometry_format
+	}
+
+	// The rows table is created, and populated if necessary, when the database is validated
+
+	rows_table, err := local_tables.NewFeatureRowsTable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rtree_table sqlite.Table
+	var points_table sqlite.Table
+	var spr_table sqlite.Table
+	var geojson_table sqlite.Table
+
+	if read_only {
+
+		// Read-only databases can't have tables created in them so the tables are
+		// created without a database and then checked to make sure they exist
+
+		rtree_table, err = local_tables.NewRTreeTableWithOptions(rtree_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		points_table, err = local_tables.NewPointsTable()
+
+		if err != nil {
+			return nil, err
+		}
+
+		spr_table, err = tables.NewSPRTable()
+
+		if err != nil {
+			return nil, err
+		}
+
+		geojson_table, err = tables.NewGeoJSONTable()
+
+		if err != nil {
+			return nil, err
+		}
+
+	} else {
+
+		rtree_opts.FeatureRowsTable = rows_table
+
+		rtree_table, err = local_tables.NewRTreeTableWithDatabaseAndOptions(sqlite_db, rtree_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The rtree table only indexes polygons so points are stored in a separate
+		// rtree table used by nearby queries
+
+		points_opts, err := local_tables.DefaultPointsTableOptions()
+
+		if err != nil {
+			return nil, err
+		}
+
+		points_opts.FeatureRowsTable = rows_table
+
+		points_table, err = local_tables.NewPointsTableWithDatabaseAndOptions(sqlite_db, points_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		spr_table, err = tables.NewSPRTableWithDatabase(sqlite_db)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// This is so we can satisfy the reader.Reader requirement
+		// in the spatial.SpatialDatabase interface
+
+		geojson_table, err = tables.NewGeoJSONTableWithDatabase(sqlite_db)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	workers := DEFAULT_WORKERS
+
+	str_workers := q.Get("workers")
+
+	if str_workers != "" {
+
+		v, err := strconv.Atoi(str_workers)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid 'workers' parameter, %v", err)
+		}
+
+		if v < 0 {
+			return nil, fmt.Errorf("Invalid 'workers' parameter, must be greater than or equal to zero")
+		}
+
+		workers = v
+	}
+
+	query_timeout, err := timeout.QueryTimeout(q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The polygon cache is disabled by default
+
+	var polygon_cache *polygonCache
+
+	str_cache_size := q.Get("polygon_cache_size")
+
+	if str_cache_size != "" {
+
+		cache_size, err := strconv.ParseInt(str_cache_size, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid 'polygon_cache_size' parameter, %v", err)
+		}
+
+		if cache_size < 0 {
+			return nil, fmt.Errorf("Invalid 'polygon_cache_size' parameter, must be greater than or equal to zero")
+		}
+
+		if cache_size > 0 {
+			polygon_cache = newPolygonCache(cache_size * 1024 * 1024)
+		}
+	}
+
+	watch_dsn := false
+
+	str_watch := q.Get("watch_dsn")
+
+	if str_watch != "" {
+
+		v, err := strconv.ParseBool(str_watch)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid 'watch_dsn' parameter, %v", err)
+		}
+
+		watch_dsn = v
+	}
+
+	watch_interval := DEFAULT_WATCH_DSN_INTERVAL
+
+	str_interval := q.Get("watch_dsn_interval")
+
+	if str_interval != "" {
+
+		v, err := strconv.Atoi(str_interval)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid 'watch_dsn_interval' parameter, %v", err)
+		}
+
+		if v <= 0 {
+			return nil, fmt.Errorf("Invalid 'watch_dsn_interval' parameter, must be greater than zero")
+		}
+
+		watch_interval = v
+	}
+
+	if watch_dsn && (dsn == ":memory:" || strings.HasPrefix(dsn, "file:")) {
+		return nil, fmt.Errorf("Invalid 'watch_dsn' parameter, the 'dsn' parameter must be the path to a file")
+	}
+
+	// The file that was opened is recorded so that it is possible to tell when it has been replaced
+
+	var dsn_info os.FileInfo
+
+	if watch_dsn {
+
+		info, err := os.Stat(dsn)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to stat %s, %v", dsn, err)
+		}
+
+		dsn_info = info
+	}
+
+	logger := log.SimpleWOFLogger("index")
+
+	expires := 5 * time.Minute
+	cleanup := 30 * time.Minute
+
+	gc := gocache.New(expires, cleanup)
+
+	mu := new(sync.RWMutex)
+
+	t := timer.NewTimer()
+
+	spatial_db := &SQLiteSpatialDatabase{
+		Logger:         logger,
+		Timer:          t,
+		db:             sqlite_db,
+		rtree_table:    rtree_table,
+		points_table:   points_table,
+		spr_table:      spr_table,
+		geojson_table:  geojson_table,
+		metadata_table: metadata_table,
+		rows_table:     rows_table,
+		gocache:        gc,
+		polygon_cache:  polygon_cache,
+		dsn:            dsn,
+		dsn_info:       dsn_info,
+		mu:             mu,
+		incremental:    incremental,
+		workers:        workers,
+		query_timeout:  query_timeout,
+		stats:          new(IndexingStats),
+		read_only:      read_only,
+		immutable:      immutable,
+	}
+
+	err = spatial_db.validateDatabase(ctx, sqlite_db)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to validate database, %v", err)
+	}
+
+	if !read_only {
+
+		err := spatial_db.migrateDatabase(ctx, sqlite_db)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to migrate database, %v", err)
+		}
+
+		err = spatial_db.initializeMetadata(ctx, rtree_opts.GeometryFormat)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to initialize metadata, %v", err)
+		}
+	}
+
+	if watch_dsn {
+
+		// The watcher runs until the database is disconnected rather than for the
+		// lifetime of the context used to create it
+
+		watch_ctx, watch_cancel := context.WithCancel(context.Background())
+		spatial_db.watch_cancel = watch_cancel
+
+		go spatial_db.watchDSN(watch_ctx, time.Duration(watch_interval)*time.Second)
+	}
+
+	return spatial_db, nil
+}
+
+func (r *SQLiteSpatialDatabase) Disconnect(ctx context.Context) error {
+
+	if r.watch_cancel != nil {
+		r.watch_cancel()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.db.Close()
+}
+
+func (r *SQLiteSpatialDatabase) IndexFeature(ctx context.Context, f wof_geojson.Feature) error {
+
+	if r.read_only {
+		return ErrReadOnly
+	}
+
+	// None of the tables index alternate geometries, and the spr table is used to look up
+	// when a feature was last indexed, so there is nothing to count
+
+	if whosonfirst.IsAlt(f) {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lastmod := whosonfirst.LastModified(f)
+	alt_label := whosonfirst.AltLabel(f)
+
+	incremental := r.incremental || isIncrementalIndexing(ctx)
+
+	stored, err := r.lastModified(ctx, f.Id(), alt_label)
+
+	switch {
+	case err == sql.ErrNoRows:
+		atomic.AddInt64(&r.stats.New, 1)
+	case err != nil:
+		return err
+	case incremental && lastmod > 0 && stored >= lastmod:
+		atomic.AddInt64(&r.stats.Skipped, 1)
+		return nil
+	default:
+
+		// The rtree and points tables assign a new primary key to every geometry
+		// they index so any existing rows need to be removed first, whether or not
+		// incremental indexing is enabled, or the previous geometry will continue
+		// to match queries. Rows are removed by their primary key so this doesn't
+		// require scanning either table.
+
+		err := r.removeRTreeRows(ctx, f.Id(), alt_label)
+
+		if err != nil {
+			return err
+		}
+
+		atomic.AddInt64(&r.stats.Updated, 1)
+	}
+
+	// SPR results are cached without an expiry so any previous version of the
+	// feature needs to be removed from the cache or it will continue to be returned
+
+	r.gocache.Delete(sprCacheKey(f.Id(), alt_label))
+
+	err = r.rtree_table.IndexRecord(r.db, f)
+
+	if err != nil {
+		return err
+	}
+
+	err = r.points_table.IndexRecord(r.db, f)
+
+	if err != nil {
+		return err
+	}
+
+	err = r.spr_table.IndexRecord(r.db, f)
+
+	if err != nil {
+		return err
+	}
+
+	if r.geojson_table != nil {
+
+		err = r.geojson_table.IndexRecord(r.db, f)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IndexingStats returns a snapshot of the number of new, updated and skipped features
+// indexed by the database.
+func (r *SQLiteSpatialDatabase) IndexingStats() *IndexingStats {
+
+	stats := &IndexingStats{
+		New:     atomic.LoadInt64(&r.stats.New),
+		Updated: atomic.LoadInt64(&r.stats.Updated),
+		Skipped: atomic.LoadInt64(&r.stats.Skipped),
+	}
+
+	return stats
+}
+
+func (r *SQLiteSpatialDatabase) lastModified(ctx context.Context, id string, alt_label string) (int64, error) {
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return -1, err
+	}
+
+	q := fmt.Sprintf("SELECT lastmodified FROM %s WHERE id = ? AND alt_label = ?", r.spr_table.Name())
+
+	row := conn.QueryRowContext(ctx, q, id, alt_label)
+
+	var lastmod int64
+
+	err = row.Scan(&lastmod)
+
+	if err != nil {
+		return -1, err
+	}
+
+	return lastmod, nil
+}
+
+func (r *SQLiteSpatialDatabase) removeRTreeRows(ctx context.Context, id string, alt_label string) error {
+
+	// The rows table is used to find the rows for a feature by their primary key since
+	// the auxiliary columns in an rtree table can only be queried by scanning the table
+
+	feature_rows, err := r.rows_table.Rows(ctx, r.db, id, alt_label)
+
+	if err != nil {
+		return err
+	}
+
+	if len(feature_rows) == 0 {
+		return nil
+	}
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return err
+	}
+
+	rtree_tables := map[string]sqlite.Table{
+		r.rtree_table.Name():  r.rtree_table,
+		r.points_table.Name(): r.points_table,
+	}
+
+	for _, row := range feature_rows {
+
+		t, ok := rtree_tables[row.Table]
+
+		if !ok {
+			return fmt.Errorf("Unknown table '%s' for row %d", row.Table, row.RowId)
+		}
+
+		// Rows are keyed by their ID in the polygon cache so those IDs need to be
+		// removed from the cache since SQLite may reuse them
+
+		if r.polygon_cache != nil && t == r.rtree_table {
+			r.polygon_cache.Delete(fmt.Sprintf("%s#%d", id, row.RowId))
+		}
+
+		q := fmt.Sprintf("DELETE FROM %s WHERE id = ?", t.Name())
+
+		_, err = conn.ExecContext(ctx, q, row.RowId)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.rows_table.RemoveRows(ctx, r.db, id, alt_label)
+}
+
+// RemoveFeature removes the feature whose ID is 'id' and whose alternate geometry label is 'alt_label'
+// from all the tables in the database.
+func (r *SQLiteSpatialDatabase) RemoveFeature(ctx context.Context, id string, alt_label string) error {
+
+	if r.read_only {
+		return ErrReadOnly
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.removeRTreeRows(ctx, id, alt_label)
+
+	if err != nil {
+		return err
+	}
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return err
+	}
+
+	tables := []sqlite.Table{
+		r.spr_table,
+	}
+
+	if r.geojson_table != nil {
+		tables = append(tables, r.geojson_table)
+	}
+
+	for _, t := range tables {
+
+		q := fmt.Sprintf("DELETE FROM %s WHERE id = ? AND alt_label = ?", t.Name())
+
+		_, err = conn.ExecContext(ctx, q, id, alt_label)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	r.gocache.Delete(sprCacheKey(id, alt_label))
+	return nil
+}
+
+// sprCacheKey returns the key used to cache the SPR for the feature with 'id' and 'alt_label', which is the same
+// as the path returned by RTreeSpatialIndex.Path.
+func sprCacheKey(id string, alt_label string) string {
+
+	if alt_label != "" {
+		return fmt.Sprintf("%s-alt-%s", id, alt_label)
+	}
+
+	return id
+}
+
+func (r *SQLiteSpatialDatabase) PointInPolygon(ctx context.Context, coord *geom.Coord, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	ctx, cancel := timeout.WithQueryTimeout(ctx, r.query_timeout)
+	defer cancel()
+
+	/*
+		t1 := time.Now()
+
+		defer func() {
+			golog.Printf("Time to point in polygon, %v\n", time.Since(t1))
+		}()
+
+	*/
+
+	rsp_ch := make(chan spr.StandardPlacesResult)
+	err_ch := make(chan error)
+	done_ch := make(chan bool)
+
+	results := make([]spr.StandardPlacesResult, 0)
+
+	// Cancelling the context when we return, for any reason, ensures that any goroutines
+	// still trying to send results or errors will stop rather than block forever
+
+	go r.PointInPolygonWithChannels(ctx, rsp_ch, err_ch, done_ch, coord, filters...)
+
+	// Every result is sent before 'done_ch' is signaled so there is nothing left to
+	// read from 'rsp_ch' once it has been
+
+	for working := true; working; {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-done_ch:
+			working = false
+		case rsp := <-rsp_ch:
+			results = append(results, rsp)
+		case err := <-err_ch:
+			return nil, err
+		}
+	}
+
+	/*
+		for label, timings := range r.Timer.Timings {
+
+			for _, tm := range timings {
+				golog.Printf("[%s] %s\n", label, tm)
+			}
+		}
+	*/
+
+	spr_results := &SQLiteResults{
+		Places: results,
+	}
+
+	return spr_results, nil
+}
+
+func (r *SQLiteSpatialDatabase) PointInPolygonWithChannels(ctx context.Context, rsp_ch chan spr.StandardPlacesResult, err_ch chan error, done_ch chan bool, coord *geom.Coord, filters ...spatial.Filter) {
+
+	defer func() {
+		timeout.SendDone(ctx, done_ch)
+	}()
+
+	// Queries hold the read lock so that the database can't be swapped out from under them
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rows, err := r.getIntersectsByCoord(ctx, coord, filters...)
+
+	if err != nil {
+		timeout.SendError(ctx, err_ch, err)
+		return
+	}
+
+	r.inflateResultsWithChannels(ctx, rsp_ch, err_ch, rows, coord, filters...)
+	return
+}
+
+func (r *SQLiteSpatialDatabase) PointInPolygonCandidates(ctx context.Context, coord *geom.Coord, filters ...spatial.Filter) ([]*spatial.PointInPolygonCandidate, error) {
+
+	ctx, cancel := timeout.WithQueryTimeout(ctx, r.query_timeout)
+	defer cancel()
+
+	rsp_ch := make(chan *spatial.PointInPolygonCandidate)
+	err_ch := make(chan error)
+	done_ch := make(chan bool)
+
+	candidates := make([]*spatial.PointInPolygonCandidate, 0)
+
+	go r.PointInPolygonCandidatesWithChannels(ctx, rsp_ch, err_ch, done_ch, coord, filters...)
+
+	for working := true; working; {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-done_ch:
+			working = false
+		case rsp := <-rsp_ch:
+			candidates = append(candidates, rsp)
+		case err := <-err_ch:
+			return nil, err
+		}
+	}
+
+	return candidates, nil
+}
+
+func (r *SQLiteSpatialDatabase) PointInPolygonCandidatesWithChannels(ctx context.Context, rsp_ch chan *spatial.PointInPolygonCandidate, err_ch chan error, done_ch chan bool, coord *geom.Coord, filters ...spatial.Filter) {
+
+	defer func() {
+		timeout.SendDone(ctx, done_ch)
+	}()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	intersects, err := r.getIntersectsByCoord(ctx, coord, filters...)
+
+	if err != nil {
+		timeout.SendError(ctx, err_ch, err)
+		return
+	}
+
+	for _, sp := range intersects {
+
+		bounds := sp.Bounds()
+
+		c := &spatial.PointInPolygonCandidate{
+			Id:        sp.Id,
+			FeatureId: sp.FeatureId,
+			AltLabel:  sp.AltLabel,
+			Bounds:    &bounds,
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case rsp_ch <- c:
+			// pass
+		}
+	}
+
+	return
+}
+
+func (r *SQLiteSpatialDatabase) getIntersectsByCoord(ctx context.Context, coord *geom.Coord, filters ...spatial.Filter) ([]*RTreeSpatialIndex, error) {
+
+	// how small can this be?
+
+	offset := geom.Coord{
+		X: 0.00001,
+		Y: 0.00001,
+	}
+
+	min := coord.Minus(offset)
+	max := coord.Plus(offset)
+
+	rect := &geom.Rect{
+		Min: min,
+		Max: max,
+	}
+
+	return r.getIntersectsByRect(ctx, rect, filters...)
+}
+
+func (r *SQLiteSpatialDatabase) getIntersectsByRect(ctx context.Context, rect *geom.Rect, filters ...spatial.Filter) ([]*RTreeSpatialIndex, error) {
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Return every row whose bounding box intersects 'rect'. This used to test whether
+	// the bounding box contained 'rect' which is the same thing for the tiny rectangles
+	// derived from a single coordinate but not for radius queries
+
+	q := fmt.Sprintf("SELECT id, wof_id, is_alt, alt_label, geometry, min_x, min_y, max_x, max_y FROM %s  WHERE min_x <= ? AND max_x >= ?  AND min_y <= ? AND max_y >= ?", r.rtree_table.Name())
+
+	rows, err := conn.QueryContext(ctx, q, rect.Max.X, rect.Min.X, rect.Max.Y, rect.Min.Y)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	intersects := make([]*RTreeSpatialIndex, 0)
+
+	for rows.Next() {
+
+		var id string
+		var feature_id string
+		var is_alt int32
+		var alt_label string
+		var geometry []byte
+		var minx float64
+		var miny float64
+		var maxx float64
+		var maxy float64
+
+		err := rows.Scan(&id, &feature_id, &is_alt, &alt_label, &geometry, &minx, &miny, &maxx, &maxy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		min := geom.Coord{
+			X: minx,
+			Y: miny,
+		}
+
+		max := geom.Coord{
+			X: maxx,
+			Y: maxy,
+		}
+
+		rect := geom.Rect{
+			Min: min,
+			Max: max,
+		}
+
+		i := &RTreeSpatialIndex{
+			Id:        fmt.Sprintf("%s#%s", feature_id, id),
+			FeatureId: feature_id,
+			bounds:    rect,
+			geometry:  geometry,
+		}
+
+		if is_alt == 1 {
+			i.IsAlt = true
+			i.AltLabel = alt_label
+		}
+
+		intersects = append(intersects, i)
+	}
+
+	return intersects, nil
+}
+
+func (r *SQLiteSpatialDatabase) inflateResultsWithChannels(ctx context.Context, rsp_ch chan spr.StandardPlacesResult, err_ch chan error, possible []*RTreeSpatialIndex, c *geom.Coord, filters ...spatial.Filter) {
+
+	seen := make(map[string]bool)
+	mu := new(sync.RWMutex)
+
+	// Candidates are inflated by a fixed number of workers so that queries matching a
+	// large number of polygons don't start thousands of goroutines all querying SQLite
+	// at once. If the number of workers is 0 then every candidate gets its own worker.
+
+	workers := r.workers
+
+	if workers <= 0 || workers > len(possible) {
+		workers = len(possible)
+	}
+
+	sp_ch := make(chan *RTreeSpatialIndex)
+
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for sp := range sp_ch {
+				r.inflateSpatialIndexWithChannels(ctx, rsp_ch, err_ch, seen, mu, sp, c, filters...)
+			}
+		}()
+	}
+
+feed:
+	for _, sp := range possible {
+
+		select {
+		case <-ctx.Done():
+			break feed
+		case sp_ch <- sp:
+			// pass
+		}
+	}
+
+	close(sp_ch)
+	wg.Wait()
+}
+
+func (r *SQLiteSpatialDatabase) inflateSpatialIndexWithChannels(ctx context.Context, rsp_ch chan spr.StandardPlacesResult, err_ch chan error, seen map[string]bool, mu *sync.RWMutex, sp *RTreeSpatialIndex, c *geom.Coord, filters ...spatial.Filter) {
+
+	select {
+	case <-ctx.Done():
+		return
+	default:
+		// pass
+	}
+
+	sp_id := fmt.Sprintf("%s:%s", sp.Id, sp.AltLabel)
+	feature_id := fmt.Sprintf("%s:%s", sp.FeatureId, sp.AltLabel)
+
+	t1 := time.Now()
+
+	defer func() {
+		r.Timer.Add(ctx, sp_id, "time to inflate", time.Since(t1))
+	}()
+
+	// have we already looked up the filters for this ID?
+	// see notes below
+
+	mu.RLock()
+	_, ok := seen[feature_id]
+	mu.RUnlock()
+
+	if ok {
+		return
+	}
+
+	t2 := time.Now()
+
+	poly, err := r.preparedPolygon(ctx, sp)
+
+	r.Timer.Add(ctx, sp_id, "time to unmarshal geometry", time.Since(t2))
+
+	if err != nil {
+		timeout.SendError(ctx, err_ch, err)
+		return
+	}
+
+	t3 := time.Now()
+
+	// Prepared polygons handle polygons that cross the antimeridian in databases
+	// created by other tools that don't split them
+
+	if !poly.ContainsCoord(c) {
+		return
+	}
+
+	r.Timer.Add(ctx, sp_id, "time to perform contains test", time.Since(t3))
+
+	// there is at least one ring that contains the coord
+	// now we check the filters - whether or not they pass
+	// we can skip every subsequent polygon with the same
+	// ID
+
+	mu.Lock()
+	seen[feature_id] = true
+	mu.Unlock()
+
+	t4 := time.Now()
+
+	s, err := r.retrieveSPR(ctx, sp.Path())
+
+	if err != nil {
+		r.Logger.Error("Failed to retrieve feature cache for %s, %v", sp_id, err)
+		return
+	}
+
+	r.Timer.Add(ctx, sp_id, "time to retrieve SPR", time.Since(t4))
+
+	if err != nil {
+		r.Logger.Error("Failed to retrieve feature cache for %s, %v", sp_id, err)
+		return
+	}
+
+	t5 := time.Now()
+
+	for _, f := range filters {
+
+		err = filter.FilterSPR(f, s)
+
+		if err != nil {
+			r.Logger.Debug("SKIP %s because filter error %s", sp_id, err)
+			return
+		}
+	}
+
+	r.Timer.Add(ctx, sp_id, "time to filter SPR", time.Since(t5))
+
+	select {
+	case <-ctx.Done():
+		// pass
+	case rsp_ch <- s:
+		// pass
+	}
+}
+
+// preparedPolygon returns a geo.PreparedPolygon instance for the geometry in 'sp', from the polygon cache if
+// it is enabled and the polygon has been prepared before.
+func (r *SQLiteSpatialDatabase) preparedPolygon(ctx context.Context, sp *RTreeSpatialIndex) (*local_geo.PreparedPolygon, error) {
+
+	if r.polygon_cache != nil {
+
+		poly, ok := r.polygon_cache.Get(sp.Id)
+
+		if ok {
+			return poly, nil
+		}
+	}
+
+	// Geometries may be encoded as JSON or using the more compact binary encoding, depending
+	// on the 'geometry_format' parameter that the database was indexed with
+
+	coords, err := local_geo.DecodePolygon(sp.geometry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(coords) == 0 {
+		return nil, errors.New("Missing coordinates for polygon")
+	}
+
+	poly := local_geo.NewPreparedPolygon(coords)
+
+	if r.polygon_cache != nil {
+		r.polygon_cache.Set(sp.Id, poly)
+	}
+
+	return poly, nil
+}
+
+// PolygonCacheStats returns a snapshot of the size of, and activity for, the database's prepared polygon cache.
+func (r *SQLiteSpatialDatabase) PolygonCacheStats() *PolygonCacheStats {
+
+	if r.polygon_cache == nil {
+		return &PolygonCacheStats{}
+	}
+
+	return r.polygon_cache.Stats()
+}
+
+func (r *SQLiteSpatialDatabase) retrieveSPR(ctx context.Context, uri_str string) (spr.StandardPlacesResult, error) {
+	return retrieveCachedSPR(ctx, r.db, r.spr_table, r.gocache, uri_str)
+}
+
+// retrieveCachedSPR returns the SPR for the feature (and alternate geometry) identified by 'uri_str' from
+// 'spr_table', caching it in 'c' without an expiry.
+func retrieveCachedSPR(ctx context.Context, db *sqlite_database.SQLiteDatabase, spr_table sqlite.Table, c *gocache.Cache, uri_str string) (spr.StandardPlacesResult, error) {
+	return retrieveCachedSPRWithExpiration(ctx, db, spr_table, c, uri_str, gocache.NoExpiration)
+}
+
+// retrieveCachedSPRWithExpiration returns the SPR for the feature (and alternate geometry) identified by 'uri_str'
+// from 'spr_table', caching it in 'c' for 'expiration'.
+func retrieveCachedSPRWithExpiration(ctx context.Context, db *sqlite_database.SQLiteDatabase, spr_table sqlite.Table, c *gocache.Cache, uri_str string, expiration time.Duration) (spr.StandardPlacesResult, error) {
+
+	cached, ok := c.Get(uri_str)
+
+	if ok {
+		return cached.(*sqlite_spr.SQLiteStandardPlacesResult), nil
+	}
+
+	id, uri_args, err := uri.ParseURI(uri_str)
+
+	if err != nil {
+		return nil, err
+	}
+
+	alt_label := ""
+
+	if uri_args.IsAlternate {
+
+		source, err := uri_args.AltGeom.String()
+
+		if err != nil {
+			return nil, err
+		}
+
+		alt_label = source
+	}
+
+	s, err := sqlite_spr.RetrieveSPR(ctx, db, spr_table, id, alt_label)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(uri_str, s, expiration)
+	return s, nil
+}
+
+// whosonfirst/go-reader interface
+
+func (r *SQLiteSpatialDatabase) Read(ctx context.Context, str_uri string) (io.ReadSeekCloser, error) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return readFeature(ctx, r.db, r.geojson_table, str_uri)
+}
+
+// readFeature returns the body of the feature identified by 'str_uri' from 'geojson_table'.
+func readFeature(ctx context.Context, db *sqlite_database.SQLiteDatabase, geojson_table sqlite.Table, str_uri string) (io.ReadSeekCloser, error) {
+
+	id, uri_args, err := uri.ParseURI(str_uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf("SELECT body FROM %s WHERE id = ?", geojson_table.Name())
+	args := []interface{}{id}
+
+	// Alternate geometries are stored with the same ID as the feature they belong to
+	// so they need to be distinguished by their label
+
+	if uri_args.IsAlternate {
+
+		alt_label, err := uri_args.AltGeom.String()
+
+		if err != nil {
+			return nil, err
+		}
+
+		q = fmt.Sprintf("%s AND alt_label = ?", q)
+		args = append(args, alt_label)
+
+	} else {
+		q = fmt.Sprintf("%s AND alt_label = ''", q)
+	}
+
+	row := conn.QueryRowContext(ctx, q, args...)
+
+	var body string
+
+	err = row.Scan(&body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sr := strings.NewReader(body)
+	fh, err := ioutil.NewReadSeekCloser(sr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fh, nil
+}
+
+func (r *SQLiteSpatialDatabase) ReaderURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+// whosonfirst/go-writer interface
+
+func (r *SQLiteSpatialDatabase) Write(ctx context.Context, key string, fh io.ReadSeeker) (int64, error) {
+
+	if r.read_only {
+		return 0, ErrReadOnly
+	}
+
+	return 0, fmt.Errorf("Not implemented")
+}
+
+func (r *SQLiteSpatialDatabase) WriterURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+func (r *SQLiteSpatialDatabase) Close(ctx context.Context) error {
+	return nil
+}
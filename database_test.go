@@ -0,0 +1,641 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpatialDatabase(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, uri := range []string{"sqlite://?dsn=:memory:", "sqlite://?dsn=:memory:&incremental=true"} {
+
+		new_db := func(ctx context.Context) (database.SpatialDatabase, error) {
+			return database.NewSpatialDatabase(ctx, uri)
+		}
+
+		err := spatialtest.TestSpatialDatabase(ctx, new_db)
+
+		if err != nil {
+			t.Fatalf("%s: %v", uri, err)
+		}
+	}
+}
+
+// TestReindexFeature checks that reindexing a feature whose name and geometry have changed replaces
+// the feature's cached SPR and its rows in the rtree table, with and without incremental indexing.
+func TestReindexFeature(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, uri := range []string{"sqlite://?dsn=:memory:", "sqlite://?dsn=:memory:&incremental=true"} {
+
+		db, err := database.NewSpatialDatabase(ctx, uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create %s, %v", uri, err)
+		}
+
+		sqlite_db := db.(*SQLiteSpatialDatabase)
+
+		for i, name := range []string{"Before", "After"} {
+
+			origin := i * 20
+
+			f, err := reindexFeature(name, int64(1600000000+i), float64(origin), float64(origin+10))
+
+			if err != nil {
+				t.Fatalf("Failed to load feature, %v", err)
+			}
+
+			err = db.IndexFeature(ctx, f)
+
+			if err != nil {
+				t.Fatalf("Failed to index feature in %s, %v", uri, err)
+			}
+
+			results, err := pointInPolygonResults(ctx, db, float64(origin+5), float64(origin+5))
+
+			if err != nil {
+				t.Fatalf("Failed to perform point-in-polygon query against %s, %v", uri, err)
+			}
+
+			if len(results) != 1 {
+				t.Fatalf("Expected 1 result from %s but got %d", uri, len(results))
+			}
+
+			if results[0].Name() != name {
+				t.Fatalf("Expected '%s' from %s but got '%s'", name, uri, results[0].Name())
+			}
+		}
+
+		// The feature's previous location should no longer match
+
+		results, err := pointInPolygonResults(ctx, db, 5.0, 5.0)
+
+		if err != nil {
+			t.Fatalf("Failed to perform point-in-polygon query against %s, %v", uri, err)
+		}
+
+		if len(results) != 0 {
+			t.Fatalf("Expected no results from %s at the feature's previous location but got %d", uri, len(results))
+		}
+
+		conn, err := sqlite_db.db.Conn()
+
+		if err != nil {
+			t.Fatalf("Failed to connect to %s, %v", uri, err)
+		}
+
+		q := fmt.Sprintf("SELECT COUNT(id) FROM %s WHERE wof_id = ?", sqlite_db.rtree_table.Name())
+
+		var count int
+
+		err = conn.QueryRowContext(ctx, q, "2001").Scan(&count)
+
+		if err != nil {
+			t.Fatalf("Failed to count rtree rows in %s, %v", uri, err)
+		}
+
+		if count != 1 {
+			t.Fatalf("Expected 1 rtree row in %s but got %d", uri, count)
+		}
+
+		stats := sqlite_db.IndexingStats()
+
+		if stats.New != 1 || stats.Updated != 1 || stats.Skipped != 0 {
+			t.Fatalf("Expected 1 new and 1 updated feature in %s but got %v", uri, stats)
+		}
+
+		err = db.Disconnect(ctx)
+
+		if err != nil {
+			t.Fatalf("Failed to disconnect %s, %v", uri, err)
+		}
+	}
+}
+
+// TestWithIncrementalIndexing checks that features which haven't changed are skipped when they are indexed with
+// a context returned by WithIncrementalIndexing, even if the database wasn't created with the "incremental" flag.
+func TestWithIncrementalIndexing(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := database.NewSpatialDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	f, err := reindexFeature("Unchanged", 1600000000, 0, 10)
+
+	if err != nil {
+		t.Fatalf("Failed to load feature, %v", err)
+	}
+
+	for _, index_ctx := range []context.Context{ctx, ctx, WithIncrementalIndexing(ctx)} {
+
+		err := db.IndexFeature(index_ctx, f)
+
+		if err != nil {
+			t.Fatalf("Failed to index feature, %v", err)
+		}
+	}
+
+	stats := db.(*SQLiteSpatialDatabase).IndexingStats()
+
+	if stats.New != 1 || stats.Updated != 1 || stats.Skipped != 1 {
+		t.Fatalf("Expected 1 new, 1 updated and 1 skipped feature but got %v", stats)
+	}
+}
+
+// TestIndexAltFeature checks that alternate geometries, which none of the tables index, are not counted as new features.
+func TestIndexAltFeature(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := database.NewSpatialDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	fixtures, err := spatialtest.Fixtures()
+
+	if err != nil {
+		t.Fatalf("Failed to load fixtures, %v", err)
+	}
+
+	alt_count := 0
+
+	for i := 0; i < 2; i++ {
+
+		for _, f := range fixtures {
+
+			if !whosonfirst.IsAlt(f) {
+				continue
+			}
+
+			alt_count += 1
+
+			err := db.IndexFeature(ctx, f)
+
+			if err != nil {
+				t.Fatalf("Failed to index %s, %v", f.Id(), err)
+			}
+		}
+	}
+
+	if alt_count == 0 {
+		t.Fatalf("Expected at least one alternate geometry in fixtures")
+	}
+
+	stats := db.(*SQLiteSpatialDatabase).IndexingStats()
+
+	if stats.New != 0 || stats.Updated != 0 || stats.Skipped != 0 {
+		t.Fatalf("Expected alternate geometries not to be counted but got %v", stats)
+	}
+}
+
+// TestRemoveRTreeRowsByPrimaryKey checks that the rows for a feature are looked up using the feature_rows table,
+// rather than by scanning the rtree table, and that they are deleted by their primary key.
+func TestRemoveRTreeRowsByPrimaryKey(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := database.NewSpatialDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	conn, err := sqlite_db.db.Conn()
+
+	if err != nil {
+		t.Fatalf("Failed to connect to database, %v", err)
+	}
+
+	queries := map[string]string{
+		fmt.Sprintf("SELECT table_name, row_id FROM %s WHERE wof_id = 1 AND alt_label = ''", sqlite_db.rows_table.Name()): "USING INDEX",
+		fmt.Sprintf("DELETE FROM %s WHERE id = 1", sqlite_db.rtree_table.Name()):                                          "INDEX 1:",
+		fmt.Sprintf("DELETE FROM %s WHERE id = 1", sqlite_db.points_table.Name()):                                         "INDEX 1:",
+	}
+
+	for q, expected := range queries {
+
+		rows, err := conn.QueryContext(ctx, "EXPLAIN QUERY PLAN "+q)
+
+		if err != nil {
+			t.Fatalf("Failed to explain '%s', %v", q, err)
+		}
+
+		plan := make([]string, 0)
+
+		for rows.Next() {
+
+			var id int
+			var parent int
+			var unused int
+			var detail string
+
+			err := rows.Scan(&id, &parent, &unused, &detail)
+
+			if err != nil {
+				t.Fatalf("Failed to scan query plan for '%s', %v", q, err)
+			}
+
+			plan = append(plan, detail)
+		}
+
+		rows.Close()
+
+		str_plan := strings.Join(plan, "; ")
+
+		if !strings.Contains(str_plan, expected) {
+			t.Fatalf("Expected query plan for '%s' to contain '%s' but got '%s'", q, expected, str_plan)
+		}
+	}
+}
+
+// TestMigrateRowsTable checks that the feature_rows table is populated for databases that were indexed before
+// it existed, so that reindexing a feature still replaces its previous geometry.
+func TestMigrateRowsTable(t *testing.T) {
+
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "migrate")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	uri := fmt.Sprintf("sqlite://?dsn=%s", url.QueryEscape(filepath.Join(root, "test.db")))
+
+	db, err := database.NewSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	f, err := reindexFeature("Before", 1600000000, 0, 10)
+
+	if err != nil {
+		t.Fatalf("Failed to load feature, %v", err)
+	}
+
+	err = db.IndexFeature(ctx, f)
+
+	if err != nil {
+		t.Fatalf("Failed to index feature, %v", err)
+	}
+
+	// Make the database look like it was created with version 1 of the schema
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	conn, err := sqlite_db.db.Conn()
+
+	if err != nil {
+		t.Fatalf("Failed to connect to database, %v", err)
+	}
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", sqlite_db.rows_table.Name()))
+
+	if err != nil {
+		t.Fatalf("Failed to drop rows table, %v", err)
+	}
+
+	err = sqlite_db.SetMetadata(ctx, METADATA_SCHEMA_VERSION, "1")
+
+	if err != nil {
+		t.Fatalf("Failed to set schema version, %v", err)
+	}
+
+	err = db.Disconnect(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to disconnect database, %v", err)
+	}
+
+	db, err = database.NewSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to reopen database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	metadata, err := db.(*SQLiteSpatialDatabase).Metadata(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to read metadata, %v", err)
+	}
+
+	if metadata[METADATA_SCHEMA_VERSION] != strconv.Itoa(SCHEMA_VERSION) {
+		t.Fatalf("Expected schema version %d but got '%s'", SCHEMA_VERSION, metadata[METADATA_SCHEMA_VERSION])
+	}
+
+	f, err = reindexFeature("After", 1600000001, 20, 30)
+
+	if err != nil {
+		t.Fatalf("Failed to load feature, %v", err)
+	}
+
+	err = db.IndexFeature(ctx, f)
+
+	if err != nil {
+		t.Fatalf("Failed to reindex feature, %v", err)
+	}
+
+	results, err := pointInPolygonResults(ctx, db, 5.0, 5.0)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point-in-polygon query, %v", err)
+	}
+
+	if len(results) != 0 {
+		t.Fatalf("Expected no results at the feature's previous location but got %d", len(results))
+	}
+
+	results, err = pointInPolygonResults(ctx, db, 25.0, 25.0)
+
+	if err != nil {
+		t.Fatalf("Failed to perform point-in-polygon query, %v", err)
+	}
+
+	if len(results) != 1 || results[0].Name() != "After" {
+		t.Fatalf("Expected the reindexed feature at its new location but got %d results", len(results))
+	}
+}
+
+// reindexFeature returns the feature, with the same ID each time, that is reindexed by tests. Its geometry is
+// a square from ('min', 'min') to ('max', 'max').
+func reindexFeature(name string, last_modified int64, min float64, max float64) (geojson.Feature, error) {
+
+	opts := &spatialtest.FeatureOptions{
+		Id:           2001,
+		Name:         name,
+		Placetype:    "region",
+		LastModified: last_modified,
+		MinX:         min,
+		MinY:         min,
+		MaxX:         max,
+		MaxY:         max,
+	}
+
+	return spatialtest.NewFeature(opts)
+}
+
+func pointInPolygonResults(ctx context.Context, db database.SpatialDatabase, x float64, y float64) ([]spr.StandardPlacesResult, error) {
+
+	c, err := geo.NewCoordinate(x, y)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := db.PointInPolygon(ctx, c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rsp.Results(), nil
+}
+
+// TestReadAltFeature checks that Read returns the body of a feature, rather than one of its alternate geometries, in
+// databases created by other tools that index alternate geometries in the geojson table.
+func TestReadAltFeature(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := database.NewSpatialDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	// Add an alternate geometry without setting is_alt, as some tools don't, so that it sorts
+	// before the feature and would be the row returned if the query didn't exclude it
+
+	conn, err := sqlite_db.db.Conn()
+
+	if err != nil {
+		t.Fatalf("Failed to connect to database, %v", err)
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s (id, body, source, is_alt, alt_label, lastmodified) VALUES (?, ?, ?, ?, ?, ?)", sqlite_db.geojson_table.Name())
+
+	_, err = conn.ExecContext(ctx, q, 1001, `{"alt": true}`, "quattroshapes", nil, "quattroshapes", 0)
+
+	if err != nil {
+		t.Fatalf("Failed to add alternate geometry, %v", err)
+	}
+
+	err = spatialtest.IndexFixtures(ctx, db)
+
+	if err != nil {
+		t.Fatalf("Failed to index fixtures, %v", err)
+	}
+
+	tests := map[string]string{
+		"1001.geojson":                   `"wof:name": "Donut"`,
+		"1001-alt-quattroshapes.geojson": `{"alt": true}`,
+	}
+
+	for uri, expected := range tests {
+
+		fh, err := db.Read(ctx, uri)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", uri, err)
+		}
+
+		body, err := ioutil.ReadAll(fh)
+		fh.Close()
+
+		if err != nil {
+			t.Fatalf("Failed to read body of %s, %v", uri, err)
+		}
+
+		if !strings.Contains(string(body), expected) {
+			t.Fatalf("Expected body of %s to contain %s", uri, expected)
+		}
+	}
+}
+
+// TestInflateResultsWorkers checks that no more than 'workers' candidates are inflated at once and that
+// cancelling a query stops the remaining candidates from being fed to the workers. The polygon cache is
+// used to count the number of candidates that have been inflated.
+func TestInflateResultsWorkers(t *testing.T) {
+
+	ctx := context.Background()
+
+	features := make([]geojson.Feature, 0)
+
+	for i := 0; i < 5; i++ {
+
+		opts := &spatialtest.FeatureOptions{
+			Id:        int64(3001 + i),
+			Name:      fmt.Sprintf("Overlapping %d", i),
+			Placetype: "region",
+			MinX:      0.0,
+			MinY:      0.0,
+			MaxX:      10.0,
+			MaxY:      10.0,
+		}
+
+		f, err := spatialtest.NewFeature(opts)
+
+		if err != nil {
+			t.Fatalf("Failed to create feature, %v", err)
+		}
+
+		features = append(features, f)
+	}
+
+	c, err := geo.NewCoordinate(5.0, 5.0)
+
+	if err != nil {
+		t.Fatalf("Failed to create coordinate, %v", err)
+	}
+
+	for _, workers := range []int{1, 2} {
+
+		uri := fmt.Sprintf("sqlite://?dsn=:memory:&polygon_cache_size=1&workers=%d", workers)
+
+		db, err := spatialtest.NewDatabaseWithFeatures(ctx, uri, features...)
+
+		if err != nil {
+			t.Fatalf("Failed to create %s, %v", uri, err)
+		}
+
+		sqlite_db := db.(*SQLiteSpatialDatabase)
+
+		possible, err := sqlite_db.getIntersectsByCoord(ctx, c)
+
+		if err != nil {
+			t.Fatalf("Failed to find candidates in %s, %v", uri, err)
+		}
+
+		if len(possible) != len(features) {
+			t.Fatalf("Expected %d candidates in %s but got %d", len(features), uri, len(possible))
+		}
+
+		inflated := func() int64 {
+			return sqlite_db.polygon_cache.Stats().Misses
+		}
+
+		waitInflated := func(expected int64) {
+
+			for i := 0; i < 500 && inflated() < expected; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			// Give any other workers a chance to (incorrectly) inflate more candidates
+
+			time.Sleep(50 * time.Millisecond)
+
+			if inflated() != expected {
+				t.Fatalf("Expected %d candidates to have been inflated in %s but got %d", expected, uri, inflated())
+			}
+		}
+
+		query_ctx, cancel := context.WithCancel(ctx)
+
+		// Nothing reads from 'rsp_ch' so each worker blocks after inflating its first candidate
+
+		rsp_ch := make(chan spr.StandardPlacesResult)
+		err_ch := make(chan error)
+		done_ch := make(chan bool)
+
+		go func() {
+			sqlite_db.inflateResultsWithChannels(query_ctx, rsp_ch, err_ch, possible, c)
+			done_ch <- true
+		}()
+
+		waitInflated(int64(workers))
+
+		// Reading a result frees a worker to inflate the next candidate
+
+		<-rsp_ch
+
+		waitInflated(int64(workers + 1))
+
+		cancel()
+
+		select {
+		case <-done_ch:
+			// pass
+		case err := <-err_ch:
+			t.Fatalf("Unexpected error inflating candidates in %s, %v", uri, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for cancelled query to return in %s", uri)
+		}
+
+		// The remaining candidates are never inflated once the query has been cancelled
+
+		if inflated() != int64(workers+1) {
+			t.Fatalf("Expected %d candidates to have been inflated in %s after cancellation but got %d", workers+1, uri, inflated())
+		}
+
+		db.Disconnect(ctx)
+	}
+}
+
+// TestPointInPolygonTimeout checks that queries which take longer than the 'query_timeout' parameter fail
+// with context.DeadlineExceeded.
+func TestPointInPolygonTimeout(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, "sqlite://?dsn=:memory:&workers=1&query_timeout=1ns")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	c, err := geo.NewCoordinate(5.0, 5.0)
+
+	if err != nil {
+		t.Fatalf("Failed to create coordinate, %v", err)
+	}
+
+	_, err = db.PointInPolygon(ctx, c)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected query to time out but got %v", err)
+	}
+}
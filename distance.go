@@ -0,0 +1,216 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/skelterjohn/geom"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/timeout"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	sqlite_spr "github.com/whosonfirst/go-whosonfirst-sqlite-spr"
+	"math"
+	"sort"
+)
+
+// PointInPolygonResult is a SQLiteStandardPlacesResult annotated with the distance, in metres, from the
+// coordinate being queried to the boundary of the polygon it represents. Distance is 0 if the polygon
+// contains the coordinate. OnBoundary is true if the coordinate is within the boundary tolerance of
+// the polygon's boundary.
+type PointInPolygonResult struct {
+	*sqlite_spr.SQLiteStandardPlacesResult
+	Distance   float64 `json:"spatial:distance"`
+	OnBoundary bool    `json:"on_boundary,omitempty"`
+}
+
+type pointInPolygonMatch struct {
+	distance    float64
+	on_boundary bool
+}
+
+// PointInPolygonWithRadius returns every polygon that intersects a circle of 'radius' metres centered on
+// 'coord', and that matches 'filters', sorted by the distance from 'coord' to the polygon's boundary.
+func (r *SQLiteSpatialDatabase) PointInPolygonWithRadius(ctx context.Context, coord *geom.Coord, radius float64, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	if radius <= 0 {
+		return nil, fmt.Errorf("Invalid radius '%f'", radius)
+	}
+
+	return r.PointInPolygonWithDistance(ctx, coord, radius, 0.0, filters...)
+}
+
+// PointInPolygonWithTolerance returns every polygon that contains 'coord', or whose boundary is within 'tolerance'
+// metres of 'coord', and that matches 'filters'. Polygons whose boundary is within 'tolerance' metres of 'coord'
+// are flagged as being "on boundary" irrespective of whether they contain 'coord'.
+func (r *SQLiteSpatialDatabase) PointInPolygonWithTolerance(ctx context.Context, coord *geom.Coord, tolerance float64, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	if tolerance <= 0 {
+		return nil, fmt.Errorf("Invalid tolerance '%f'", tolerance)
+	}
+
+	return r.PointInPolygonWithDistance(ctx, coord, 0.0, tolerance, filters...)
+}
+
+// PointInPolygonWithDistance returns every polygon that contains 'coord', that intersects a circle of 'radius' metres
+// centered on 'coord' or whose boundary is within 'tolerance' metres of 'coord', and that matches 'filters', sorted by
+// the distance from 'coord' to the polygon's boundary. Either 'radius' or 'tolerance' may be 0.
+func (r *SQLiteSpatialDatabase) PointInPolygonWithDistance(ctx context.Context, coord *geom.Coord, radius float64, tolerance float64, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	if radius < 0 {
+		return nil, fmt.Errorf("Invalid radius '%f'", radius)
+	}
+
+	if tolerance < 0 {
+		return nil, fmt.Errorf("Invalid tolerance '%f'", tolerance)
+	}
+
+	ctx, cancel := timeout.WithQueryTimeout(ctx, r.query_timeout)
+	defer cancel()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	search := math.Max(radius, tolerance)
+
+	if search == 0 {
+		return nil, errors.New("Invalid radius and tolerance, at least one must be greater than 0")
+	}
+
+	// Polygons are stored as one or more rtree rows (one for each polygon in a
+	// multipolygon) so track the shortest distance for each feature
+
+	matches := make(map[string]*pointInPolygonMatch)
+	seen := make(map[string]bool)
+
+	for _, rect := range geo.BoundingBoxesForRadius(coord, search) {
+
+		possible, err := r.getIntersectsByRect(ctx, rect, filters...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sp := range possible {
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+				// pass
+			}
+
+			// The same row may be returned for both bounding boxes
+			// when the circle crosses the antimeridian
+
+			if seen[sp.Id] {
+				continue
+			}
+
+			seen[sp.Id] = true
+
+			poly, err := r.preparedPolygon(ctx, sp)
+
+			if err != nil {
+				return nil, err
+			}
+
+			contains := poly.ContainsCoord(coord)
+
+			// Only measure the distance to the boundary of polygons that contain
+			// the coordinate if we need to know whether it is on the boundary
+
+			distance := 0.0
+			on_boundary := false
+
+			if !contains || tolerance > 0 {
+
+				boundary := geo.DistanceToBoundary(poly.Coordinates, coord)
+
+				if !contains {
+					distance = boundary
+				}
+
+				on_boundary = tolerance > 0 && boundary <= tolerance
+			}
+
+			if !contains && !on_boundary && distance > radius {
+				continue
+			}
+
+			path := sp.Path()
+
+			m, ok := matches[path]
+
+			if !ok {
+				matches[path] = &pointInPolygonMatch{
+					distance:    distance,
+					on_boundary: on_boundary,
+				}
+				continue
+			}
+
+			m.distance = math.Min(m.distance, distance)
+			m.on_boundary = m.on_boundary || on_boundary
+		}
+	}
+
+	results := make([]*PointInPolygonResult, 0)
+
+	for path, m := range matches {
+
+		s, err := r.retrieveSPR(ctx, path)
+
+		if err != nil {
+			r.Logger.Error("Failed to retrieve feature cache for %s, %v", path, err)
+			continue
+		}
+
+		ok := true
+
+		for _, f := range filters {
+
+			err = filter.FilterSPR(f, s)
+
+			if err != nil {
+				r.Logger.Debug("SKIP %s because filter error %s", path, err)
+				ok = false
+				break
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		rsp := &PointInPolygonResult{
+			SQLiteStandardPlacesResult: s.(*sqlite_spr.SQLiteStandardPlacesResult),
+			Distance:                   m.distance,
+			OnBoundary:                 m.on_boundary,
+		}
+
+		results = append(results, rsp)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+
+		if results[i].Distance == results[j].Distance {
+			return results[i].Path() < results[j].Path()
+		}
+
+		return results[i].Distance < results[j].Distance
+	})
+
+	places := make([]spr.StandardPlacesResult, len(results))
+
+	for i, rsp := range results {
+		places[i] = rsp
+	}
+
+	spr_results := &SQLiteResults{
+		Places: places,
+	}
+
+	return spr_results, nil
+}
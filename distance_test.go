@@ -0,0 +1,281 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/skelterjohn/geom"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	spatial_geo "github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"math"
+	"testing"
+)
+
+type distanceResult struct {
+	id string
+	// The expected distance in metres, which is allowed to differ by 0.1%.
+	distance float64
+}
+
+type distanceTest struct {
+	name      string
+	longitude float64
+	latitude  float64
+	radius    float64
+	expected  []*distanceResult
+}
+
+// 1006 covers (0, 0) to (25, 25) and 1001 covers (10, 10) to (20, 20) with a hole from (14, 14) to (16, 16).
+var distance_tests = []*distanceTest{
+	{
+		name: "inside", longitude: 12.0, latitude: 12.0, radius: 1000.0,
+		expected: []*distanceResult{{id: "1001", distance: 0.0}, {id: "1006", distance: 0.0}},
+	},
+	{
+		name: "just outside", longitude: 20.01, latitude: 15.0, radius: 2000.0,
+		expected: []*distanceResult{{id: "1006", distance: 0.0}, {id: "1001", distance: distanceBetween(20.01, 15.0, 20.0, 15.0)}},
+	},
+	{
+		name: "just outside (beyond radius)", longitude: 20.01, latitude: 15.0, radius: 500.0,
+		expected: []*distanceResult{{id: "1006", distance: 0.0}},
+	},
+	{
+		name: "hole", longitude: 15.0, latitude: 15.0, radius: 120000.0,
+		expected: []*distanceResult{{id: "1006", distance: 0.0}, {id: "1001", distance: distanceBetween(15.0, 15.0, 16.0, 15.0)}},
+	},
+	{
+		name: "hole (beyond radius)", longitude: 15.0, latitude: 15.0, radius: 100000.0,
+		expected: []*distanceResult{{id: "1006", distance: 0.0}},
+	},
+	{
+		name: "outside everything", longitude: -1.0, latitude: 12.0, radius: 1000.0,
+		expected: []*distanceResult{},
+	},
+	{
+		name: "outside everything (within radius)", longitude: -0.005, latitude: 12.0, radius: 1000.0,
+		expected: []*distanceResult{{id: "1006", distance: distanceBetween(-0.005, 12.0, 0.0, 12.0)}},
+	},
+}
+
+func TestPointInPolygonWithRadius(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	for _, test := range distance_tests {
+
+		coord, err := spatial_geo.NewCoordinate(test.longitude, test.latitude)
+
+		if err != nil {
+			t.Fatalf("%s: failed to create coordinate, %v", test.name, err)
+		}
+
+		rsp, err := sqlite_db.PointInPolygonWithRadius(ctx, coord, test.radius)
+
+		if err != nil {
+			t.Fatalf("%s: radius query failed, %v", test.name, err)
+		}
+
+		results := rsp.Results()
+
+		if len(results) != len(test.expected) {
+			t.Fatalf("%s: expected %d results but got %d", test.name, len(test.expected), len(results))
+		}
+
+		for i, r := range results {
+
+			pip_r := r.(*PointInPolygonResult)
+			expected := test.expected[i]
+
+			if pip_r.Id() != expected.id {
+				t.Fatalf("%s: expected result %d to be %s but got %s", test.name, i, expected.id, pip_r.Id())
+			}
+
+			if math.Abs(pip_r.Distance-expected.distance) > expected.distance*0.001 {
+				t.Fatalf("%s: expected %s to be %f metres away but got %f", test.name, expected.id, expected.distance, pip_r.Distance)
+			}
+
+			if pip_r.OnBoundary {
+				t.Fatalf("%s: expected %s not to be on the boundary when there is no tolerance", test.name, expected.id)
+			}
+		}
+	}
+}
+
+type toleranceTest struct {
+	name      string
+	longitude float64
+	latitude  float64
+	// The tolerance in metres or 0 to perform a plain point-in-polygon query.
+	tolerance float64
+	expected  []*distanceResult
+	// Whether the results are expected to be on the boundary.
+	on_boundary bool
+}
+
+// 1006's eastern edge runs along longitude 25. 0.001 degrees of longitude at latitude 12 is about 109 metres.
+var tolerance_tests = []*toleranceTest{
+	{
+		name: "on edge", longitude: 25.0, latitude: 12.0,
+		expected: []*distanceResult{{id: "1006", distance: 0.0}},
+	},
+	{
+		name: "on edge (tolerance)", longitude: 25.0, latitude: 12.0, tolerance: 10.0,
+		expected: []*distanceResult{{id: "1006", distance: 0.0}}, on_boundary: true,
+	},
+	{
+		name: "just inside", longitude: 24.999, latitude: 12.0,
+		expected: []*distanceResult{{id: "1006", distance: 0.0}},
+	},
+	{
+		name: "just inside (tolerance)", longitude: 24.999, latitude: 12.0, tolerance: 200.0,
+		expected: []*distanceResult{{id: "1006", distance: 0.0}}, on_boundary: true,
+	},
+	{
+		name: "just inside (beyond tolerance)", longitude: 24.999, latitude: 12.0, tolerance: 50.0,
+		expected: []*distanceResult{{id: "1006", distance: 0.0}},
+	},
+	{
+		name: "just outside", longitude: 25.001, latitude: 12.0,
+		expected: []*distanceResult{},
+	},
+	{
+		name: "just outside (tolerance)", longitude: 25.001, latitude: 12.0, tolerance: 200.0,
+		expected: []*distanceResult{{id: "1006", distance: distanceBetween(25.001, 12.0, 25.0, 12.0)}}, on_boundary: true,
+	},
+	{
+		name: "just outside (beyond tolerance)", longitude: 25.001, latitude: 12.0, tolerance: 50.0,
+		expected: []*distanceResult{},
+	},
+}
+
+func TestPointInPolygonWithTolerance(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	for _, test := range tolerance_tests {
+
+		coord, err := spatial_geo.NewCoordinate(test.longitude, test.latitude)
+
+		if err != nil {
+			t.Fatalf("%s: failed to create coordinate, %v", test.name, err)
+		}
+
+		var rsp spr.StandardPlacesResults
+
+		if test.tolerance > 0 {
+			rsp, err = sqlite_db.PointInPolygonWithTolerance(ctx, coord, test.tolerance)
+		} else {
+			rsp, err = sqlite_db.PointInPolygon(ctx, coord)
+		}
+
+		if err != nil {
+			t.Fatalf("%s: query failed, %v", test.name, err)
+		}
+
+		results := rsp.Results()
+
+		if len(results) != len(test.expected) {
+			t.Fatalf("%s: expected %d results but got %d", test.name, len(test.expected), len(results))
+		}
+
+		for i, r := range results {
+
+			expected := test.expected[i]
+
+			if r.Id() != expected.id {
+				t.Fatalf("%s: expected result %d to be %s but got %s", test.name, i, expected.id, r.Id())
+			}
+
+			if test.tolerance == 0 {
+				continue
+			}
+
+			pip_r := r.(*PointInPolygonResult)
+
+			if math.Abs(pip_r.Distance-expected.distance) > expected.distance*0.001 {
+				t.Fatalf("%s: expected %s to be %f metres away but got %f", test.name, expected.id, expected.distance, pip_r.Distance)
+			}
+
+			if pip_r.OnBoundary != test.on_boundary {
+				t.Fatalf("%s: expected on boundary to be %t for %s", test.name, test.on_boundary, expected.id)
+			}
+		}
+	}
+}
+
+func TestPointInPolygonWithDistanceInvalid(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	coord, err := spatial_geo.NewCoordinate(12.0, 12.0)
+
+	if err != nil {
+		t.Fatalf("Failed to create coordinate, %v", err)
+	}
+
+	_, err = sqlite_db.PointInPolygonWithRadius(ctx, coord, 0.0)
+
+	if err == nil {
+		t.Fatalf("Expected a radius of 0 to be rejected")
+	}
+
+	_, err = sqlite_db.PointInPolygonWithDistance(ctx, coord, -1.0, 0.0)
+
+	if err == nil {
+		t.Fatalf("Expected a negative radius to be rejected")
+	}
+
+	_, err = sqlite_db.PointInPolygonWithTolerance(ctx, coord, 0.0)
+
+	if err == nil {
+		t.Fatalf("Expected a tolerance of 0 to be rejected")
+	}
+
+	_, err = sqlite_db.PointInPolygonWithDistance(ctx, coord, 0.0, -1.0)
+
+	if err == nil {
+		t.Fatalf("Expected a negative tolerance to be rejected")
+	}
+
+	_, err = sqlite_db.PointInPolygonWithDistance(ctx, coord, 0.0, 0.0)
+
+	if err == nil {
+		t.Fatalf("Expected a radius and tolerance of 0 to be rejected")
+	}
+}
+
+// distanceBetween returns the distance, in metres, between two points. It is used for the expected distance from a
+// point to the nearest point on an edge running north-south, which is on the same latitude.
+func distanceBetween(lon_a float64, lat_a float64, lon_b float64, lat_b float64) float64 {
+	return geo.Haversine(&geom.Coord{X: lon_a, Y: lat_a}, &geom.Coord{X: lon_b, Y: lat_b})
+}
@@ -0,0 +1,50 @@
+package flags
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/lookup"
+)
+
+func AppendAdminFlags(fs *flag.FlagSet) error {
+
+	fs.Bool(ENABLE_ADMIN, false, "Enable the administrative API handlers for (re)indexing data.")
+
+	admin_desc := fmt.Sprintf("A shared secret that must be included, as a bearer token in the HTTP Authorization header, with requests to the administrative API handlers. Required if -%s is true.", ENABLE_ADMIN)
+	fs.String(ADMIN_TOKEN, "", admin_desc)
+
+	fs.String(PATH_ADMIN, "/admin", "The root URL for all administrative API handlers.")
+
+	return nil
+}
+
+func ValidateAdminFlags(fs *flag.FlagSet) error {
+
+	enable_admin, err := lookup.BoolVar(fs, ENABLE_ADMIN)
+
+	if err != nil {
+		return err
+	}
+
+	if !enable_admin {
+		return nil
+	}
+
+	admin_token, err := lookup.StringVar(fs, ADMIN_TOKEN)
+
+	if err != nil {
+		return err
+	}
+
+	if admin_token == "" {
+		return fmt.Errorf("Invalid or missing -%s flag", ADMIN_TOKEN)
+	}
+
+	_, err = lookup.StringVar(fs, PATH_ADMIN)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
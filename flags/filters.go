@@ -0,0 +1,207 @@
+package flags
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-json-query"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/sfomuseum/go-flags/multi"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AppendFilterFlags appends flags for restricting which documents are indexed to 'fs'. These flags are
+// converted in to go-whosonfirst-iterate/filters query parameters by IteratorURIWithFlagSet.
+func AppendFilterFlags(fs *flag.FlagSet) error {
+
+	var includes multi.MultiString
+	fs.Var(&includes, INDEX_INCLUDE, "One or more {PATH}={REGULAR EXPRESSION} queries that documents must match in order to be indexed. Paths are evaluated using tidwall/gjson syntax.")
+
+	var excludes multi.MultiString
+	fs.Var(&excludes, INDEX_EXCLUDE, "One or more {PATH}={REGULAR EXPRESSION} queries that will prevent documents from being indexed if any of them match. Paths are evaluated using tidwall/gjson syntax.")
+
+	var is_current multi.MultiInt64
+	fs.Var(&is_current, INDEX_IS_CURRENT, "One or more existential flags (-1, 0, 1) that a document's mz:is_current property must match in order to be indexed.")
+
+	var placetypes multi.MultiString
+	fs.Var(&placetypes, INDEX_PLACETYPES, "One or more place types that a document's wof:placetype property must match in order to be indexed.")
+
+	fs.Bool(INDEX_EXCLUDE_DEPRECATED, false, "Do not index documents that have been deprecated.")
+
+	return nil
+}
+
+func ValidateFilterFlags(fs *flag.FlagSet) error {
+
+	_, err := IteratorURIWithFlagSet(fs)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IteratorURIWithFlagSet returns the value of the -iterator-uri flag with any filters defined by the flags
+// in AppendFilterFlags appended as go-whosonfirst-iterate/filters query parameters. Includes are applied
+// in "ALL" mode (documents must match every include) and excludes in "ANY" mode (documents matching any
+// exclude are skipped). It returns an error if the -iterator-uri flag already contains exclude parameters
+// without an explicit exclude_mode=ANY parameter.
+func IteratorURIWithFlagSet(fs *flag.FlagSet) (string, error) {
+
+	iterator_uri, err := lookup.StringVar(fs, spatial_flags.ITERATOR_URI)
+
+	if err != nil {
+		return "", err
+	}
+
+	include_flags, err := lookup.MultiStringVar(fs, INDEX_INCLUDE)
+
+	if err != nil {
+		return "", err
+	}
+
+	exclude_flags, err := lookup.MultiStringVar(fs, INDEX_EXCLUDE)
+
+	if err != nil {
+		return "", err
+	}
+
+	is_current, err := lookup.MultiInt64Var(fs, INDEX_IS_CURRENT)
+
+	if err != nil {
+		return "", err
+	}
+
+	placetypes, err := lookup.MultiStringVar(fs, INDEX_PLACETYPES)
+
+	if err != nil {
+		return "", err
+	}
+
+	exclude_deprecated, err := lookup.BoolVar(fs, INDEX_EXCLUDE_DEPRECATED)
+
+	if err != nil {
+		return "", err
+	}
+
+	includes := make([]string, len(include_flags))
+	copy(includes, include_flags)
+
+	excludes := make([]string, len(exclude_flags))
+	copy(excludes, exclude_flags)
+
+	if len(is_current) > 0 {
+
+		flags := make([]string, len(is_current))
+
+		for i, fl := range is_current {
+
+			switch fl {
+			case -1, 0, 1:
+				flags[i] = strconv.FormatInt(fl, 10)
+			default:
+				return "", fmt.Errorf("Invalid -%s flag '%d'", INDEX_IS_CURRENT, fl)
+			}
+		}
+
+		q := fmt.Sprintf("properties.mz:is_current=^(%s)$", strings.Join(flags, "|"))
+		includes = append(includes, q)
+	}
+
+	if len(placetypes) > 0 {
+
+		pts := make([]string, len(placetypes))
+
+		for i, pt := range placetypes {
+			pts[i] = regexp.QuoteMeta(pt)
+		}
+
+		q := fmt.Sprintf("properties.wof:placetype=^(%s)$", strings.Join(pts, "|"))
+		includes = append(includes, q)
+	}
+
+	if exclude_deprecated {
+
+		// Features that have not been deprecated either have no edtf:deprecated property
+		// or an empty or "uuuu" (unknown) value
+
+		excludes = append(excludes, "properties.edtf:deprecated=^[0-9]")
+	}
+
+	if len(includes) == 0 && len(excludes) == 0 {
+		return iterator_uri, nil
+	}
+
+	var queries query.QueryFlags
+
+	for _, str_q := range includes {
+
+		err := queries.Set(str_q)
+
+		if err != nil {
+			return "", fmt.Errorf("Invalid filter query '%s', %v", str_q, err)
+		}
+	}
+
+	for _, str_q := range excludes {
+
+		err := queries.Set(str_q)
+
+		if err != nil {
+			return "", fmt.Errorf("Invalid filter query '%s', %v", str_q, err)
+		}
+	}
+
+	u, err := url.Parse(iterator_uri)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse -%s flag, %v", spatial_flags.ITERATOR_URI, err)
+	}
+
+	params := u.Query()
+
+	if len(includes) > 0 {
+
+		mode := params.Get("include_mode")
+
+		if mode != "" && mode != query.QUERYSET_MODE_ALL {
+			return "", fmt.Errorf("Filter flags can not be combined with include_mode=%s in the -%s flag", mode, spatial_flags.ITERATOR_URI)
+		}
+
+		for _, q := range includes {
+			params.Add("include", q)
+		}
+	}
+
+	if len(excludes) > 0 {
+
+		mode := params.Get("exclude_mode")
+
+		if mode != "" && mode != query.QUERYSET_MODE_ANY {
+			return "", fmt.Errorf("Filter flags can not be combined with exclude_mode=%s in the -%s flag", mode, spatial_flags.ITERATOR_URI)
+		}
+
+		// The iterator defaults to "ALL" mode so setting "ANY" mode would change the meaning of any
+		// existing exclude parameters
+
+		if mode == "" && len(params["exclude"]) > 0 {
+			return "", fmt.Errorf("Filter flags can not be combined with exclude parameters in the -%s flag unless exclude_mode=%s", spatial_flags.ITERATOR_URI, query.QUERYSET_MODE_ANY)
+		}
+
+		params.Set("exclude_mode", query.QUERYSET_MODE_ANY)
+
+		for _, q := range excludes {
+			params.Add("exclude", q)
+		}
+	}
+
+	// url.URL.String drops the "//" from URIs without a host, like "repo://", so append the
+	// parameters to the original URI instead
+
+	base := strings.SplitN(iterator_uri, "?", 2)[0]
+	return fmt.Sprintf("%s?%s", base, params.Encode()), nil
+}
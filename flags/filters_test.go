@@ -0,0 +1,168 @@
+package flags
+
+import (
+	"flag"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIteratorURIWithFlagSet(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "no filters",
+			args:     []string{"-iterator-uri", "directory://"},
+			expected: "directory://",
+		},
+		{
+			name:     "is current",
+			args:     []string{"-index-is-current", "1", "-index-is-current", "-1"},
+			expected: "repo://?include=properties.mz%3Ais_current%3D%5E%281%7C-1%29%24",
+		},
+		{
+			name:     "placetypes",
+			args:     []string{"-index-placetype", "locality", "-index-placetype", "custom.pt"},
+			expected: "repo://?include=properties.wof%3Aplacetype%3D%5E%28locality%7Ccustom%5C.pt%29%24",
+		},
+		{
+			name:     "deprecated",
+			args:     []string{"-index-exclude-deprecated"},
+			expected: "repo://?exclude=properties.edtf%3Adeprecated%3D%5E%5B0-9%5D&exclude_mode=ANY",
+		},
+		{
+			name:     "includes and excludes",
+			args:     []string{"-index-include", "properties.wof:country=CA", "-index-exclude", "properties.wof:name=Foo", "-index-is-current", "1"},
+			expected: "repo://?exclude=properties.wof%3Aname%3DFoo&exclude_mode=ANY&include=properties.wof%3Acountry%3DCA&include=properties.mz%3Ais_current%3D%5E%281%29%24",
+		},
+		{
+			name:     "existing include",
+			args:     []string{"-iterator-uri", "repo://?include=properties.wof:country=CA", "-index-placetype", "region"},
+			expected: "repo://?include=properties.wof%3Acountry%3DCA&include=properties.wof%3Aplacetype%3D%5E%28region%29%24",
+		},
+		{
+			name:     "existing include mode",
+			args:     []string{"-iterator-uri", "repo://?include_mode=ALL", "-index-placetype", "region"},
+			expected: "repo://?include=properties.wof%3Aplacetype%3D%5E%28region%29%24&include_mode=ALL",
+		},
+		{
+			name:     "existing exclude with mode",
+			args:     []string{"-iterator-uri", "repo://?exclude=properties.wof:name=Foo&exclude_mode=ANY", "-index-exclude-deprecated"},
+			expected: "repo://?exclude=properties.wof%3Aname%3DFoo&exclude=properties.edtf%3Adeprecated%3D%5E%5B0-9%5D&exclude_mode=ANY",
+		},
+		{
+			name:     "existing exclude without filters",
+			args:     []string{"-iterator-uri", "repo://?exclude=properties.wof:name=Foo"},
+			expected: "repo://?exclude=properties.wof:name=Foo",
+		},
+	}
+
+	for _, test := range tests {
+
+		fs, err := newFilterFlagSet(test.args)
+
+		if err != nil {
+			t.Fatalf("%s: failed to parse flags, %v", test.name, err)
+		}
+
+		uri, err := IteratorURIWithFlagSet(fs)
+
+		if err != nil {
+			t.Fatalf("%s: failed to derive iterator URI, %v", test.name, err)
+		}
+
+		if uri != test.expected {
+			t.Fatalf("%s: expected %s but got %s", test.name, test.expected, uri)
+		}
+
+		// Make sure the queries survive being decoded by the iterator
+
+		u, err := url.Parse(uri)
+
+		if err != nil {
+			t.Fatalf("%s: failed to parse %s, %v", test.name, uri, err)
+		}
+
+		for _, q := range append(u.Query()["include"], u.Query()["exclude"]...) {
+
+			if !strings.HasPrefix(q, "properties.") {
+				t.Fatalf("%s: unexpected query '%s'", test.name, q)
+			}
+		}
+	}
+}
+
+func TestIteratorURIWithFlagSetInvalid(t *testing.T) {
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "invalid is current",
+			args: []string{"-index-is-current", "2"},
+		},
+		{
+			name: "invalid query",
+			args: []string{"-index-include", "properties.wof:name"},
+		},
+		{
+			name: "include mode conflict",
+			args: []string{"-iterator-uri", "repo://?include_mode=ANY", "-index-is-current", "1"},
+		},
+		{
+			name: "exclude mode conflict",
+			args: []string{"-iterator-uri", "repo://?exclude_mode=ALL", "-index-exclude-deprecated"},
+		},
+		{
+			name: "existing exclude without mode",
+			args: []string{"-iterator-uri", "repo://?exclude=properties.wof:name=Foo", "-index-exclude", "properties.wof:name=Bar"},
+		},
+	}
+
+	for _, test := range tests {
+
+		fs, err := newFilterFlagSet(test.args)
+
+		if err != nil {
+			t.Fatalf("%s: failed to parse flags, %v", test.name, err)
+		}
+
+		_, err = IteratorURIWithFlagSet(fs)
+
+		if err == nil {
+			t.Fatalf("%s: expected deriving iterator URI to fail", test.name)
+		}
+
+		err = ValidateFilterFlags(fs)
+
+		if err == nil {
+			t.Fatalf("%s: expected validating flags to fail", test.name)
+		}
+	}
+}
+
+func newFilterFlagSet(args []string) (*flag.FlagSet, error) {
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String(spatial_flags.ITERATOR_URI, "repo://", "")
+
+	err := AppendFilterFlags(fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.Parse(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
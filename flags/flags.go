@@ -0,0 +1,45 @@
+package flags
+
+const ENABLE_ADMIN string = "enable-admin"
+
+const ADMIN_TOKEN string = "admin-token"
+
+const PATH_ADMIN string = "path-admin"
+
+const INDEX_ERROR_POLICY string = "index-error-policy"
+
+const INDEX_MAX_ERRORS string = "index-max-errors"
+
+const INDEX_ERROR_REPORT string = "index-error-report"
+
+const WATCH string = "watch"
+
+const WATCH_INTERVAL string = "watch-interval"
+
+const INDEX_SNAPSHOT string = "index-snapshot"
+
+const INDEX_INCLUDE string = "index-include"
+
+const INDEX_EXCLUDE string = "index-exclude"
+
+const INDEX_IS_CURRENT string = "index-is-current"
+
+const INDEX_PLACETYPES string = "index-placetype"
+
+const INDEX_EXCLUDE_DEPRECATED string = "index-exclude-deprecated"
+
+const PROPERTY_MAPPING string = "property-mapping"
+
+const PROPERTY_MAPPING_ID string = "property-mapping-id"
+
+const PROPERTY_MAPPING_NAME string = "property-mapping-name"
+
+const PROPERTY_MAPPING_PLACETYPE string = "property-mapping-placetype"
+
+const PROPERTY_MAPPING_INCEPTION string = "property-mapping-inception"
+
+const PROPERTY_MAPPING_CESSATION string = "property-mapping-cessation"
+
+const PROPERTY_MAPPING_COUNTRY string = "property-mapping-country"
+
+const PROPERTY_MAPPING_REPO string = "property-mapping-repo"
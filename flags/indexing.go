@@ -0,0 +1,125 @@
+package flags
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/lookup"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"net/url"
+)
+
+func AppendIndexingFlags(fs *flag.FlagSet) error {
+
+	err := AppendIndexingErrorFlags(fs)
+
+	if err != nil {
+		return err
+	}
+
+	fs.Bool(WATCH, false, "Watch the paths being indexed for GeoJSON files that are added, modified or deleted and apply those changes to the spatial database. Only supported for directory:// and repo:// iterators.")
+	fs.Int(WATCH_INTERVAL, 10, "The number of seconds to wait between checking the paths being watched for changes.")
+
+	fs.String(INDEX_SNAPSHOT, "", "An optional path where a copy of an in-memory (sqlite://?dsn=:memory:) spatial database will be written once the paths being indexed at startup have been indexed. If the copy is newer than the files being indexed, and was indexed with the same options, it will be used instead of indexing those files the next time the server starts.")
+
+	return nil
+}
+
+// AppendIndexingErrorFlags appends the flags for handling documents that fail to be indexed to 'fs'. They are
+// included in the flags appended by AppendIndexingFlags.
+func AppendIndexingErrorFlags(fs *flag.FlagSet) error {
+
+	fs.String(INDEX_ERROR_POLICY, "fail-fast", "How to handle documents that fail to be indexed. Valid options are: fail-fast (stop indexing), skip (log the error and continue).")
+
+	max_desc := fmt.Sprintf("The maximum number of documents that may fail to be indexed before indexing is stopped. Only applies when -%s is 'skip'. If 0 there is no limit.", INDEX_ERROR_POLICY)
+	fs.Int64(INDEX_MAX_ERRORS, 0, max_desc)
+
+	fs.String(INDEX_ERROR_REPORT, "", "An optional path where a JSON-encoded report of the documents that failed to be indexed will be written when indexing finishes.")
+
+	return nil
+}
+
+func ValidateIndexingFlags(fs *flag.FlagSet) error {
+
+	err := ValidateIndexingErrorFlags(fs)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = lookup.BoolVar(fs, WATCH)
+
+	if err != nil {
+		return err
+	}
+
+	interval, err := lookup.IntVar(fs, WATCH_INTERVAL)
+
+	if err != nil {
+		return err
+	}
+
+	if interval < 1 {
+		return fmt.Errorf("Invalid -%s flag", WATCH_INTERVAL)
+	}
+
+	snapshot, err := lookup.StringVar(fs, INDEX_SNAPSHOT)
+
+	if err != nil {
+		return err
+	}
+
+	if snapshot != "" {
+
+		database_uri, err := lookup.StringVar(fs, spatial_flags.SPATIAL_DATABASE_URI)
+
+		if err != nil {
+			return err
+		}
+
+		u, err := url.Parse(database_uri)
+
+		if err != nil {
+			return fmt.Errorf("Invalid -%s flag, %v", spatial_flags.SPATIAL_DATABASE_URI, err)
+		}
+
+		if u.Scheme != "sqlite" || u.Query().Get("dsn") != ":memory:" {
+			return fmt.Errorf("The -%s flag requires a sqlite://?dsn=:memory: spatial database", INDEX_SNAPSHOT)
+		}
+	}
+
+	return nil
+}
+
+func ValidateIndexingErrorFlags(fs *flag.FlagSet) error {
+
+	policy, err := lookup.StringVar(fs, INDEX_ERROR_POLICY)
+
+	if err != nil {
+		return err
+	}
+
+	switch policy {
+	case "fail-fast", "skip":
+		// pass
+	default:
+		return fmt.Errorf("Invalid -%s flag", INDEX_ERROR_POLICY)
+	}
+
+	max_errors, err := lookup.Int64Var(fs, INDEX_MAX_ERRORS)
+
+	if err != nil {
+		return err
+	}
+
+	if max_errors < 0 {
+		return fmt.Errorf("Invalid -%s flag", INDEX_MAX_ERRORS)
+	}
+
+	_, err = lookup.StringVar(fs, INDEX_ERROR_REPORT)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package flags
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/lookup"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"os"
+)
+
+func AppendPropertyMappingFlags(fs *flag.FlagSet) error {
+
+	fs.String(PROPERTY_MAPPING, "", fmt.Sprintf("The path to a JSON file mapping \"plain old\" GeoJSON properties on to SPR properties. Only applies when -%s is false.", spatial_flags.IS_WOF))
+
+	fs.String(PROPERTY_MAPPING_ID, "", "The tidwall/gjson path of the property to use as a feature's (integer) ID.")
+	fs.String(PROPERTY_MAPPING_NAME, "", "The tidwall/gjson path of the property to use as a feature's name.")
+	fs.String(PROPERTY_MAPPING_PLACETYPE, "", "The tidwall/gjson path of the property to use as a feature's placetype.")
+	fs.String(PROPERTY_MAPPING_INCEPTION, "", "The tidwall/gjson path of the property to use as a feature's (EDTF) inception date.")
+	fs.String(PROPERTY_MAPPING_CESSATION, "", "The tidwall/gjson path of the property to use as a feature's (EDTF) cessation date.")
+	fs.String(PROPERTY_MAPPING_COUNTRY, "", "The tidwall/gjson path of the property to use as a feature's country code.")
+	fs.String(PROPERTY_MAPPING_REPO, "", "The tidwall/gjson path of the property to use as a feature's repo.")
+
+	return nil
+}
+
+func ValidatePropertyMappingFlags(fs *flag.FlagSet) error {
+
+	is_wof, err := lookup.BoolVar(fs, spatial_flags.IS_WOF)
+
+	if err != nil {
+		return err
+	}
+
+	mapping_flags := []string{
+		PROPERTY_MAPPING,
+		PROPERTY_MAPPING_ID,
+		PROPERTY_MAPPING_NAME,
+		PROPERTY_MAPPING_PLACETYPE,
+		PROPERTY_MAPPING_INCEPTION,
+		PROPERTY_MAPPING_CESSATION,
+		PROPERTY_MAPPING_COUNTRY,
+		PROPERTY_MAPPING_REPO,
+	}
+
+	for _, k := range mapping_flags {
+
+		v, err := lookup.StringVar(fs, k)
+
+		if err != nil {
+			return err
+		}
+
+		if v == "" {
+			continue
+		}
+
+		if is_wof {
+			return fmt.Errorf("The -%s flag can only be used when -%s is false", k, spatial_flags.IS_WOF)
+		}
+
+		if k == PROPERTY_MAPPING {
+
+			_, err := os.Stat(v)
+
+			if err != nil {
+				return fmt.Errorf("Invalid -%s flag, %v", k, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package flags
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/whosonfirst/go-reader"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"net/url"
+	"strings"
+)
+
+// AppendCustomPlacetypesFlags appends the -custom-placetypes-source flag, which is defined but not enabled
+// by the go-whosonfirst-spatial/flags package, to 'fs'.
+func AppendCustomPlacetypesFlags(fs *flag.FlagSet) error {
+
+	available_readers := reader.Schemes()
+	desc_readers := fmt.Sprintf("A valid whosonfirst/go-reader.Reader URI, followed by a '#{KEY}' fragment identifying the document to read, for custom placetypes defined using the syntax described in the whosonfirst/go-whosonfirst-placetypes repository. If the URI uses the file:// scheme and has no fragment then the URI's path is read. Available options are: %s", strings.Join(available_readers, ", "))
+
+	fs.String(spatial_flags.CUSTOM_PLACETYPES_SOURCE, "", desc_readers)
+	return nil
+}
+
+func ValidateCustomPlacetypesFlags(fs *flag.FlagSet) error {
+
+	source, err := lookup.StringVar(fs, spatial_flags.CUSTOM_PLACETYPES_SOURCE)
+
+	if err != nil {
+		return err
+	}
+
+	if source == "" {
+		return nil
+	}
+
+	enabled, err := lookup.BoolVar(fs, spatial_flags.ENABLE_CUSTOM_PLACETYPES)
+
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		return fmt.Errorf("The -%s flag requires the -%s flag", spatial_flags.CUSTOM_PLACETYPES_SOURCE, spatial_flags.ENABLE_CUSTOM_PLACETYPES)
+	}
+
+	custom_placetypes, err := lookup.StringVar(fs, spatial_flags.CUSTOM_PLACETYPES)
+
+	if err != nil {
+		return err
+	}
+
+	if custom_placetypes != "" {
+		return fmt.Errorf("The -%s and -%s flags can not be used together", spatial_flags.CUSTOM_PLACETYPES_SOURCE, spatial_flags.CUSTOM_PLACETYPES)
+	}
+
+	_, err = url.Parse(source)
+
+	if err != nil {
+		return fmt.Errorf("Invalid -%s flag, %v", spatial_flags.CUSTOM_PLACETYPES_SOURCE, err)
+	}
+
+	return nil
+}
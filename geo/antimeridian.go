@@ -0,0 +1,154 @@
+package geo
+
+import (
+	"github.com/skelterjohn/geom"
+	"math"
+)
+
+// PolygonCrossesAntimeridian returns true if any of the rings in 'poly' contain consecutive vertices that
+// are more than 180 degrees of longitude apart, which is taken to mean the ring crosses the antimeridian
+// rather than the entire globe. Edges whose vertices both have a longitude of -180 or 180, like those of a
+// polygon that runs along the edges of the map, do not cross the antimeridian. Since a polygon that crosses
+// the antimeridian becomes narrower when it is unwrapped, polygons that don't are not considered to cross it.
+func PolygonCrossesAntimeridian(poly [][][]float64) bool {
+
+	if len(poly) == 0 {
+		return false
+	}
+
+	crosses := false
+
+	for _, ring := range poly {
+
+		for i := 1; i < len(ring); i++ {
+
+			if isAntimeridian(ring[i][0]) && isAntimeridian(ring[i-1][0]) {
+				continue
+			}
+
+			if math.Abs(ring[i][0]-ring[i-1][0]) > 180.0 {
+				crosses = true
+				break
+			}
+		}
+
+		if crosses {
+			break
+		}
+	}
+
+	if !crosses {
+		return false
+	}
+
+	unwrapped := UnwrapPolygon(poly[:1])
+
+	return longitudeSpan(unwrapped[0]) < longitudeSpan(poly[0])
+}
+
+func isAntimeridian(x float64) bool {
+	return x == -180.0 || x == 180.0
+}
+
+// longitudeSpan returns the difference between the largest and smallest longitudes in 'ring'.
+func longitudeSpan(ring [][]float64) float64 {
+
+	if len(ring) == 0 {
+		return 0.0
+	}
+
+	min_x := ring[0][0]
+	max_x := ring[0][0]
+
+	for _, pt := range ring[1:] {
+		min_x = math.Min(min_x, pt[0])
+		max_x = math.Max(max_x, pt[0])
+	}
+
+	return max_x - min_x
+}
+
+// UnwrapPolygon returns a copy of 'poly' with 360 added to every negative longitude so that a polygon
+// crossing the antimeridian becomes continuous, with longitudes between 0 and 360.
+func UnwrapPolygon(poly [][][]float64) [][][]float64 {
+
+	unwrapped := make([][][]float64, len(poly))
+
+	for i, ring := range poly {
+
+		unwrapped[i] = make([][]float64, len(ring))
+
+		for j, pt := range ring {
+
+			x := pt[0]
+
+			if x < 0.0 {
+				x = x + 360.0
+			}
+
+			unwrapped[i][j] = []float64{x, pt[1]}
+		}
+	}
+
+	return unwrapped
+}
+
+// ShiftPolygon returns a copy of 'poly' with 'dx' added to every longitude.
+func ShiftPolygon(poly [][][]float64, dx float64) [][][]float64 {
+
+	shifted := make([][][]float64, len(poly))
+
+	for i, ring := range poly {
+
+		shifted[i] = make([][]float64, len(ring))
+
+		for j, pt := range ring {
+			shifted[i][j] = []float64{pt[0] + dx, pt[1]}
+		}
+	}
+
+	return shifted
+}
+
+// SplitAntimeridian returns 'poly' unchanged if it does not cross the antimeridian. Otherwise it returns
+// two copies of 'poly', both continuous across the antimeridian: one with longitudes between 0 and 360
+// and the other with longitudes between -360 and 0. The copies are not clipped at the antimeridian, so
+// that distances to their edges are the distances to the edges of 'poly', which means each of them also
+// extends beyond -180 or 180.
+func SplitAntimeridian(poly [][][]float64) [][][][]float64 {
+
+	if !PolygonCrossesAntimeridian(poly) {
+		return [][][][]float64{poly}
+	}
+
+	unwrapped := UnwrapPolygon(poly)
+	shifted := ShiftPolygon(unwrapped, -360.0)
+
+	return [][][][]float64{unwrapped, shifted}
+}
+
+// PolygonBounds returns the bounding box for the exterior ring of 'poly'.
+func PolygonBounds(poly [][][]float64) *geom.Rect {
+
+	rect := &geom.Rect{
+		Min: geom.Coord{X: math.Inf(1), Y: math.Inf(1)},
+		Max: geom.Coord{X: math.Inf(-1), Y: math.Inf(-1)},
+	}
+
+	if len(poly) == 0 {
+		return rect
+	}
+
+	for _, pt := range poly[0] {
+		rect.ExpandToContainCoord(geom.Coord{X: pt[0], Y: pt[1]})
+	}
+
+	return rect
+}
+
+// PolygonContainsCoord returns true if 'poly' contains 'c'. Unlike the method of the same name in the
+// go-whosonfirst-spatial/geo package polygons that cross the antimeridian are unwrapped before testing
+// containment.
+func PolygonContainsCoord(poly [][][]float64, c *geom.Coord) bool {
+	return NewPreparedPolygon(poly).ContainsCoord(c)
+}
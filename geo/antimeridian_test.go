@@ -0,0 +1,58 @@
+package geo
+
+import (
+	"github.com/skelterjohn/geom"
+	"testing"
+)
+
+func TestPolygonCrossesAntimeridian(t *testing.T) {
+
+	tests := map[string]struct {
+		poly    [][][]float64
+		crosses bool
+	}{
+		"square": {
+			poly:    [][][]float64{{{10, 10}, {20, 10}, {20, 20}, {10, 20}, {10, 10}}},
+			crosses: false,
+		},
+		"crossing": {
+			poly:    [][][]float64{{{170, -10}, {-170, -10}, {-170, 10}, {170, 10}, {170, -10}}},
+			crosses: true,
+		},
+		"edges": {
+			poly:    [][][]float64{{{-180, -90}, {-180, -65}, {-60, -65}, {60, -65}, {180, -65}, {180, -90}, {-180, -90}}},
+			crosses: false,
+		},
+		"wide": {
+			poly:    [][][]float64{{{-170, -10}, {10, -10}, {170, -10}, {170, 10}, {10, 10}, {-170, 10}, {-170, -10}}},
+			crosses: false,
+		},
+	}
+
+	for name, test := range tests {
+
+		if PolygonCrossesAntimeridian(test.poly) != test.crosses {
+			t.Fatalf("Expected PolygonCrossesAntimeridian to return %t for %s polygon", test.crosses, name)
+		}
+	}
+}
+
+func TestSplitAntimeridianEdges(t *testing.T) {
+
+	poly := [][][]float64{{{-180, -90}, {-180, -65}, {-120, -65}, {-60, -65}, {0, -65}, {60, -65}, {120, -65}, {180, -65}, {180, -90}, {-180, -90}}}
+
+	parts := SplitAntimeridian(poly)
+
+	if len(parts) != 1 {
+		t.Fatalf("Expected 1 part but got %d", len(parts))
+	}
+
+	for _, x := range []float64{-120, -60, 60, 120} {
+
+		c := &geom.Coord{X: x, Y: -80}
+
+		if !NewPreparedPolygon(parts[0]).ContainsCoord(c) {
+			t.Fatalf("Expected polygon to contain %v", c)
+		}
+	}
+}
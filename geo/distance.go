@@ -0,0 +1,124 @@
+// Package geo provides geodesic helper methods that complement those in the go-whosonfirst-spatial/geo package.
+package geo
+
+import (
+	"github.com/skelterjohn/geom"
+	"math"
+)
+
+// The mean radius of the Earth, in metres.
+const EARTH_RADIUS float64 = 6371008.8
+
+// The distance, in metres, of half the Earth's circumference.
+const MAX_DISTANCE float64 = math.Pi * EARTH_RADIUS
+
+// Haversine returns the great-circle distance, in metres, between 'a' and 'b'. Coordinates are expected
+// to be in (longitude, latitude) order.
+func Haversine(a *geom.Coord, b *geom.Coord) float64 {
+
+	lat1 := toRadians(a.Y)
+	lat2 := toRadians(b.Y)
+
+	dlat := toRadians(b.Y - a.Y)
+	dlon := toRadians(b.X - a.X)
+
+	h := math.Pow(math.Sin(dlat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dlon/2), 2)
+	h = math.Min(1.0, h)
+
+	return 2 * EARTH_RADIUS * math.Asin(math.Sqrt(h))
+}
+
+// BoundingBoxesForRadius returns the bounding box(es) that contain a circle of 'radius' metres centered
+// on 'c'. If the circle crosses the antimeridian two bounding boxes, one on either side of it, are returned.
+func BoundingBoxesForRadius(c *geom.Coord, radius float64) []*geom.Rect {
+
+	if radius >= MAX_DISTANCE {
+
+		world := &geom.Rect{
+			Min: geom.Coord{X: -180.0, Y: -90.0},
+			Max: geom.Coord{X: 180.0, Y: 90.0},
+		}
+
+		return []*geom.Rect{world}
+	}
+
+	dlat := toDegrees(radius / EARTH_RADIUS)
+
+	min_y := c.Y - dlat
+	max_y := c.Y + dlat
+
+	// If the circle contains either pole then it spans every longitude
+
+	if min_y <= -90.0 || max_y >= 90.0 {
+
+		rect := &geom.Rect{
+			Min: geom.Coord{X: -180.0, Y: math.Max(min_y, -90.0)},
+			Max: geom.Coord{X: 180.0, Y: math.Min(max_y, 90.0)},
+		}
+
+		return []*geom.Rect{rect}
+	}
+
+	// https://www.movable-type.co.uk/scripts/latlong-db.html
+
+	dlon := toDegrees(math.Asin(math.Sin(radius/EARTH_RADIUS) / math.Cos(toRadians(c.Y))))
+
+	min_x := c.X - dlon
+	max_x := c.X + dlon
+
+	switch {
+	case dlon >= 180.0:
+
+		rect := &geom.Rect{
+			Min: geom.Coord{X: -180.0, Y: min_y},
+			Max: geom.Coord{X: 180.0, Y: max_y},
+		}
+
+		return []*geom.Rect{rect}
+
+	case min_x < -180.0:
+
+		west := &geom.Rect{
+			Min: geom.Coord{X: min_x + 360.0, Y: min_y},
+			Max: geom.Coord{X: 180.0, Y: max_y},
+		}
+
+		east := &geom.Rect{
+			Min: geom.Coord{X: -180.0, Y: min_y},
+			Max: geom.Coord{X: max_x, Y: max_y},
+		}
+
+		return []*geom.Rect{west, east}
+
+	case max_x > 180.0:
+
+		west := &geom.Rect{
+			Min: geom.Coord{X: min_x, Y: min_y},
+			Max: geom.Coord{X: 180.0, Y: max_y},
+		}
+
+		east := &geom.Rect{
+			Min: geom.Coord{X: -180.0, Y: min_y},
+			Max: geom.Coord{X: max_x - 360.0, Y: max_y},
+		}
+
+		return []*geom.Rect{west, east}
+
+	default:
+
+		rect := &geom.Rect{
+			Min: geom.Coord{X: min_x, Y: min_y},
+			Max: geom.Coord{X: max_x, Y: max_y},
+		}
+
+		return []*geom.Rect{rect}
+	}
+}
+
+func toRadians(d float64) float64 {
+	return d * math.Pi / 180.0
+}
+
+func toDegrees(r float64) float64 {
+	return r * 180.0 / math.Pi
+}
@@ -0,0 +1,168 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Polygons are encoded as JSON arrays of rings, which are arrays of [x, y] coordinates.
+const GEOMETRY_FORMAT_JSON string = "json"
+
+// Polygons are encoded as a flat list of little-endian values: A one-byte format marker, a uint32 count of rings
+// and then, for each ring, a uint32 count of coordinates followed by that many pairs of float64 (x, y) values.
+const GEOMETRY_FORMAT_BINARY string = "binary"
+
+// The first byte of a binary-encoded polygon. It is distinct from the first byte of a JSON-encoded polygon ('[').
+const binary_marker byte = 0x01
+
+// IsValidGeometryFormat returns true if 'format' is a known polygon encoding.
+func IsValidGeometryFormat(format string) bool {
+
+	switch format {
+	case GEOMETRY_FORMAT_JSON, GEOMETRY_FORMAT_BINARY:
+		return true
+	default:
+		return false
+	}
+}
+
+// EncodePolygon encodes 'poly' using 'format'.
+func EncodePolygon(poly [][][]float64, format string) ([]byte, error) {
+
+	switch format {
+	case GEOMETRY_FORMAT_JSON:
+		return json.Marshal(poly)
+	case GEOMETRY_FORMAT_BINARY:
+		return encodePolygonBinary(poly), nil
+	default:
+		return nil, fmt.Errorf("Invalid geometry format '%s'", format)
+	}
+}
+
+// GeometryFormat returns the format that 'body' was encoded with, derived from its first byte.
+func GeometryFormat(body []byte) string {
+
+	if len(body) > 0 && body[0] == binary_marker {
+		return GEOMETRY_FORMAT_BINARY
+	}
+
+	return GEOMETRY_FORMAT_JSON
+}
+
+// DecodePolygon decodes a polygon encoded using any of the known formats. The format is derived from
+// the first byte of 'body'.
+func DecodePolygon(body []byte) ([][][]float64, error) {
+
+	if len(body) == 0 {
+		return nil, errors.New("Empty geometry")
+	}
+
+	switch body[0] {
+	case binary_marker:
+		return decodePolygonBinary(body)
+	default:
+
+		var poly [][][]float64
+
+		err := json.Unmarshal(body, &poly)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return poly, nil
+	}
+}
+
+func encodePolygonBinary(poly [][][]float64) []byte {
+
+	size := 1 + 4
+
+	for _, ring := range poly {
+		size += 4 + (len(ring) * 16)
+	}
+
+	buf := make([]byte, size)
+	buf[0] = binary_marker
+
+	offset := 1
+
+	binary.LittleEndian.PutUint32(buf[offset:], uint32(len(poly)))
+	offset += 4
+
+	for _, ring := range poly {
+
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(len(ring)))
+		offset += 4
+
+		for _, pt := range ring {
+			binary.LittleEndian.PutUint64(buf[offset:], math.Float64bits(pt[0]))
+			binary.LittleEndian.PutUint64(buf[offset+8:], math.Float64bits(pt[1]))
+			offset += 16
+		}
+	}
+
+	return buf
+}
+
+func decodePolygonBinary(body []byte) ([][][]float64, error) {
+
+	if !bytes.HasPrefix(body, []byte{binary_marker}) || len(body) < 5 {
+		return nil, errors.New("Invalid binary geometry")
+	}
+
+	offset := 1
+
+	count_rings := int(binary.LittleEndian.Uint32(body[offset:]))
+	offset += 4
+
+	// The counts come from the encoded bytes, which may be corrupt, so make sure they
+	// could actually fit in 'body' before allocating anything based on them
+
+	if count_rings > (len(body)-offset)/4 {
+		return nil, errors.New("Invalid binary geometry, truncated rings")
+	}
+
+	poly := make([][][]float64, count_rings)
+
+	for i := 0; i < count_rings; i++ {
+
+		if len(body) < offset+4 {
+			return nil, errors.New("Invalid binary geometry, truncated ring")
+		}
+
+		count_points := int(binary.LittleEndian.Uint32(body[offset:]))
+		offset += 4
+
+		if count_points > (len(body)-offset)/16 {
+			return nil, errors.New("Invalid binary geometry, truncated coordinates")
+		}
+
+		// Allocate all the coordinates for a ring at once rather than
+		// one slice per coordinate
+
+		flat := make([]float64, count_points*2)
+		ring := make([][]float64, count_points)
+
+		for j := 0; j < count_points; j++ {
+
+			flat[j*2] = math.Float64frombits(binary.LittleEndian.Uint64(body[offset:]))
+			flat[j*2+1] = math.Float64frombits(binary.LittleEndian.Uint64(body[offset+8:]))
+			offset += 16
+
+			ring[j] = flat[j*2 : j*2+2 : j*2+2]
+		}
+
+		poly[i] = ring
+	}
+
+	if offset != len(body) {
+		return nil, errors.New("Invalid binary geometry, trailing bytes")
+	}
+
+	return poly, nil
+}
@@ -0,0 +1,138 @@
+package geo
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// testPolygon returns a polygon with an exterior ring of 'count' points, approximating a circle, and a
+// smaller interior ring.
+func testPolygon(count int) [][][]float64 {
+
+	exterior := make([][]float64, count+1)
+	interior := make([][]float64, 5)
+
+	for i := 0; i < count; i++ {
+		a := 2 * math.Pi * float64(i) / float64(count)
+		exterior[i] = []float64{10.0 * math.Cos(a), 10.0 * math.Sin(a)}
+	}
+
+	exterior[count] = exterior[0]
+
+	for i, pt := range [][]float64{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}, {-1, -1}} {
+		interior[i] = pt
+	}
+
+	return [][][]float64{exterior, interior}
+}
+
+func TestDecodePolygon(t *testing.T) {
+
+	poly := testPolygon(100)
+
+	for _, format := range []string{GEOMETRY_FORMAT_JSON, GEOMETRY_FORMAT_BINARY} {
+
+		body, err := EncodePolygon(poly, format)
+
+		if err != nil {
+			t.Fatalf("Failed to encode %s polygon, %v", format, err)
+		}
+
+		if GeometryFormat(body) != format {
+			t.Fatalf("Expected %s geometry format but got %s", format, GeometryFormat(body))
+		}
+
+		decoded, err := DecodePolygon(body)
+
+		if err != nil {
+			t.Fatalf("Failed to decode %s polygon, %v", format, err)
+		}
+
+		if len(decoded) != len(poly) {
+			t.Fatalf("Expected %d rings from %s polygon but got %d", len(poly), format, len(decoded))
+		}
+
+		for i, ring := range poly {
+
+			if len(decoded[i]) != len(ring) {
+				t.Fatalf("Expected %d points in %s ring %d but got %d", len(ring), format, i, len(decoded[i]))
+			}
+
+			for j, pt := range ring {
+
+				if decoded[i][j][0] != pt[0] || decoded[i][j][1] != pt[1] {
+					t.Fatalf("Unexpected point %d in %s ring %d, %v", j, format, i, decoded[i][j])
+				}
+			}
+		}
+	}
+}
+
+func TestDecodePolygonBinaryInvalid(t *testing.T) {
+
+	body, err := EncodePolygon(testPolygon(10), GEOMETRY_FORMAT_BINARY)
+
+	if err != nil {
+		t.Fatalf("Failed to encode polygon, %v", err)
+	}
+
+	// A ring count that claims far more rings than there are bytes
+
+	corrupt_rings := append([]byte{}, body...)
+	binary.LittleEndian.PutUint32(corrupt_rings[1:], math.MaxUint32)
+
+	// A point count, for the first ring, that claims far more points than there are bytes
+
+	corrupt_points := append([]byte{}, body...)
+	binary.LittleEndian.PutUint32(corrupt_points[5:], math.MaxUint32)
+
+	tests := map[string][]byte{
+		"marker only":      body[:1],
+		"truncated count":  body[:3],
+		"no rings":         body[:5],
+		"truncated ring":   body[:7],
+		"truncated points": body[:len(body)-1],
+		"trailing bytes":   append(append([]byte{}, body...), 0x00),
+		"corrupt rings":    corrupt_rings,
+		"corrupt points":   corrupt_points,
+	}
+
+	for label, b := range tests {
+
+		_, err := DecodePolygon(b)
+
+		if err == nil {
+			t.Fatalf("Expected an error decoding %s geometry", label)
+		}
+	}
+}
+
+func benchmarkDecodePolygon(b *testing.B, format string) {
+
+	body, err := EncodePolygon(testPolygon(1000), format)
+
+	if err != nil {
+		b.Fatalf("Failed to encode %s polygon, %v", format, err)
+	}
+
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		_, err := DecodePolygon(body)
+
+		if err != nil {
+			b.Fatalf("Failed to decode %s polygon, %v", format, err)
+		}
+	}
+}
+
+func BenchmarkDecodePolygonJSON(b *testing.B) {
+	benchmarkDecodePolygon(b, GEOMETRY_FORMAT_JSON)
+}
+
+func BenchmarkDecodePolygonBinary(b *testing.B) {
+	benchmarkDecodePolygon(b, GEOMETRY_FORMAT_BINARY)
+}
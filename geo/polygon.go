@@ -0,0 +1,97 @@
+package geo
+
+import (
+	"github.com/skelterjohn/geom"
+	"math"
+)
+
+// DistanceToPolygon returns the shortest distance, in metres, between 'c' and the boundary of 'poly'. If
+// 'c' is contained by 'poly' then the distance is 0.
+func DistanceToPolygon(poly [][][]float64, c *geom.Coord) float64 {
+
+	if PolygonContainsCoord(poly, c) {
+		return 0.0
+	}
+
+	return DistanceToBoundary(poly, c)
+}
+
+// DistanceToBoundary returns the shortest distance, in metres, between 'c' and any of the (exterior or interior)
+// rings of 'poly', irrespective of whether 'c' is contained by 'poly'.
+func DistanceToBoundary(poly [][][]float64, c *geom.Coord) float64 {
+
+	distance := math.Inf(1)
+
+	for _, ring := range poly {
+		distance = math.Min(distance, DistanceToRing(ring, c))
+	}
+
+	return distance
+}
+
+// DistanceToRing returns the shortest distance, in metres, between 'c' and any of the segments in 'ring'.
+func DistanceToRing(ring [][]float64, c *geom.Coord) float64 {
+
+	distance := math.Inf(1)
+	count := len(ring)
+
+	if count == 1 {
+		pt := &geom.Coord{X: ring[0][0], Y: ring[0][1]}
+		return Haversine(c, pt)
+	}
+
+	for i := 1; i < count; i++ {
+
+		a := &geom.Coord{X: ring[i-1][0], Y: ring[i-1][1]}
+		b := &geom.Coord{X: ring[i][0], Y: ring[i][1]}
+
+		distance = math.Min(distance, DistanceToSegment(a, b, c))
+	}
+
+	return distance
+}
+
+// DistanceToSegment returns the shortest distance, in metres, between 'c' and the great-circle segment
+// from 'a' to 'b'.
+func DistanceToSegment(a *geom.Coord, b *geom.Coord, c *geom.Coord) float64 {
+
+	// https://www.movable-type.co.uk/scripts/latlong.html#cross-track
+
+	d_ab := Haversine(a, b)
+
+	if d_ab == 0.0 {
+		return Haversine(a, c)
+	}
+
+	d_ac := Haversine(a, c)
+	delta := bearing(a, c) - bearing(a, b)
+
+	// The closest point on the great circle is behind 'a'
+
+	if math.Cos(delta) <= 0.0 {
+		return d_ac
+	}
+
+	xt := math.Asin(math.Sin(d_ac/EARTH_RADIUS) * math.Sin(delta))
+	at := math.Acos(math.Max(-1.0, math.Min(1.0, math.Cos(d_ac/EARTH_RADIUS)/math.Cos(xt))))
+
+	// The closest point on the great circle is beyond 'b'
+
+	if at*EARTH_RADIUS >= d_ab {
+		return Haversine(b, c)
+	}
+
+	return math.Abs(xt) * EARTH_RADIUS
+}
+
+func bearing(a *geom.Coord, b *geom.Coord) float64 {
+
+	lat1 := toRadians(a.Y)
+	lat2 := toRadians(b.Y)
+	dlon := toRadians(b.X - a.X)
+
+	y := math.Sin(dlon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dlon)
+
+	return math.Atan2(y, x)
+}
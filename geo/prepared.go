@@ -0,0 +1,105 @@
+package geo
+
+import (
+	"github.com/skelterjohn/geom"
+)
+
+// PreparedPolygon is a polygon whose rings have been converted to geom.Polygon instances, and unwrapped if
+// they cross the antimeridian, so that it can be tested for containment repeatedly without rebuilding them.
+type PreparedPolygon struct {
+	// The original coordinates for the polygon, used for distance calculations.
+	Coordinates [][][]float64
+	rings       []*geom.Polygon
+	unwrapped   bool
+}
+
+// NewPreparedPolygon returns a new PreparedPolygon instance for 'poly'.
+func NewPreparedPolygon(poly [][][]float64) *PreparedPolygon {
+
+	unwrapped := PolygonCrossesAntimeridian(poly)
+
+	coords := poly
+
+	if unwrapped {
+		coords = UnwrapPolygon(poly)
+	}
+
+	rings := make([]*geom.Polygon, len(coords))
+
+	for i, ring := range coords {
+
+		p := &geom.Polygon{}
+
+		for _, pt := range ring {
+			p.AddVertex(geom.Coord{X: pt[0], Y: pt[1]})
+		}
+
+		rings[i] = p
+	}
+
+	p := &PreparedPolygon{
+		Coordinates: poly,
+		rings:       rings,
+		unwrapped:   unwrapped,
+	}
+
+	return p
+}
+
+// ContainsCoord returns true if 'c' is contained by the polygon's exterior ring and not by any of its
+// interior rings.
+func (p *PreparedPolygon) ContainsCoord(c *geom.Coord) bool {
+
+	if len(p.rings) == 0 {
+		return false
+	}
+
+	pt := *c
+
+	if p.unwrapped && pt.X < 0.0 {
+		pt.X = pt.X + 360.0
+	}
+
+	if !ringContainsCoord(p.rings[0], pt) {
+		return false
+	}
+
+	for _, interior_ring := range p.rings[1:] {
+
+		if ringContainsCoord(interior_ring, pt) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Size returns the approximate number of bytes of memory used by the polygon.
+func (p *PreparedPolygon) Size() int64 {
+
+	// Each vertex is stored as a geom.Coord (16 bytes) and as a []float64
+	// (a 24 byte slice header and 16 bytes of data) plus some overhead for
+	// each ring and the struct itself
+
+	size := int64(64)
+
+	for _, ring := range p.Coordinates {
+		size += 96 + int64(len(ring)*56)
+	}
+
+	return size
+}
+
+func ringContainsCoord(ring *geom.Polygon, c geom.Coord) bool {
+
+	// A coordinate outside a ring's bounding box can never be contained by it
+	// so skip the (more expensive) ray casting test
+
+	b := ring.Bounds()
+
+	if c.X < b.Min.X || c.X > b.Max.X || c.Y < b.Min.Y || c.Y > b.Max.Y {
+		return false
+	}
+
+	return ring.ContainsCoord(c)
+}
@@ -3,6 +3,36 @@ module github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite
 go 1.16
 
 require (
-	github.com/whosonfirst/go-whosonfirst-spatial-sqlite v0.0.38
+	github.com/NYTimes/gziphandler v1.1.1
+	github.com/aaronland/go-http-bootstrap v0.0.10
+	github.com/aaronland/go-http-leaflet v0.0.6
+	github.com/aaronland/go-http-ping v1.0.0
+	github.com/aaronland/go-http-sanitize v0.0.5
+	github.com/aaronland/go-http-server v0.0.5
+	github.com/aaronland/go-http-tangramjs v0.0.9
+	github.com/aaronland/go-json-query v0.0.2
+	github.com/mattn/go-sqlite3 v2.0.2+incompatible
+	github.com/patrickmn/go-cache v2.1.0+incompatible
+	github.com/rs/cors v1.7.0
+	github.com/sfomuseum/go-edtf v0.2.3
+	github.com/sfomuseum/go-flags v0.8.2
+	github.com/skelterjohn/geom v0.0.0-20180103142417-96f3e8a219c5
+	github.com/tidwall/gjson v1.7.2
+	github.com/whosonfirst/go-ioutil v0.0.1
+	github.com/whosonfirst/go-reader v0.5.0
+	github.com/whosonfirst/go-whosonfirst-crawl v0.2.1
+	github.com/whosonfirst/go-whosonfirst-geojson-v2 v0.16.3
+	github.com/whosonfirst/go-whosonfirst-iterate v1.1.0
+	github.com/whosonfirst/go-whosonfirst-log v0.1.0
+	github.com/whosonfirst/go-whosonfirst-placetypes v0.3.0
+	github.com/whosonfirst/go-whosonfirst-spatial v0.0.55
+	github.com/whosonfirst/go-whosonfirst-spatial-pip v0.0.10
 	github.com/whosonfirst/go-whosonfirst-spatial-www v0.0.30
+	github.com/whosonfirst/go-whosonfirst-spr-geojson v0.0.6
+	github.com/whosonfirst/go-whosonfirst-spr/v2 v2.0.0
+	github.com/whosonfirst/go-whosonfirst-sqlite v0.1.7
+	github.com/whosonfirst/go-whosonfirst-sqlite-features v0.8.0
+	github.com/whosonfirst/go-whosonfirst-sqlite-spr v0.0.6
+	github.com/whosonfirst/go-whosonfirst-uri v0.2.0
+	github.com/whosonfirst/warning v0.1.1
 )
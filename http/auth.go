@@ -0,0 +1,35 @@
+package http
+
+import (
+	"crypto/subtle"
+	gohttp "net/http"
+	"strings"
+)
+
+// BearerTokenHandler returns a gohttp.Handler that will only invoke 'next' if the request contains an
+// "Authorization: Bearer {TOKEN}" header matching 'token'.
+func BearerTokenHandler(next gohttp.Handler, token string) gohttp.Handler {
+
+	fn := func(rsp gohttp.ResponseWriter, req *gohttp.Request) {
+
+		auth := req.Header.Get("Authorization")
+
+		if !strings.HasPrefix(auth, "Bearer ") {
+			rsp.Header().Set("WWW-Authenticate", "Bearer")
+			gohttp.Error(rsp, "Unauthorized", gohttp.StatusUnauthorized)
+			return
+		}
+
+		req_token := strings.TrimPrefix(auth, "Bearer ")
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(req_token), []byte(token)) != 1 {
+			gohttp.Error(rsp, "Forbidden", gohttp.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(rsp, req)
+	}
+
+	h := gohttp.HandlerFunc(fn)
+	return h
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/nearby"
+	spatial_app "github.com/whosonfirst/go-whosonfirst-spatial/app"
+	gohttp "net/http"
+)
+
+type NearbyHandlerOptions struct {
+	EnableGeoJSON bool
+}
+
+// NearbyHandler returns a gohttp.Handler for querying the point features closest to a coordinate. Requests are
+// POST-ed JSON-encoded nearby.NearbyRequest instances and are otherwise handled the same way as point-in-polygon
+// API requests.
+func NearbyHandler(app *spatial_app.SpatialApplication, opts *NearbyHandlerOptions) (gohttp.Handler, error) {
+
+	fn := func(rsp gohttp.ResponseWriter, req *gohttp.Request) {
+
+		ctx := req.Context()
+
+		if req.Method != "POST" {
+			gohttp.Error(rsp, "Unsupported method", gohttp.StatusMethodNotAllowed)
+			return
+		}
+
+		if app.Iterator.IsIndexing() {
+			gohttp.Error(rsp, "Indexing records", gohttp.StatusServiceUnavailable)
+			return
+		}
+
+		var nearby_req *nearby.NearbyRequest
+
+		dec := json.NewDecoder(req.Body)
+		err := dec.Decode(&nearby_req)
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), gohttp.StatusBadRequest)
+			return
+		}
+
+		if nearby_req.Limit < 0 || nearby_req.Radius < 0 {
+			gohttp.Error(rsp, "Invalid limit or radius", gohttp.StatusBadRequest)
+			return
+		}
+
+		out, err := resultsOutputWithRequest(req, opts.EnableGeoJSON)
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), gohttp.StatusBadRequest)
+			return
+		}
+
+		nearby_rsp, err := nearby.QueryNearby(ctx, app, nearby_req)
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), queryErrorStatus(err))
+			return
+		}
+
+		writeResults(ctx, rsp, app, nearby_rsp, out)
+	}
+
+	h := gohttp.HandlerFunc(fn)
+	return h, nil
+}
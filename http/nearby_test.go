@@ -0,0 +1,124 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/whosonfirst/go-whosonfirst-iterate/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	spatial_app "github.com/whosonfirst/go-whosonfirst-spatial/app"
+	"io"
+	gohttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type nearbyHandlerTest struct {
+	name     string
+	method   string
+	body     string
+	status   int
+	expected []string
+}
+
+// The point fixtures are 1005, at (12.0, 12.0), and 1008, about 1090 metres east of it.
+var nearby_handler_tests = []*nearbyHandlerTest{
+	{name: "limit", method: "POST", body: `{"latitude": 12.0, "longitude": 12.0, "limit": 1}`, status: gohttp.StatusOK, expected: []string{"1005"}},
+	{name: "limit (both)", method: "POST", body: `{"latitude": 12.0, "longitude": 12.0, "limit": 2}`, status: gohttp.StatusOK, expected: []string{"1005", "1008"}},
+	{name: "default limit", method: "POST", body: `{"latitude": 12.0, "longitude": 12.01}`, status: gohttp.StatusOK, expected: []string{"1008", "1005"}},
+	{name: "radius", method: "POST", body: `{"latitude": 12.0, "longitude": 12.0, "radius": 500}`, status: gohttp.StatusOK, expected: []string{"1005"}},
+	{name: "radius (both)", method: "POST", body: `{"latitude": 12.0, "longitude": 12.0, "radius": 2000}`, status: gohttp.StatusOK, expected: []string{"1005", "1008"}},
+	{name: "radius (none)", method: "POST", body: `{"latitude": 0.0, "longitude": 0.0, "radius": 2000}`, status: gohttp.StatusOK, expected: []string{}},
+	{name: "filter", method: "POST", body: `{"latitude": 12.0, "longitude": 12.0, "limit": 2, "placetypes": ["region"]}`, status: gohttp.StatusOK, expected: []string{}},
+	{name: "invalid limit", method: "POST", body: `{"latitude": 12.0, "longitude": 12.0, "limit": -1}`, status: gohttp.StatusBadRequest},
+	{name: "invalid radius", method: "POST", body: `{"latitude": 12.0, "longitude": 12.0, "radius": -1}`, status: gohttp.StatusBadRequest},
+	{name: "invalid body", method: "POST", body: `{`, status: gohttp.StatusBadRequest},
+	{name: "method", method: "GET", status: gohttp.StatusMethodNotAllowed},
+}
+
+type nearbyHandlerResponse struct {
+	Places []struct {
+		Id       json.Number `json:"wof:id"`
+		Distance float64     `json:"spatial:distance"`
+	} `json:"places"`
+}
+
+func TestNearbyHandler(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	noop := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+		return nil
+	}
+
+	iter, err := iterator.NewIterator(ctx, "directory://", emitter.EmitterCallbackFunc(noop))
+
+	if err != nil {
+		t.Fatalf("Failed to create iterator, %v", err)
+	}
+
+	app := &spatial_app.SpatialApplication{
+		SpatialDatabase: db,
+		Iterator:        iter,
+	}
+
+	handler, err := NearbyHandler(app, &NearbyHandlerOptions{})
+
+	if err != nil {
+		t.Fatalf("Failed to create handler, %v", err)
+	}
+
+	for _, test := range nearby_handler_tests {
+
+		req := httptest.NewRequest(test.method, "/api/nearby", bytes.NewBufferString(test.body))
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Fatalf("%s: expected status %d but got %d (%s)", test.name, test.status, rec.Code, rec.Body.String())
+		}
+
+		if test.status != gohttp.StatusOK {
+			continue
+		}
+
+		var rsp nearbyHandlerResponse
+
+		dec := json.NewDecoder(rec.Body)
+		dec.UseNumber()
+
+		err := dec.Decode(&rsp)
+
+		if err != nil {
+			t.Fatalf("%s: failed to decode response, %v", test.name, err)
+		}
+
+		ids := make([]string, len(rsp.Places))
+		last_distance := -1.0
+
+		for i, pl := range rsp.Places {
+
+			if pl.Distance < last_distance {
+				t.Fatalf("%s: results are not sorted by distance", test.name)
+			}
+
+			last_distance = pl.Distance
+			ids[i] = pl.Id.String()
+		}
+
+		if strings.Join(ids, ",") != strings.Join(test.expected, ",") {
+			t.Fatalf("%s: expected %v but got %v", test.name, test.expected, ids)
+		}
+	}
+}
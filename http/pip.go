@@ -0,0 +1,67 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/query"
+	spatial_app "github.com/whosonfirst/go-whosonfirst-spatial/app"
+	gohttp "net/http"
+)
+
+type PointInPolygonHandlerOptions struct {
+	EnableGeoJSON bool
+}
+
+// PointInPolygonHandler returns a gohttp.Handler for point-in-polygon queries. It is a drop-in replacement for
+// the handler in the go-whosonfirst-spatial-pip/api package that accepts POST-ed JSON-encoded
+// query.PointInPolygonRequest instances, which may include an optional radius and boundary tolerance.
+func PointInPolygonHandler(app *spatial_app.SpatialApplication, opts *PointInPolygonHandlerOptions) (gohttp.Handler, error) {
+
+	fn := func(rsp gohttp.ResponseWriter, req *gohttp.Request) {
+
+		ctx := req.Context()
+
+		if req.Method != "POST" {
+			gohttp.Error(rsp, "Unsupported method", gohttp.StatusMethodNotAllowed)
+			return
+		}
+
+		if app.Iterator.IsIndexing() {
+			gohttp.Error(rsp, "Indexing records", gohttp.StatusServiceUnavailable)
+			return
+		}
+
+		var pip_req *query.PointInPolygonRequest
+
+		dec := json.NewDecoder(req.Body)
+		err := dec.Decode(&pip_req)
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), gohttp.StatusBadRequest)
+			return
+		}
+
+		if pip_req.Radius < 0 || pip_req.Tolerance < 0 {
+			gohttp.Error(rsp, "Invalid radius or tolerance", gohttp.StatusBadRequest)
+			return
+		}
+
+		out, err := resultsOutputWithRequest(req, opts.EnableGeoJSON)
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), gohttp.StatusBadRequest)
+			return
+		}
+
+		pip_rsp, err := query.QueryPointInPolygon(ctx, app, pip_req)
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), queryErrorStatus(err))
+			return
+		}
+
+		writeResults(ctx, rsp, app, pip_rsp, out)
+	}
+
+	h := gohttp.HandlerFunc(fn)
+	return h, nil
+}
@@ -0,0 +1,171 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aaronland/go-http-sanitize"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/index"
+	gohttp "net/http"
+	"strconv"
+)
+
+type ReindexHandlerOptions struct {
+	// The context used to run reindexing jobs. This is necessary because jobs will outlive the request that started them.
+	// It is passed to the spatial database's IndexFeature method so it may be used to change how features are indexed,
+	// for example by sqlite.WithIncrementalIndexing.
+	Context context.Context
+	// The URIs to index if none are included with a request.
+	URIs []string
+}
+
+type ReindexRequest struct {
+	URIs []string `json:"uris,omitempty"`
+}
+
+// ReindexHandler returns a gohttp.Handler for starting new (re)indexing jobs (POST) and reporting the
+// status of existing jobs (GET).
+func ReindexHandler(idx *index.Indexer, opts *ReindexHandlerOptions) (gohttp.Handler, error) {
+
+	fn := func(rsp gohttp.ResponseWriter, req *gohttp.Request) {
+
+		switch req.Method {
+		case "GET":
+
+			str_id, err := sanitize.GetString(req, "id")
+
+			if err != nil {
+				gohttp.Error(rsp, err.Error(), gohttp.StatusBadRequest)
+				return
+			}
+
+			if str_id == "" {
+				writeJSON(rsp, idx.Jobs(), gohttp.StatusOK)
+				return
+			}
+
+			id, err := strconv.ParseInt(str_id, 10, 64)
+
+			if err != nil {
+				gohttp.Error(rsp, "Invalid job ID", gohttp.StatusBadRequest)
+				return
+			}
+
+			job, ok := idx.Job(id)
+
+			if !ok {
+				gohttp.Error(rsp, "Job not found", gohttp.StatusNotFound)
+				return
+			}
+
+			writeJSON(rsp, job.Status(), gohttp.StatusOK)
+			return
+
+		case "POST":
+
+			var reindex_req ReindexRequest
+
+			if req.ContentLength != 0 {
+
+				dec := json.NewDecoder(req.Body)
+				err := dec.Decode(&reindex_req)
+
+				if err != nil {
+					gohttp.Error(rsp, err.Error(), gohttp.StatusBadRequest)
+					return
+				}
+			}
+
+			uris := reindex_req.URIs
+
+			if len(uris) == 0 {
+				uris = opts.URIs
+			}
+
+			if len(uris) == 0 {
+				gohttp.Error(rsp, "Nothing to index", gohttp.StatusBadRequest)
+				return
+			}
+
+			job, err := idx.IndexURIs(opts.Context, uris...)
+
+			if err == index.ErrIndexing {
+				gohttp.Error(rsp, err.Error(), gohttp.StatusConflict)
+				return
+			}
+
+			if err != nil {
+				gohttp.Error(rsp, err.Error(), gohttp.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(rsp, job.Status(), gohttp.StatusAccepted)
+			return
+
+		default:
+			gohttp.Error(rsp, "Unsupported method", gohttp.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	h := gohttp.HandlerFunc(fn)
+	return h, nil
+}
+
+func writeJSON(rsp gohttp.ResponseWriter, v interface{}, status int) {
+
+	rsp.Header().Set("Content-Type", "application/json")
+	rsp.WriteHeader(status)
+
+	enc := json.NewEncoder(rsp)
+	enc.Encode(v)
+}
+
+// ErrorReportHandler returns a gohttp.Handler for reporting the documents that failed to be indexed by a job.
+// If no "id" query parameter is present the report for the most recent job is returned.
+func ErrorReportHandler(idx *index.Indexer) (gohttp.Handler, error) {
+
+	fn := func(rsp gohttp.ResponseWriter, req *gohttp.Request) {
+
+		if req.Method != "GET" {
+			gohttp.Error(rsp, "Unsupported method", gohttp.StatusMethodNotAllowed)
+			return
+		}
+
+		str_id, err := sanitize.GetString(req, "id")
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), gohttp.StatusBadRequest)
+			return
+		}
+
+		var job *index.Job
+		var ok bool
+
+		if str_id == "" {
+
+			job, ok = idx.LastJob()
+
+		} else {
+
+			id, err := strconv.ParseInt(str_id, 10, 64)
+
+			if err != nil {
+				gohttp.Error(rsp, "Invalid job ID", gohttp.StatusBadRequest)
+				return
+			}
+
+			job, ok = idx.Job(id)
+		}
+
+		if !ok {
+			gohttp.Error(rsp, "Job not found", gohttp.StatusNotFound)
+			return
+		}
+
+		writeJSON(rsp, job.ErrorReport(), gohttp.StatusOK)
+		return
+	}
+
+	h := gohttp.HandlerFunc(fn)
+	return h, nil
+}
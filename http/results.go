@@ -0,0 +1,108 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/aaronland/go-http-sanitize"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	spatial_app "github.com/whosonfirst/go-whosonfirst-spatial/app"
+	"github.com/whosonfirst/go-whosonfirst-spr-geojson"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	gohttp "net/http"
+	"strings"
+)
+
+const GEOJSON string = "application/geo+json"
+
+// resultsOutput defines how a list of standard places results should be written to an HTTP response.
+type resultsOutput struct {
+	GeoJSON    bool
+	Properties []string
+}
+
+// resultsOutputWithRequest derives a resultsOutput instance from the "Accept" and "X-Properties" headers in 'req'.
+func resultsOutputWithRequest(req *gohttp.Request, enable_geojson bool) (*resultsOutput, error) {
+
+	accept, err := sanitize.HeaderString(req, "Accept")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if accept == GEOJSON && !enable_geojson {
+		return nil, errors.New("GeoJSON output is not supported")
+	}
+
+	str_props, err := sanitize.HeaderString(req, "X-Properties")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var props []string
+
+	str_props = strings.Trim(str_props, " ")
+
+	if str_props != "" {
+		props = strings.Split(str_props, ",")
+	}
+
+	out := &resultsOutput{
+		GeoJSON:    accept == GEOJSON,
+		Properties: props,
+	}
+
+	return out, nil
+}
+
+// queryErrorStatus returns the HTTP status code to use for an error returned by a query.
+func queryErrorStatus(err error) int {
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return gohttp.StatusGatewayTimeout
+	}
+
+	return gohttp.StatusInternalServerError
+}
+
+// writeResults writes 'results' to 'rsp' as a GeoJSON FeatureCollection, a list of results with additional
+// properties or a list of standard places results depending on 'out'.
+func writeResults(ctx context.Context, rsp gohttp.ResponseWriter, app *spatial_app.SpatialApplication, results spr.StandardPlacesResults, out *resultsOutput) {
+
+	if out.GeoJSON {
+
+		opts := &geojson.AsFeatureCollectionOptions{
+			Reader: app.SpatialDatabase,
+			Writer: rsp,
+		}
+
+		err := geojson.AsFeatureCollection(ctx, results, opts)
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), gohttp.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if len(out.Properties) > 0 {
+
+		props_opts := &spatial.PropertiesResponseOptions{
+			Reader:       app.PropertiesReader,
+			Keys:         out.Properties,
+			SourcePrefix: "properties",
+		}
+
+		props_rsp, err := spatial.PropertiesResponseResultsWithStandardPlacesResults(ctx, props_opts, results)
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), gohttp.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(rsp, props_rsp, gohttp.StatusOK)
+		return
+	}
+
+	writeJSON(rsp, results, gohttp.StatusOK)
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-iterate/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	spatial_app "github.com/whosonfirst/go-whosonfirst-spatial/app"
+	"io"
+	gohttp "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQueryErrorStatus(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "deadline", err: context.DeadlineExceeded, expected: gohttp.StatusGatewayTimeout},
+		{name: "wrapped deadline", err: fmt.Errorf("Failed to query, %w", context.DeadlineExceeded), expected: gohttp.StatusGatewayTimeout},
+		{name: "cancelled", err: context.Canceled, expected: gohttp.StatusInternalServerError},
+		{name: "other", err: errors.New("Failed to query"), expected: gohttp.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+
+		status := queryErrorStatus(test.err)
+
+		if status != test.expected {
+			t.Fatalf("%s: expected status %d but got %d", test.name, test.expected, status)
+		}
+	}
+}
+
+// TestQueryTimeout checks that the point-in-polygon and nearby handlers return a 504 error when queries take
+// longer than the database's 'query_timeout' parameter.
+func TestQueryTimeout(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, "sqlite://?dsn=:memory:&workers=1&query_timeout=1ns")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	noop := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+		return nil
+	}
+
+	iter, err := iterator.NewIterator(ctx, "directory://", emitter.EmitterCallbackFunc(noop))
+
+	if err != nil {
+		t.Fatalf("Failed to create iterator, %v", err)
+	}
+
+	app := &spatial_app.SpatialApplication{
+		SpatialDatabase: db,
+		Iterator:        iter,
+	}
+
+	pip_handler, err := PointInPolygonHandler(app, &PointInPolygonHandlerOptions{})
+
+	if err != nil {
+		t.Fatalf("Failed to create point-in-polygon handler, %v", err)
+	}
+
+	nearby_handler, err := NearbyHandler(app, &NearbyHandlerOptions{})
+
+	if err != nil {
+		t.Fatalf("Failed to create nearby handler, %v", err)
+	}
+
+	tests := map[string]gohttp.Handler{
+		"/api/point-in-polygon": pip_handler,
+		"/api/nearby":           nearby_handler,
+	}
+
+	for path, handler := range tests {
+
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(`{"latitude": 5.0, "longitude": 5.0}`))
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != gohttp.StatusGatewayTimeout {
+			t.Fatalf("%s: expected status %d but got %d (%s)", path, gohttp.StatusGatewayTimeout, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package http
+
+import (
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	gohttp "net/http"
+)
+
+// SchemaHandler returns a gohttp.Handler for reporting how the tables in 'db' compare to the schemas they are expected
+// to have, along with the schema version and parameters recorded in its metadata table. Schema reports are only available
+// for SQLiteSpatialDatabase instances.
+func SchemaHandler(db database.SpatialDatabase) (gohttp.Handler, error) {
+
+	fn := func(rsp gohttp.ResponseWriter, req *gohttp.Request) {
+
+		if req.Method != "GET" {
+			gohttp.Error(rsp, "Unsupported method", gohttp.StatusMethodNotAllowed)
+			return
+		}
+
+		sqlite_db, ok := db.(*sqlite.SQLiteSpatialDatabase)
+
+		if !ok {
+			gohttp.Error(rsp, "Spatial database does not support schema reports", gohttp.StatusNotImplemented)
+			return
+		}
+
+		report, err := sqlite_db.Schema(req.Context())
+
+		if err != nil {
+			gohttp.Error(rsp, err.Error(), gohttp.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(rsp, report, gohttp.StatusOK)
+	}
+
+	h := gohttp.HandlerFunc(fn)
+	return h, nil
+}
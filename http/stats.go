@@ -0,0 +1,40 @@
+package http
+
+import (
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	gohttp "net/http"
+)
+
+// StatsResponse is the JSON-encoded response returned by the StatsHandler handler.
+type StatsResponse struct {
+	Indexing     *sqlite.IndexingStats     `json:"indexing,omitempty"`
+	PolygonCache *sqlite.PolygonCacheStats `json:"polygon_cache,omitempty"`
+}
+
+// StatsHandler returns a gohttp.Handler for reporting indexing and polygon cache statistics for 'db'. Statistics
+// are only available for SQLiteSpatialDatabase instances.
+func StatsHandler(db database.SpatialDatabase) (gohttp.Handler, error) {
+
+	fn := func(rsp gohttp.ResponseWriter, req *gohttp.Request) {
+
+		if req.Method != "GET" {
+			gohttp.Error(rsp, "Unsupported method", gohttp.StatusMethodNotAllowed)
+			return
+		}
+
+		stats := &StatsResponse{}
+
+		sqlite_db, ok := db.(*sqlite.SQLiteSpatialDatabase)
+
+		if ok {
+			stats.Indexing = sqlite_db.IndexingStats()
+			stats.PolygonCache = sqlite_db.PolygonCacheStats()
+		}
+
+		writeJSON(rsp, stats, gohttp.StatusOK)
+	}
+
+	h := gohttp.HandlerFunc(fn)
+	return h, nil
+}
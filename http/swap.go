@@ -0,0 +1,81 @@
+package http
+
+import (
+	"encoding/json"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	gohttp "net/http"
+)
+
+type SwapRequest struct {
+	// The path to the SQLite database to swap in. If empty the current path is reopened, for example
+	// after a new database has been moved in to place.
+	DSN string `json:"dsn,omitempty"`
+}
+
+// SwapResponse is the JSON-encoded response returned by the SwapHandler handler.
+type SwapResponse struct {
+	DSN string `json:"dsn"`
+}
+
+// SwapHandler returns a gohttp.Handler for swapping the SQLite database that 'db' queries (POST) and reporting
+// the database currently in use (GET). Swapping is only supported for SQLiteSpatialDatabase instances.
+func SwapHandler(db database.SpatialDatabase) (gohttp.Handler, error) {
+
+	fn := func(rsp gohttp.ResponseWriter, req *gohttp.Request) {
+
+		sqlite_db, ok := db.(*sqlite.SQLiteSpatialDatabase)
+
+		if !ok {
+			gohttp.Error(rsp, "Spatial database does not support swapping", gohttp.StatusNotImplemented)
+			return
+		}
+
+		switch req.Method {
+		case "GET":
+
+			swap_rsp := &SwapResponse{
+				DSN: sqlite_db.DSN(),
+			}
+
+			writeJSON(rsp, swap_rsp, gohttp.StatusOK)
+			return
+
+		case "POST":
+
+			var swap_req SwapRequest
+
+			if req.ContentLength != 0 {
+
+				dec := json.NewDecoder(req.Body)
+				err := dec.Decode(&swap_req)
+
+				if err != nil {
+					gohttp.Error(rsp, err.Error(), gohttp.StatusBadRequest)
+					return
+				}
+			}
+
+			err := sqlite_db.Swap(req.Context(), swap_req.DSN)
+
+			if err != nil {
+				gohttp.Error(rsp, err.Error(), gohttp.StatusBadRequest)
+				return
+			}
+
+			swap_rsp := &SwapResponse{
+				DSN: sqlite_db.DSN(),
+			}
+
+			writeJSON(rsp, swap_rsp, gohttp.StatusOK)
+			return
+
+		default:
+			gohttp.Error(rsp, "Unsupported method", gohttp.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	h := gohttp.HandlerFunc(fn)
+	return h, nil
+}
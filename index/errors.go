@@ -0,0 +1,197 @@
+package index
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/whosonfirst/go-whosonfirst-iterate/emitter"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/flags"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stop indexing as soon as any document fails to be indexed.
+const ERROR_POLICY_FAIL_FAST string = "fail-fast"
+
+// Skip (and log) documents that fail to be indexed.
+const ERROR_POLICY_SKIP string = "skip"
+
+// ErrorPolicy defines how indexing errors for individual documents are handled.
+type ErrorPolicy struct {
+	// One of ERROR_POLICY_FAIL_FAST or ERROR_POLICY_SKIP.
+	Mode string
+	// The maximum number of documents that may be skipped before indexing is stopped. If 0 there is no limit.
+	// This is only applicable when Mode is ERROR_POLICY_SKIP.
+	MaxErrors int64
+}
+
+// DefaultErrorPolicy returns an ErrorPolicy that stops indexing as soon as any document fails to be indexed.
+func DefaultErrorPolicy() *ErrorPolicy {
+
+	p := &ErrorPolicy{
+		Mode:      ERROR_POLICY_FAIL_FAST,
+		MaxErrors: 0,
+	}
+
+	return p
+}
+
+// NewErrorPolicy returns a new ErrorPolicy for 'mode' and 'max_errors'.
+func NewErrorPolicy(mode string, max_errors int64) (*ErrorPolicy, error) {
+
+	switch mode {
+	case ERROR_POLICY_FAIL_FAST, ERROR_POLICY_SKIP:
+		// pass
+	default:
+		return nil, fmt.Errorf("Invalid error policy '%s'", mode)
+	}
+
+	if max_errors < 0 {
+		return nil, fmt.Errorf("Invalid maximum number of errors '%d'", max_errors)
+	}
+
+	p := &ErrorPolicy{
+		Mode:      mode,
+		MaxErrors: max_errors,
+	}
+
+	return p, nil
+}
+
+// NewErrorPolicyWithFlagSet returns a new ErrorPolicy derived from the values in 'fs'.
+func NewErrorPolicyWithFlagSet(fs *flag.FlagSet) (*ErrorPolicy, error) {
+
+	mode, err := lookup.StringVar(fs, flags.INDEX_ERROR_POLICY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	max_errors, err := lookup.Int64Var(fs, flags.INDEX_MAX_ERRORS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewErrorPolicy(mode, max_errors)
+}
+
+// The maximum number of indexing errors stored, and included in error reports, for a job. Errors beyond this
+// are still counted.
+var MAX_STORED_ERRORS int = 1000
+
+// IndexingError records a document that failed to be indexed.
+type IndexingError struct {
+	Path    string    `json:"path"`
+	Error   string    `json:"error"`
+	Created time.Time `json:"created"`
+}
+
+// ErrorReport is the list of documents that failed to be indexed by a job. Count is the total number of documents
+// that failed to be indexed, which may be more than the number of Errors if the job stored the maximum number.
+type ErrorReport struct {
+	JobId    int64            `json:"job_id"`
+	URIs     []string         `json:"uris"`
+	Policy   string           `json:"policy"`
+	Started  time.Time        `json:"started"`
+	Finished *time.Time       `json:"finished,omitempty"`
+	Count    int64            `json:"count"`
+	Errors   []*IndexingError `json:"errors"`
+}
+
+type errorCollector struct {
+	policy     *ErrorPolicy
+	errors     []*IndexingError
+	max_stored int
+	count      int64
+	mu         *sync.RWMutex
+}
+
+func newErrorCollector(policy *ErrorPolicy) *errorCollector {
+
+	c := &errorCollector{
+		policy:     policy,
+		errors:     make([]*IndexingError, 0),
+		max_stored: MAX_STORED_ERRORS,
+		mu:         new(sync.RWMutex),
+	}
+
+	return c
+}
+
+// wrapCallback returns a new emitter.EmitterCallbackFunc which records any errors returned by 'cb' and
+// applies the error policy to them.
+func (c *errorCollector) wrapCallback(cb emitter.EmitterCallbackFunc, on_skip func(string, error)) emitter.EmitterCallbackFunc {
+
+	wrapped_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+
+		err := cb(ctx, fh, args...)
+
+		if err == nil {
+			return nil
+		}
+
+		path, path_err := emitter.PathForContext(ctx)
+
+		if path_err != nil {
+			path = "unknown"
+		}
+
+		count := c.add(path, err)
+
+		if c.policy.Mode != ERROR_POLICY_SKIP {
+			return fmt.Errorf("Failed to index %s, %v", path, err)
+		}
+
+		if c.policy.MaxErrors > 0 && count > c.policy.MaxErrors {
+			return fmt.Errorf("Failed to index %s, %v (exceeded maximum number of indexing errors (%d))", path, err, c.policy.MaxErrors)
+		}
+
+		if on_skip != nil {
+			on_skip(path, err)
+		}
+
+		return nil
+	}
+
+	return wrapped_cb
+}
+
+func (c *errorCollector) add(path string, err error) int64 {
+
+	e := &IndexingError{
+		Path:    path,
+		Error:   err.Error(),
+		Created: time.Now(),
+	}
+
+	// Jobs that skip errors, without a maximum number, could otherwise store an error for every document
+
+	c.mu.Lock()
+
+	if len(c.errors) < c.max_stored {
+		c.errors = append(c.errors, e)
+	}
+
+	c.mu.Unlock()
+
+	return atomic.AddInt64(&c.count, 1)
+}
+
+func (c *errorCollector) Errors() []*IndexingError {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	errs := make([]*IndexingError, len(c.errors))
+	copy(errs, c.errors)
+
+	return errs
+}
+
+func (c *errorCollector) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
@@ -0,0 +1,90 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestErrorCollector(t *testing.T) {
+
+	ctx := context.Background()
+
+	failing_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+		return errors.New("Invalid document")
+	}
+
+	tests := []struct {
+		name       string
+		policy     *ErrorPolicy
+		max_stored int
+		documents  int
+		// The number of the first document that stops indexing, or 0 if none do.
+		failed_at int
+		skipped   int
+		stored    int
+	}{
+		{name: "fail fast", policy: &ErrorPolicy{Mode: ERROR_POLICY_FAIL_FAST}, max_stored: 10, documents: 5, failed_at: 1, skipped: 0, stored: 1},
+		{name: "skip", policy: &ErrorPolicy{Mode: ERROR_POLICY_SKIP}, max_stored: 10, documents: 5, skipped: 5, stored: 5},
+		{name: "skip (maximum errors)", policy: &ErrorPolicy{Mode: ERROR_POLICY_SKIP, MaxErrors: 3}, max_stored: 10, documents: 5, failed_at: 4, skipped: 3, stored: 4},
+		{name: "skip (maximum stored)", policy: &ErrorPolicy{Mode: ERROR_POLICY_SKIP}, max_stored: 10, documents: 25, skipped: 25, stored: 10},
+	}
+
+	for _, test := range tests {
+
+		c := newErrorCollector(test.policy)
+		c.max_stored = test.max_stored
+
+		skipped := 0
+
+		on_skip := func(path string, err error) {
+			skipped += 1
+		}
+
+		cb := c.wrapCallback(failing_cb, on_skip)
+
+		failed_at := 0
+
+		for i := 1; i <= test.documents; i++ {
+
+			err := cb(ctx, strings.NewReader(fmt.Sprintf("%d", i)))
+
+			if err != nil {
+				failed_at = i
+				break
+			}
+		}
+
+		if failed_at != test.failed_at {
+			t.Fatalf("%s: expected indexing to stop at document %d but it stopped at %d", test.name, test.failed_at, failed_at)
+		}
+
+		count := int64(test.documents)
+
+		if failed_at > 0 {
+			count = int64(failed_at)
+		}
+
+		if c.Count() != count {
+			t.Fatalf("%s: expected %d errors to be counted but got %d", test.name, count, c.Count())
+		}
+
+		if len(c.Errors()) != test.stored {
+			t.Fatalf("%s: expected %d errors to be stored but got %d", test.name, test.stored, len(c.Errors()))
+		}
+
+		if skipped != test.skipped {
+			t.Fatalf("%s: expected %d documents to be skipped but got %d", test.name, test.skipped, skipped)
+		}
+
+		for _, e := range c.Errors() {
+
+			if e.Path != "unknown" || e.Error != "Invalid document" {
+				t.Fatalf("%s: unexpected error %v", test.name, e)
+			}
+		}
+	}
+}
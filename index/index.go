@@ -0,0 +1,434 @@
+package index
+
+// This package manages the (re)indexing of features in a spatial database after
+// it has been created. Specifically it is meant to address the "TO DO" in the
+// go-whosonfirst-spatial/app.SpatialApplication.IndexPaths method: "put this
+// somewhere so that it can be triggered by signal(s) to reindex everything in
+// bulk or incrementally" (20210324/thisisaaronland)
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/whosonfirst/go-whosonfirst-iterate/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"github.com/whosonfirst/go-whosonfirst-log"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The maximum number of completed jobs to keep track of.
+const MAX_JOBS int = 100
+
+// ErrIndexing is returned when a new indexing job is requested while another is still in progress.
+var ErrIndexing = errors.New("Indexing job already in progress")
+
+// IndexingStatsDatabase is an interface for spatial databases that keep track of the number of features
+// they have indexed, by outcome.
+type IndexingStatsDatabase interface {
+	IndexingStats() *sqlite.IndexingStats
+}
+
+// JobStatus is a snapshot of the state of an indexing job.
+type JobStatus struct {
+	Id       int64      `json:"id"`
+	URIs     []string   `json:"uris"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Seen     int64      `json:"seen"`
+	Errors   []string   `json:"errors"`
+	// The number of documents that failed to be indexed. Details are available in the job's ErrorReport.
+	IndexingErrors int64                 `json:"indexing_errors"`
+	Stats          *sqlite.IndexingStats `json:"stats,omitempty"`
+}
+
+// Job is an individual (re)indexing job.
+type Job struct {
+	id          int64
+	uris        []string
+	started     time.Time
+	finished    time.Time
+	errors      []string
+	iterator    *iterator.Iterator
+	seen_start  int64
+	seen        int64
+	stats_db    IndexingStatsDatabase
+	stats_start *sqlite.IndexingStats
+	stats       *sqlite.IndexingStats
+	policy      *ErrorPolicy
+	collector   *errorCollector
+	mu          *sync.RWMutex
+	done_ch     chan bool
+}
+
+// IndexerOptions defines configuration options for a new Indexer instance.
+type IndexerOptions struct {
+	// The spatial database that features will be indexed in to.
+	SpatialDatabase database.SpatialDatabase
+	// A valid whosonfirst/go-whosonfirst-iterate/emitter URI.
+	EmitterURI string
+	// The callback function used to index individual documents.
+	EmitterCallback emitter.EmitterCallbackFunc
+	// The policy for handling documents that fail to be indexed. If nil then DefaultErrorPolicy will be used.
+	ErrorPolicy *ErrorPolicy
+	// An optional path where the ErrorReport for each job will be written when it finishes.
+	ErrorReportPath string
+	Logger          *log.WOFLogger
+}
+
+// Indexer manages (re)indexing jobs for a spatial database.
+type Indexer struct {
+	SpatialDatabase database.SpatialDatabase
+	Logger          *log.WOFLogger
+	emitter_uri     string
+	emitter_cb      emitter.EmitterCallbackFunc
+	policy          *ErrorPolicy
+	report_path     string
+	jobs            []*Job
+	last_id         int64
+	mu              *sync.RWMutex
+}
+
+// NewIndexer returns a new Indexer instance configured by 'opts'.
+func NewIndexer(ctx context.Context, opts *IndexerOptions) (*Indexer, error) {
+
+	policy := opts.ErrorPolicy
+
+	if policy == nil {
+		policy = DefaultErrorPolicy()
+	}
+
+	logger := opts.Logger
+
+	if logger == nil {
+		logger = log.SimpleWOFLogger("index")
+	}
+
+	mu := new(sync.RWMutex)
+
+	idx := &Indexer{
+		SpatialDatabase: opts.SpatialDatabase,
+		Logger:          logger,
+		emitter_uri:     opts.EmitterURI,
+		emitter_cb:      opts.EmitterCallback,
+		policy:          policy,
+		report_path:     opts.ErrorReportPath,
+		jobs:            make([]*Job, 0),
+		mu:              mu,
+	}
+
+	return idx, nil
+}
+
+// IndexURIs starts a new background job to index 'uris' using a new iterator.Iterator instance. It returns
+// ErrIndexing if another job is still in progress.
+func (idx *Indexer) IndexURIs(ctx context.Context, uris ...string) (*Job, error) {
+
+	iter, err := iterator.NewIterator(ctx, idx.emitter_uri, idx.emitter_cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.IndexURIsWithIterator(ctx, iter, uris...)
+}
+
+// IndexURIsWithIterator starts a new background job to index 'uris' using 'iter'. It returns ErrIndexing
+// if another job is still in progress. The iterator's EmitterCallbackFunc will be replaced by one that applies
+// the indexer's error policy.
+func (idx *Indexer) IndexURIsWithIterator(ctx context.Context, iter *iterator.Iterator, uris ...string) (*Job, error) {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, j := range idx.jobs {
+
+		if !j.IsFinished() {
+			return nil, ErrIndexing
+		}
+	}
+
+	id := atomic.AddInt64(&idx.last_id, 1)
+
+	collector := newErrorCollector(idx.policy)
+
+	on_skip := func(path string, err error) {
+		idx.Logger.Warning("indexing job %d skipped %s, %v", id, path, err)
+	}
+
+	iter.EmitterCallbackFunc = collector.wrapCallback(iter.EmitterCallbackFunc, on_skip)
+
+	job := &Job{
+		id:         id,
+		uris:       uris,
+		started:    time.Now(),
+		errors:     make([]string, 0),
+		iterator:   iter,
+		seen_start: atomic.LoadInt64(&iter.Seen),
+		policy:     idx.policy,
+		collector:  collector,
+		mu:         new(sync.RWMutex),
+		done_ch:    make(chan bool),
+	}
+
+	stats_db, ok := idx.SpatialDatabase.(IndexingStatsDatabase)
+
+	if ok {
+		job.stats_db = stats_db
+		job.stats_start = stats_db.IndexingStats()
+	}
+
+	idx.jobs = append(idx.jobs, job)
+
+	if len(idx.jobs) > MAX_JOBS {
+		idx.jobs = idx.jobs[len(idx.jobs)-MAX_JOBS:]
+	}
+
+	go idx.run(ctx, job)
+	go idx.monitor(ctx, job)
+
+	return job, nil
+}
+
+// Jobs returns the status of all the jobs the indexer knows about, most recent first.
+func (idx *Indexer) Jobs() []*JobStatus {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	status := make([]*JobStatus, len(idx.jobs))
+
+	for i, j := range idx.jobs {
+		status[i] = j.Status()
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Id > status[j].Id
+	})
+
+	return status
+}
+
+// Job returns the job whose identifier is 'id'.
+func (idx *Indexer) Job(id int64) (*Job, bool) {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	for _, j := range idx.jobs {
+
+		if j.id == id {
+			return j, true
+		}
+	}
+
+	return nil, false
+}
+
+// LastJob returns the most recent job the indexer knows about.
+func (idx *Indexer) LastJob() (*Job, bool) {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.jobs) == 0 {
+		return nil, false
+	}
+
+	return idx.jobs[len(idx.jobs)-1], true
+}
+
+func (idx *Indexer) run(ctx context.Context, job *Job) {
+
+	idx.Logger.Status("start indexing job %d (%d URIs)", job.id, len(job.uris))
+
+	err := job.iterator.IterateURIs(ctx, job.uris...)
+
+	if err != nil {
+		job.addError(err)
+	}
+
+	job.finish()
+
+	status := job.Status()
+
+	idx.Logger.Status("finished indexing job %d in %v (%d records, %d indexing errors)", status.Id, status.Finished.Sub(status.Started), status.Seen, status.IndexingErrors)
+
+	if status.Stats != nil {
+		idx.Logger.Status("indexing job %d stats: %d new, %d updated, %d skipped", status.Id, status.Stats.New, status.Stats.Updated, status.Stats.Skipped)
+	}
+
+	if idx.report_path != "" {
+
+		err := idx.writeErrorReport(job)
+
+		if err != nil {
+			idx.Logger.Error("failed to write error report for indexing job %d to %s, %v", job.id, idx.report_path, err)
+		}
+	}
+
+	debug.FreeOSMemory()
+}
+
+func (idx *Indexer) writeErrorReport(job *Job) error {
+
+	fh, err := os.Create(idx.report_path)
+
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(fh)
+	enc.SetIndent("", "  ")
+
+	err = enc.Encode(job.ErrorReport())
+
+	if err != nil {
+		fh.Close()
+		return err
+	}
+
+	return fh.Close()
+}
+
+func (idx *Indexer) monitor(ctx context.Context, job *Job) {
+
+	t := time.NewTicker(1 * time.Second)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-job.Done():
+			return
+		case <-t.C:
+			idx.Logger.Status("indexing job %d, %d records indexed", job.id, job.Status().Seen)
+		}
+	}
+}
+
+// Id returns the unique identifier for the job.
+func (j *Job) Id() int64 {
+	return j.id
+}
+
+// Done returns a channel that is closed when the job has finished.
+func (j *Job) Done() <-chan bool {
+	return j.done_ch
+}
+
+// IsFinished reports whether the job has finished.
+func (j *Job) IsFinished() bool {
+
+	select {
+	case <-j.done_ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Err returns the first error encountered by the job, if any.
+func (j *Job) Err() error {
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if len(j.errors) == 0 {
+		return nil
+	}
+
+	return errors.New(j.errors[0])
+}
+
+// Status returns a snapshot of the current state of the job.
+func (j *Job) Status() *JobStatus {
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	errs := make([]string, len(j.errors))
+	copy(errs, j.errors)
+
+	status := &JobStatus{
+		Id:             j.id,
+		URIs:           j.uris,
+		Started:        j.started,
+		Errors:         errs,
+		IndexingErrors: j.collector.Count(),
+	}
+
+	if j.IsFinished() {
+		finished := j.finished
+		status.Finished = &finished
+		status.Stats = j.stats
+		status.Seen = j.seen
+	} else {
+		status.Stats = j.currentStats()
+		status.Seen = atomic.LoadInt64(&j.iterator.Seen) - j.seen_start
+	}
+
+	return status
+}
+
+// ErrorReport returns the list of documents that have failed to be indexed by the job.
+func (j *Job) ErrorReport() *ErrorReport {
+
+	status := j.Status()
+
+	report := &ErrorReport{
+		JobId:    status.Id,
+		URIs:     status.URIs,
+		Policy:   j.policy.Mode,
+		Started:  status.Started,
+		Finished: status.Finished,
+		Count:    status.IndexingErrors,
+		Errors:   j.collector.Errors(),
+	}
+
+	return report
+}
+
+func (j *Job) currentStats() *sqlite.IndexingStats {
+
+	if j.stats_db == nil {
+		return nil
+	}
+
+	current := j.stats_db.IndexingStats()
+
+	stats := &sqlite.IndexingStats{
+		New:     current.New - j.stats_start.New,
+		Updated: current.Updated - j.stats_start.Updated,
+		Skipped: current.Skipped - j.stats_start.Skipped,
+	}
+
+	return stats
+}
+
+func (j *Job) addError(err error) {
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.errors = append(j.errors, err.Error())
+}
+
+func (j *Job) finish() {
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.finished = time.Now()
+	j.stats = j.currentStats()
+	j.seen = atomic.LoadInt64(&j.iterator.Seen) - j.seen_start
+
+	close(j.done_ch)
+}
@@ -0,0 +1,133 @@
+package index
+
+import (
+	"context"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReindexMovedFeature checks that reindexing a feature whose geometry has changed, as happens when
+// the server receives a SIGHUP or a request to the admin API, replaces the feature's previous geometry.
+func TestReindexMovedFeature(t *testing.T) {
+
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "index")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	db, err := database.NewSpatialDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+
+		f, err := feature.LoadFeatureFromReader(fh)
+
+		if err != nil {
+			return err
+		}
+
+		return db.IndexFeature(ctx, f)
+	}
+
+	opts := &IndexerOptions{
+		SpatialDatabase: db,
+		EmitterURI:      "directory://",
+		EmitterCallback: cb,
+	}
+
+	idx, err := NewIndexer(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create indexer, %v", err)
+	}
+
+	path := filepath.Join(root, "3001.geojson")
+
+	for i, origin := range []int{0, 20} {
+
+		opts := &spatialtest.FeatureOptions{
+			Id:        3001,
+			Name:      "Moving",
+			Placetype: "region",
+			MinX:      float64(origin),
+			MinY:      float64(origin),
+			MaxX:      float64(origin + 10),
+			MaxY:      float64(origin + 10),
+		}
+
+		body, err := spatialtest.FeatureBytes(opts)
+
+		if err != nil {
+			t.Fatalf("Failed to render feature, %v", err)
+		}
+
+		err = ioutil.WriteFile(path, body, 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write feature, %v", err)
+		}
+
+		job, err := idx.IndexURIs(ctx, root)
+
+		if err != nil {
+			t.Fatalf("Failed to start indexing job %d, %v", i, err)
+		}
+
+		<-job.Done()
+
+		status := job.Status()
+
+		if len(status.Errors) > 0 || status.IndexingErrors > 0 {
+			t.Fatalf("Indexing job %d failed, %v", i, status.Errors)
+		}
+
+		if i > 0 && (status.Stats == nil || status.Stats.New != 0 || status.Stats.Updated != 1) {
+			t.Fatalf("Expected reindexing job to update one feature, got %v", status.Stats)
+		}
+	}
+
+	for _, test := range []struct {
+		x        float64
+		y        float64
+		expected int
+	}{
+		{5.0, 5.0, 0},
+		{25.0, 25.0, 1},
+	} {
+
+		c, err := geo.NewCoordinate(test.x, test.y)
+
+		if err != nil {
+			t.Fatalf("Failed to create coordinate, %v", err)
+		}
+
+		rsp, err := db.PointInPolygon(ctx, c)
+
+		if err != nil {
+			t.Fatalf("Failed to perform point in polygon query, %v", err)
+		}
+
+		count := len(rsp.Results())
+
+		if count != test.expected {
+			t.Fatalf("Expected %d results at (%f, %f) but got %d", test.expected, test.x, test.y, count)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"github.com/whosonfirst/go-whosonfirst-iterate/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/mapping"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"github.com/whosonfirst/warning"
+	"io"
+	"log"
+)
+
+// NewIteratorWithFlagSet returns a new iterator.Iterator instance, for indexing features in to 'spatial_db',
+// derived from the values in 'fl'.
+func NewIteratorWithFlagSet(ctx context.Context, fl *flag.FlagSet, spatial_db database.SpatialDatabase) (*iterator.Iterator, error) {
+
+	emitter_uri, err := lookup.StringVar(fl, flags.ITERATOR_URI)
+
+	if err != nil {
+		return nil, err
+	}
+
+	emitter_cb, err := NewIteratorCallbackWithFlagSet(ctx, fl, spatial_db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return iterator.NewIterator(ctx, emitter_uri, emitter_cb)
+}
+
+// FeatureLoaderFunc is a function that loads a feature to be indexed from a GeoJSON document.
+type FeatureLoaderFunc func(io.ReadSeeker) (geojson.Feature, error)
+
+// NewFeatureLoaderWithFlagSet returns a new FeatureLoaderFunc derived from the values in 'fl'. If the -is-wof
+// flag is false then features will be loaded as mapping.MappedFeature instances using the property mapping
+// defined by 'fl'.
+func NewFeatureLoaderWithFlagSet(fl *flag.FlagSet) (FeatureLoaderFunc, error) {
+
+	is_wof, err := lookup.BoolVar(fl, flags.IS_WOF)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var property_mapping *mapping.PropertyMapping
+
+	if !is_wof {
+
+		m, err := mapping.NewPropertyMappingWithFlagSet(fl)
+
+		if err != nil {
+			return nil, err
+		}
+
+		property_mapping = m
+	}
+
+	loader := func(fh io.ReadSeeker) (geojson.Feature, error) {
+
+		f, err := feature.LoadFeatureFromReader(fh)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if is_wof {
+
+			if err != nil {
+
+				// it's still not clear (to me) what the expected or desired
+				// behaviour is / in this instance we might be issuing a warning
+				// from the geojson-v2 package because a feature might have a
+				// placetype defined outside of "core" (in the go-whosonfirst-placetypes)
+				// package but that shouldn't necessarily trigger a fatal error
+				// (20180405/thisisaaronland)
+
+				if !warning.IsWarning(err) {
+					return nil, err
+				}
+
+				log.Printf("Feature ID %s triggered the following warning: %s\n", f.Id(), err)
+			}
+
+		} else {
+
+			f, err = mapping.NewMappedFeature(f, property_mapping)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return f, nil
+	}
+
+	return loader, nil
+}
+
+// NewIteratorCallbackWithFlagSet returns a new emitter.EmitterCallbackFunc for indexing features
+// in to 'spatial_db' derived from the values in 'fl'. Features are loaded using the FeatureLoaderFunc
+// returned by NewFeatureLoaderWithFlagSet.
+func NewIteratorCallbackWithFlagSet(ctx context.Context, fl *flag.FlagSet, spatial_db database.SpatialDatabase) (emitter.EmitterCallbackFunc, error) {
+
+	loader, err := NewFeatureLoaderWithFlagSet(fl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	emitter_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+
+		f, err := loader(fh)
+
+		if err != nil {
+			return err
+		}
+
+		err = spatial_db.IndexFeature(ctx, f)
+
+		if err != nil {
+
+			// something something something wrapping errors in Go 1.13
+			// something something something waiting to see if the GOPROXY is
+			// disabled by default in Go > 1.13 (20190919/thisisaaronland)
+
+			msg := fmt.Sprintf("Failed to index %s (%s), %s", f.Id(), f.Name(), err)
+			return errors.New(msg)
+		}
+
+		return nil
+	}
+
+	return emitter_cb, nil
+}
@@ -0,0 +1,130 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/whosonfirst/go-whosonfirst-crawl"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/mapping"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BuildMetadataWithFlagSet returns the metadata describing how 'uris' are indexed using the emitter defined by
+// 'emitter_uri' and the -is-wof and property mapping flags in 'fs', keyed by the sqlite.METADATA_BUILD_* constants.
+// The time indexing finished is not included.
+func BuildMetadataWithFlagSet(fs *flag.FlagSet, emitter_uri string, uris ...string) (map[string]string, error) {
+
+	is_wof, err := lookup.BoolVar(fs, spatial_flags.IS_WOF)
+
+	if err != nil {
+		return nil, err
+	}
+
+	enc_uris, err := json.Marshal(uris)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode paths, %v", err)
+	}
+
+	metadata := map[string]string{
+		sqlite.METADATA_BUILD_ITERATOR_URI: emitter_uri,
+		sqlite.METADATA_BUILD_PATHS:        string(enc_uris),
+		sqlite.METADATA_BUILD_IS_WOF:       strconv.FormatBool(is_wof),
+	}
+
+	if !is_wof {
+
+		m, err := mapping.NewPropertyMappingWithFlagSet(fs)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive property mapping, %v", err)
+		}
+
+		enc_mapping, err := json.Marshal(m)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode property mapping, %v", err)
+		}
+
+		metadata[sqlite.METADATA_BUILD_PROPERTY_MAPPING] = string(enc_mapping)
+	}
+
+	return metadata, nil
+}
+
+// LastModified returns the most recent modification time of the files, and directories, that the emitter defined
+// by 'emitter_uri' would read when indexing 'uris'. Directories are included so that files which have been deleted
+// are accounted for. Only emitters that read from the local filesystem are supported.
+func LastModified(ctx context.Context, emitter_uri string, uris ...string) (time.Time, error) {
+
+	var last_modified time.Time
+	mu := new(sync.Mutex)
+
+	u, err := url.Parse(emitter_uri)
+
+	if err != nil {
+		return last_modified, fmt.Errorf("Failed to parse emitter URI, %v", err)
+	}
+
+	for _, path := range uris {
+
+		root := path
+
+		switch u.Scheme {
+		case "directory":
+			// pass
+		case "repo":
+			root = filepath.Join(path, "data")
+		case "file", "featurecollection", "geojsonl":
+
+			info, err := os.Stat(path)
+
+			if err != nil {
+				return last_modified, fmt.Errorf("Failed to stat %s, %v", path, err)
+			}
+
+			if info.ModTime().After(last_modified) {
+				last_modified = info.ModTime()
+			}
+
+			continue
+
+		default:
+			return last_modified, fmt.Errorf("Modification times are not supported for '%s' emitters", u.Scheme)
+		}
+
+		// Crawl callbacks are run concurrently
+
+		crawl_cb := func(path string, info os.FileInfo) error {
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if info.ModTime().After(last_modified) {
+				last_modified = info.ModTime()
+			}
+
+			return nil
+		}
+
+		c := crawl.NewCrawler(root)
+		c.CrawlDirectories = true
+
+		err := c.CrawlWithContext(ctx, crawl_cb)
+
+		if err != nil {
+			return last_modified, fmt.Errorf("Failed to crawl %s, %v", root, err)
+		}
+	}
+
+	return last_modified, nil
+}
@@ -0,0 +1,421 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-crawl"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"github.com/whosonfirst/go-whosonfirst-iterate/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"github.com/whosonfirst/go-whosonfirst-log"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default number of seconds to wait between scans of the paths being watched.
+const DEFAULT_WATCH_INTERVAL int = 10
+
+// A file that has been added since the last scan.
+const CHANGE_ADDED string = "added"
+
+// A file that has been modified since the last scan.
+const CHANGE_MODIFIED string = "modified"
+
+// A file that has been deleted since the last scan.
+const CHANGE_DELETED string = "deleted"
+
+// FeatureRemoverDatabase is an interface for spatial databases that can remove individual features.
+type FeatureRemoverDatabase interface {
+	RemoveFeature(context.Context, string, string) error
+}
+
+// Change is a GeoJSON file that has been added, modified or deleted since the last time a Watcher scanned
+// the paths it is watching.
+type Change struct {
+	Path string
+	Type string
+	// The state of the file when it was last scanned, for modified and deleted files.
+	previous *fileState
+}
+
+// WatcherOptions defines configuration options for a new Watcher instance.
+type WatcherOptions struct {
+	// The spatial database that changes will be applied to.
+	SpatialDatabase database.SpatialDatabase
+	// A valid whosonfirst/go-whosonfirst-iterate/emitter URI. Only the "directory://" and "repo://" schemes
+	// are supported. Any query parameters (filters, etc.) will be applied to added and modified files.
+	EmitterURI string
+	// The callback function used to index added and modified files.
+	EmitterCallback emitter.EmitterCallbackFunc
+	// An optional function used to load the feature in each file when it is scanned, so that it can be removed
+	// by its ID when the file is modified or deleted. It should load features the same way EmitterCallback does.
+	// If nil then IDs are derived from filenames, which must be valid Who's On First URIs.
+	FeatureLoader FeatureLoaderFunc
+	// The number of seconds to wait between scans. If 0 then DEFAULT_WATCH_INTERVAL will be used.
+	Interval int
+	Logger   *log.WOFLogger
+}
+
+// Watcher polls one or more directories for GeoJSON files that have been added, modified or deleted and
+// applies those changes to a spatial database.
+type Watcher struct {
+	SpatialDatabase database.SpatialDatabase
+	Logger          *log.WOFLogger
+	roots           []string
+	file_uri        string
+	emitter_cb      emitter.EmitterCallbackFunc
+	loader          FeatureLoaderFunc
+	interval        time.Duration
+	files           map[string]*fileState
+}
+
+type fileState struct {
+	modtime time.Time
+	size    int64
+	// The ID and alternate geometry label of the feature in the file, if the watcher has a FeatureLoaderFunc
+	// and the file could be loaded.
+	id        string
+	alt_label string
+}
+
+// NewWatcher returns a new Watcher instance for the paths in 'uris' configured by 'opts'. The paths
+// are resolved the same way that the emitter defined by opts.EmitterURI would resolve them.
+func NewWatcher(ctx context.Context, opts *WatcherOptions, uris ...string) (*Watcher, error) {
+
+	u, err := url.Parse(opts.EmitterURI)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse emitter URI, %v", err)
+	}
+
+	roots := make([]string, len(uris))
+
+	for i, path := range uris {
+
+		abs_path, err := filepath.Abs(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive absolute path for %s, %v", path, err)
+		}
+
+		switch u.Scheme {
+		case "directory":
+			roots[i] = abs_path
+		case "repo":
+			roots[i] = filepath.Join(abs_path, "data")
+		default:
+			return nil, fmt.Errorf("Watching is not supported for '%s' emitters", u.Scheme)
+		}
+	}
+
+	// Added and modified files are indexed using a "file://" emitter so that any filters
+	// defined by the original emitter URI are still applied
+
+	file_uri := "file://"
+
+	if u.RawQuery != "" {
+		file_uri = fmt.Sprintf("%s?%s", file_uri, u.RawQuery)
+	}
+
+	interval := opts.Interval
+
+	if interval == 0 {
+		interval = DEFAULT_WATCH_INTERVAL
+	}
+
+	if interval < 0 {
+		return nil, fmt.Errorf("Invalid watch interval '%d'", interval)
+	}
+
+	logger := opts.Logger
+
+	if logger == nil {
+		logger = log.SimpleWOFLogger("watch")
+	}
+
+	w := &Watcher{
+		SpatialDatabase: opts.SpatialDatabase,
+		Logger:          logger,
+		roots:           roots,
+		file_uri:        file_uri,
+		emitter_cb:      opts.EmitterCallback,
+		loader:          opts.FeatureLoader,
+		interval:        time.Duration(interval) * time.Second,
+	}
+
+	return w, nil
+}
+
+// Scan walks the paths being watched and returns the list of files that have been added, modified or
+// deleted since the last time Scan was called. The first call to Scan records the current state of
+// the paths being watched and returns an empty list. If the watcher has a FeatureLoaderFunc then the
+// feature in every new or changed file is loaded to record its ID.
+func (w *Watcher) Scan(ctx context.Context) ([]*Change, error) {
+
+	files := make(map[string]*fileState)
+
+	// Crawl callbacks are invoked concurrently
+
+	mu := new(sync.Mutex)
+
+	for _, root := range w.roots {
+
+		crawl_cb := func(path string, info os.FileInfo) error {
+
+			if info.IsDir() {
+				return nil
+			}
+
+			if !strings.HasSuffix(path, ".geojson") {
+				return nil
+			}
+
+			state := &fileState{
+				modtime: info.ModTime(),
+				size:    info.Size(),
+			}
+
+			if w.loader != nil {
+
+				prev, ok := w.files[path]
+
+				if ok && prev.modtime.Equal(state.modtime) && prev.size == state.size {
+					state.id = prev.id
+					state.alt_label = prev.alt_label
+				} else {
+
+					id, alt_label, err := w.loadFeatureId(path)
+
+					if err != nil {
+						w.Logger.Warning("failed to load feature ID from %s, %v", path, err)
+					} else {
+						state.id = id
+						state.alt_label = alt_label
+					}
+				}
+			}
+
+			mu.Lock()
+			files[path] = state
+			mu.Unlock()
+
+			return nil
+		}
+
+		c := crawl.NewCrawler(root)
+		err := c.CrawlWithContext(ctx, crawl_cb)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to crawl %s, %v", root, err)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		// pass
+	}
+
+	changes := make([]*Change, 0)
+
+	if w.files != nil {
+
+		for path, state := range files {
+
+			prev, ok := w.files[path]
+
+			switch {
+			case !ok:
+				changes = append(changes, &Change{Path: path, Type: CHANGE_ADDED})
+			case !prev.modtime.Equal(state.modtime) || prev.size != state.size:
+				changes = append(changes, &Change{Path: path, Type: CHANGE_MODIFIED, previous: prev})
+			default:
+				// pass
+			}
+		}
+
+		for path, prev := range w.files {
+
+			_, ok := files[path]
+
+			if !ok {
+				changes = append(changes, &Change{Path: path, Type: CHANGE_DELETED, previous: prev})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	w.files = files
+	return changes, nil
+}
+
+// Watch scans the paths being watched at regular intervals and applies any changes to the spatial database
+// until 'ctx' is cancelled. Errors applying individual changes are logged but do not stop the watcher.
+func (w *Watcher) Watch(ctx context.Context) error {
+
+	if w.files == nil {
+
+		_, err := w.Scan(ctx)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+
+			changes, err := w.Scan(ctx)
+
+			if err != nil {
+				w.Logger.Error("failed to scan for changes, %v", err)
+				continue
+			}
+
+			if len(changes) == 0 {
+				continue
+			}
+
+			counts := make(map[string]int)
+
+			for _, ch := range changes {
+
+				err := w.Apply(ctx, ch)
+
+				if err != nil {
+					w.Logger.Error("failed to apply change (%s) for %s, %v", ch.Type, ch.Path, err)
+					continue
+				}
+
+				counts[ch.Type] += 1
+			}
+
+			w.Logger.Status("applied changes: %d added, %d modified, %d deleted", counts[CHANGE_ADDED], counts[CHANGE_MODIFIED], counts[CHANGE_DELETED])
+		}
+	}
+}
+
+// Apply applies an individual change to the spatial database.
+func (w *Watcher) Apply(ctx context.Context, ch *Change) error {
+
+	switch ch.Type {
+	case CHANGE_ADDED:
+		return w.index(ctx, ch.Path)
+	case CHANGE_MODIFIED:
+
+		// Remove the previous version first so that stale geometries don't linger
+		// in the database if the new version is skipped by a filter
+
+		err := w.remove(ctx, ch)
+
+		if err != nil {
+			return err
+		}
+
+		return w.index(ctx, ch.Path)
+	case CHANGE_DELETED:
+		return w.remove(ctx, ch)
+	default:
+		return fmt.Errorf("Invalid change type '%s'", ch.Type)
+	}
+}
+
+func (w *Watcher) index(ctx context.Context, path string) error {
+
+	iter, err := iterator.NewIterator(ctx, w.file_uri, w.emitter_cb)
+
+	if err != nil {
+		return err
+	}
+
+	return iter.IterateURIs(ctx, path)
+}
+
+// loadFeatureId returns the ID and alternate geometry label of the feature in 'path' using the watcher's
+// FeatureLoaderFunc.
+func (w *Watcher) loadFeatureId(path string) (string, string, error) {
+
+	fh, err := os.Open(path)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	defer fh.Close()
+
+	f, err := w.loader(fh)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return f.Id(), whosonfirst.AltLabel(f), nil
+}
+
+// remove removes the feature previously stored in the file for 'ch' from the spatial database. If the watcher
+// has a FeatureLoaderFunc the ID recorded when the file was last scanned is used, otherwise the ID is derived
+// from the file's name.
+func (w *Watcher) remove(ctx context.Context, ch *Change) error {
+
+	remover, ok := w.SpatialDatabase.(FeatureRemoverDatabase)
+
+	if !ok {
+		return fmt.Errorf("Spatial database does not support removing features")
+	}
+
+	if w.loader != nil {
+
+		if ch.previous == nil || ch.previous.id == "" {
+
+			// If the previous version of a modified file couldn't be loaded then it
+			// won't have been indexed either so there is nothing to remove
+
+			if ch.Type == CHANGE_MODIFIED {
+				return nil
+			}
+
+			return fmt.Errorf("Unable to determine the ID of the feature previously stored in %s", ch.Path)
+		}
+
+		return remover.RemoveFeature(ctx, ch.previous.id, ch.previous.alt_label)
+	}
+
+	id, uri_args, err := uri.ParseURI(ch.Path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive ID from path, %v", err)
+	}
+
+	alt_label := ""
+
+	if uri_args.IsAlternate {
+
+		label, err := uri_args.AltGeom.String()
+
+		if err != nil {
+			return err
+		}
+
+		alt_label = label
+	}
+
+	return remover.RemoveFeature(ctx, strconv.FormatInt(id, 10), alt_label)
+}
@@ -0,0 +1,200 @@
+package index
+
+import (
+	"context"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/mapping"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestWatchPlainFeatures checks that modified and deleted files are removed from the spatial database when
+// their names are not Who's On First URIs.
+func TestWatchPlainFeatures(t *testing.T) {
+
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "watch")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	db, err := database.NewSpatialDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	property_mapping := &mapping.PropertyMapping{
+		Name:      "properties.name",
+		Placetype: "properties.type",
+		Country:   "properties.country",
+	}
+
+	loader := func(fh io.ReadSeeker) (geojson.Feature, error) {
+
+		f, err := feature.LoadFeatureFromReader(fh)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return mapping.NewMappedFeature(f, property_mapping)
+	}
+
+	cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+
+		f, err := loader(fh)
+
+		if err != nil {
+			return err
+		}
+
+		return db.IndexFeature(ctx, f)
+	}
+
+	opts := &WatcherOptions{
+		SpatialDatabase: db,
+		EmitterURI:      "directory://",
+		EmitterCallback: cb,
+		FeatureLoader:   loader,
+	}
+
+	w, err := NewWatcher(ctx, opts, root)
+
+	if err != nil {
+		t.Fatalf("Failed to create watcher, %v", err)
+	}
+
+	path := filepath.Join(root, "plain.geojson")
+
+	writeFeature := func(origin int) {
+
+		opts := &spatialtest.FeatureOptions{
+			Id:        4001,
+			Name:      "Plain",
+			Placetype: "building",
+			MinX:      float64(origin),
+			MinY:      float64(origin),
+			MaxX:      float64(origin + 10),
+			MaxY:      float64(origin + 10),
+		}
+
+		body, err := spatialtest.PlainFeatureBytes(opts)
+
+		if err != nil {
+			t.Fatalf("Failed to render feature, %v", err)
+		}
+
+		err = ioutil.WriteFile(path, body, 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write feature, %v", err)
+		}
+	}
+
+	countResults := func(x float64, y float64) int {
+
+		c, err := geo.NewCoordinate(x, y)
+
+		if err != nil {
+			t.Fatalf("Failed to create coordinate, %v", err)
+		}
+
+		rsp, err := db.PointInPolygon(ctx, c)
+
+		if err != nil {
+			t.Fatalf("Failed to perform point in polygon query, %v", err)
+		}
+
+		return len(rsp.Results())
+	}
+
+	applyChanges := func(expected string) {
+
+		changes, err := w.Scan(ctx)
+
+		if err != nil {
+			t.Fatalf("Failed to scan for changes, %v", err)
+		}
+
+		if len(changes) != 1 || changes[0].Type != expected {
+			t.Fatalf("Expected a single %s change", expected)
+		}
+
+		err = w.Apply(ctx, changes[0])
+
+		if err != nil {
+			t.Fatalf("Failed to apply %s change, %v", expected, err)
+		}
+	}
+
+	// The file is indexed after the initial scan, the same way the server does it
+
+	writeFeature(0)
+
+	_, err = w.Scan(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to scan for changes, %v", err)
+	}
+
+	err = w.index(ctx, path)
+
+	if err != nil {
+		t.Fatalf("Failed to index feature, %v", err)
+	}
+
+	if countResults(5.0, 5.0) != 1 {
+		t.Fatalf("Expected feature to be indexed")
+	}
+
+	// Make sure the modification time changes, regardless of the filesystem's precision
+
+	writeFeature(20)
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatalf("Failed to stat feature, %v", err)
+	}
+
+	modtime := info.ModTime().Add(10 * time.Second)
+
+	err = os.Chtimes(path, modtime, modtime)
+
+	if err != nil {
+		t.Fatalf("Failed to update modification time, %v", err)
+	}
+
+	applyChanges(CHANGE_MODIFIED)
+
+	if countResults(5.0, 5.0) != 0 || countResults(25.0, 25.0) != 1 {
+		t.Fatalf("Expected modified feature to replace its previous version")
+	}
+
+	err = os.Remove(path)
+
+	if err != nil {
+		t.Fatalf("Failed to remove feature, %v", err)
+	}
+
+	applyChanges(CHANGE_DELETED)
+
+	if countResults(25.0, 25.0) != 0 {
+		t.Fatalf("Expected deleted feature to be removed")
+	}
+}
@@ -0,0 +1,199 @@
+//go:build cgo
+// +build cgo
+
+package inmemory_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/inmemory"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestCompareSQLite checks that inmemory:// and sqlite:// databases, indexing the same fixtures, return the
+// same results for the same point-in-polygon and candidate queries and the same documents for Read.
+func TestCompareSQLite(t *testing.T) {
+
+	ctx := context.Background()
+
+	inmemory_db, err := spatialtest.NewFixturesDatabase(ctx, "inmemory://")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer inmemory_db.Disconnect(ctx)
+
+	sqlite_db, err := spatialtest.NewFixturesDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sqlite_db.Disconnect(ctx)
+
+	for _, q := range spatialtest.Queries() {
+
+		label := fmt.Sprintf("'%s' (%f, %f)", q.Name, q.Latitude, q.Longitude)
+
+		if q.Filter != "" {
+			label = fmt.Sprintf("%s?%s", label, q.Filter)
+		}
+
+		inmemory_ids, err := pointInPolygonIds(ctx, inmemory_db, q)
+
+		if err != nil {
+			t.Fatalf("Failed to query inmemory:// database for %s, %v", label, err)
+		}
+
+		sqlite_ids, err := pointInPolygonIds(ctx, sqlite_db, q)
+
+		if err != nil {
+			t.Fatalf("Failed to query sqlite:// database for %s, %v", label, err)
+		}
+
+		if strings.Join(inmemory_ids, ",") != strings.Join(sqlite_ids, ",") {
+			t.Fatalf("Results for %s differ, inmemory:// returned %v but sqlite:// returned %v", label, inmemory_ids, sqlite_ids)
+		}
+
+		inmemory_candidates, err := candidateIds(ctx, inmemory_db, q)
+
+		if err != nil {
+			t.Fatalf("Failed to query inmemory:// database for candidates for %s, %v", label, err)
+		}
+
+		sqlite_candidates, err := candidateIds(ctx, sqlite_db, q)
+
+		if err != nil {
+			t.Fatalf("Failed to query sqlite:// database for candidates for %s, %v", label, err)
+		}
+
+		if strings.Join(inmemory_candidates, ",") != strings.Join(sqlite_candidates, ",") {
+			t.Fatalf("Candidates for %s differ, inmemory:// returned %v but sqlite:// returned %v", label, inmemory_candidates, sqlite_candidates)
+		}
+	}
+
+	fixtures, err := spatialtest.Fixtures()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uris := []string{
+		"1001-alt-quattroshapes.geojson",
+		"9999.geojson",
+	}
+
+	for _, f := range fixtures {
+		uris = append(uris, fmt.Sprintf("%s.geojson", f.Id()))
+	}
+
+	for _, uri := range uris {
+
+		inmemory_body, inmemory_err := readBody(ctx, inmemory_db, uri)
+		sqlite_body, sqlite_err := readBody(ctx, sqlite_db, uri)
+
+		if (inmemory_err == nil) != (sqlite_err == nil) {
+			t.Fatalf("Reading %s differs, inmemory:// returned error '%v' but sqlite:// returned error '%v'", uri, inmemory_err, sqlite_err)
+		}
+
+		if !bytes.Equal(inmemory_body, sqlite_body) {
+			t.Fatalf("Reading %s differs, inmemory:// and sqlite:// returned different bodies", uri)
+		}
+	}
+}
+
+// candidateIds returns the sorted feature IDs, and alternate geometry labels, of the candidates returned by 'db'
+// for 'q'. Candidate IDs are specific to each database so they are not compared.
+func candidateIds(ctx context.Context, db database.SpatialDatabase, q *spatialtest.Query) ([]string, error) {
+
+	c, err := geo.NewCoordinate(q.Longitude, q.Latitude)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create coordinate, %v", err)
+	}
+
+	candidates, err := db.PointInPolygonCandidates(ctx, c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(candidates))
+
+	for i, candidate := range candidates {
+		ids[i] = fmt.Sprintf("%s#%s", candidate.FeatureId, candidate.AltLabel)
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// readBody returns the body of the document returned by 'db' for 'uri'.
+func readBody(ctx context.Context, db database.SpatialDatabase, uri string) ([]byte, error) {
+
+	fh, err := db.Read(ctx, uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer fh.Close()
+
+	return ioutil.ReadAll(fh)
+}
+
+// pointInPolygonIds returns the sorted IDs of the features returned by 'db' for 'q'.
+func pointInPolygonIds(ctx context.Context, db database.SpatialDatabase, q *spatialtest.Query) ([]string, error) {
+
+	c, err := geo.NewCoordinate(q.Longitude, q.Latitude)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create coordinate, %v", err)
+	}
+
+	filters := make([]spatial.Filter, 0)
+
+	if q.Filter != "" {
+
+		values, err := url.ParseQuery(q.Filter)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse filter, %v", err)
+		}
+
+		f, err := filter.NewSPRFilterFromQuery(values)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create filter, %v", err)
+		}
+
+		filters = append(filters, f)
+	}
+
+	rsp, err := db.PointInPolygon(ctx, c, filters...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0)
+
+	for _, s := range rsp.Results() {
+		ids = append(ids, s.Id())
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
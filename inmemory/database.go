@@ -0,0 +1,495 @@
+// Package inmemory implements the go-whosonfirst-spatial/database.SpatialDatabase interface using an R-tree
+// and SPR records stored in memory. It does not depend on SQLite, or cgo, so it is suitable for tests and small
+// datasets. Features are indexed using the same rules as the sqlite:// database and queries return the same
+// results.
+package inmemory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/skelterjohn/geom"
+	"github.com/whosonfirst/go-ioutil"
+	wof_geojson "github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/geometry"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"github.com/whosonfirst/go-whosonfirst-log"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	local_geo "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/timeout"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"io"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	ctx := context.Background()
+	database.RegisterSpatialDatabase(ctx, "inmemory", NewInMemorySpatialDatabase)
+}
+
+// ErrNotFound is returned when trying to read a feature that has not been indexed.
+var ErrNotFound = errors.New("Feature not found")
+
+// InMemorySpatialDatabase is a database.SpatialDatabase implementation that stores the polygons for features in
+// an in-memory R-tree and their SPR records, and bodies, in a map keyed by their path.
+type InMemorySpatialDatabase struct {
+	database.SpatialDatabase
+	Logger        *log.WOFLogger
+	mu            *sync.RWMutex
+	rtree         *rtree
+	records       map[string]*record
+	last_id       int64
+	query_timeout time.Duration
+}
+
+// record is everything stored for an individual feature.
+type record struct {
+	spr      spr.StandardPlacesResult
+	body     []byte
+	polygons []*polygon
+}
+
+// polygon is an individual polygon stored in the R-tree. Like the rows in the sqlite:// database's rtree table
+// polygons that cross the antimeridian are stored twice, once for each side.
+type polygon struct {
+	id        int64
+	bounds    geom.Rect
+	prepared  *local_geo.PreparedPolygon
+	FeatureId string
+	AltLabel  string
+}
+
+func (p *polygon) Bounds() geom.Rect {
+	return p.bounds
+}
+
+func (p *polygon) Path() string {
+	return featurePath(p.FeatureId, p.AltLabel)
+}
+
+type InMemoryResults struct {
+	spr.StandardPlacesResults `json:",omitempty"`
+	Places                    []spr.StandardPlacesResult `json:"places"`
+}
+
+func (r *InMemoryResults) Results() []spr.StandardPlacesResult {
+	return r.Places
+}
+
+// NewInMemorySpatialDatabase returns a new InMemorySpatialDatabase instance configured by 'uri' which is
+// expected to take the form of:
+//
+//	inmemory://
+//
+// An optional 'query_timeout' parameter, whose value is a Go duration string, may also be included.
+func NewInMemorySpatialDatabase(ctx context.Context, uri string) (database.SpatialDatabase, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+
+	query_timeout, err := timeout.QueryTimeout(q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger := log.SimpleWOFLogger("index")
+
+	spatial_db := &InMemorySpatialDatabase{
+		Logger:        logger,
+		mu:            new(sync.RWMutex),
+		rtree:         newRTree(),
+		records:       make(map[string]*record),
+		query_timeout: query_timeout,
+	}
+
+	return spatial_db, nil
+}
+
+func (r *InMemorySpatialDatabase) Disconnect(ctx context.Context) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rtree = newRTree()
+	r.records = make(map[string]*record)
+
+	return nil
+}
+
+// IndexFeature adds 'f' to the database, replacing any previous version of the same feature. Like the
+// sqlite:// database alternate geometry files are not indexed and only polygons are indexed for spatial
+// queries.
+func (r *InMemorySpatialDatabase) IndexFeature(ctx context.Context, f wof_geojson.Feature) error {
+
+	if whosonfirst.IsAlt(f) {
+		return nil
+	}
+
+	s, err := f.SPR()
+
+	if err != nil {
+		return err
+	}
+
+	rec := &record{
+		spr:      s,
+		body:     f.Bytes(),
+		polygons: make([]*polygon, 0),
+	}
+
+	switch geometry.Type(f) {
+	case "Polygon", "MultiPolygon":
+
+		polygons, err := f.Polygons()
+
+		if err != nil {
+			return err
+		}
+
+		for _, poly := range polygons {
+
+			points := make([][][]float64, 0)
+
+			exterior_ring := poly.ExteriorRing()
+			exterior_points := make([][]float64, 0)
+
+			for _, c := range exterior_ring.Vertices() {
+				exterior_points = append(exterior_points, []float64{c.X, c.Y})
+			}
+
+			points = append(points, exterior_points)
+
+			for _, interior_ring := range poly.InteriorRings() {
+
+				interior_points := make([][]float64, 0)
+
+				for _, c := range interior_ring.Vertices() {
+					interior_points = append(interior_points, []float64{c.X, c.Y})
+				}
+
+				points = append(points, interior_points)
+			}
+
+			for _, part := range local_geo.SplitAntimeridian(points) {
+
+				bbox := local_geo.PolygonBounds(part)
+
+				// The parts of a polygon that crosses the antimeridian extend beyond
+				// -180 or 180 but their bounding boxes shouldn't
+
+				if bbox.Min.X < -180.0 {
+					bbox.Min.X = -180.0
+				}
+
+				if bbox.Max.X > 180.0 {
+					bbox.Max.X = 180.0
+				}
+
+				p := &polygon{
+					bounds:    *bbox,
+					prepared:  local_geo.NewPreparedPolygon(part),
+					FeatureId: f.Id(),
+				}
+
+				rec.polygons = append(rec.polygons, p)
+			}
+		}
+
+	default:
+		// pass
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := featurePath(f.Id(), "")
+
+	r.removeRecord(path)
+
+	for _, p := range rec.polygons {
+
+		r.last_id += 1
+		p.id = r.last_id
+
+		r.rtree.Insert(p)
+	}
+
+	r.records[path] = rec
+	return nil
+}
+
+// RemoveFeature removes the feature whose ID is 'id' and whose alternate geometry label is 'alt_label'
+// from the database.
+func (r *InMemorySpatialDatabase) RemoveFeature(ctx context.Context, id string, alt_label string) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removeRecord(featurePath(id, alt_label))
+	return nil
+}
+
+func (r *InMemorySpatialDatabase) removeRecord(path string) {
+
+	rec, ok := r.records[path]
+
+	if !ok {
+		return
+	}
+
+	for _, p := range rec.polygons {
+		r.rtree.Delete(p)
+	}
+
+	delete(r.records, path)
+}
+
+func (r *InMemorySpatialDatabase) PointInPolygon(ctx context.Context, coord *geom.Coord, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	ctx, cancel := timeout.WithQueryTimeout(ctx, r.query_timeout)
+	defer cancel()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := make([]spr.StandardPlacesResult, 0)
+	seen := make(map[string]bool)
+
+	for _, p := range r.getIntersectsByCoord(coord) {
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			// pass
+		}
+
+		path := p.Path()
+
+		if seen[path] {
+			continue
+		}
+
+		if !p.prepared.ContainsCoord(coord) {
+			continue
+		}
+
+		// There is at least one polygon that contains the coordinate so whether or
+		// not the filters pass every subsequent polygon for the feature can be skipped
+
+		seen[path] = true
+
+		rec, ok := r.records[path]
+
+		if !ok {
+			r.Logger.Error("Failed to retrieve SPR for %s", path)
+			continue
+		}
+
+		matches_filters := true
+
+		for _, f := range filters {
+
+			err := filter.FilterSPR(f, rec.spr)
+
+			if err != nil {
+				r.Logger.Debug("SKIP %s because filter error %s", path, err)
+				matches_filters = false
+				break
+			}
+		}
+
+		if matches_filters {
+			results = append(results, rec.spr)
+		}
+	}
+
+	spr_results := &InMemoryResults{
+		Places: results,
+	}
+
+	return spr_results, nil
+}
+
+func (r *InMemorySpatialDatabase) PointInPolygonWithChannels(ctx context.Context, rsp_ch chan spr.StandardPlacesResult, err_ch chan error, done_ch chan bool, coord *geom.Coord, filters ...spatial.Filter) {
+
+	defer func() {
+		timeout.SendDone(ctx, done_ch)
+	}()
+
+	rsp, err := r.PointInPolygon(ctx, coord, filters...)
+
+	if err != nil {
+		timeout.SendError(ctx, err_ch, err)
+		return
+	}
+
+	for _, s := range rsp.Results() {
+
+		select {
+		case <-ctx.Done():
+			return
+		case rsp_ch <- s:
+			// pass
+		}
+	}
+}
+
+func (r *InMemorySpatialDatabase) PointInPolygonCandidates(ctx context.Context, coord *geom.Coord, filters ...spatial.Filter) ([]*spatial.PointInPolygonCandidate, error) {
+
+	ctx, cancel := timeout.WithQueryTimeout(ctx, r.query_timeout)
+	defer cancel()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	candidates := make([]*spatial.PointInPolygonCandidate, 0)
+
+	for _, p := range r.getIntersectsByCoord(coord) {
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			// pass
+		}
+
+		bounds := p.Bounds()
+
+		c := &spatial.PointInPolygonCandidate{
+			Id:        fmt.Sprintf("%s#%d", p.FeatureId, p.id),
+			FeatureId: p.FeatureId,
+			AltLabel:  p.AltLabel,
+			Bounds:    &bounds,
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+func (r *InMemorySpatialDatabase) PointInPolygonCandidatesWithChannels(ctx context.Context, rsp_ch chan *spatial.PointInPolygonCandidate, err_ch chan error, done_ch chan bool, coord *geom.Coord, filters ...spatial.Filter) {
+
+	defer func() {
+		timeout.SendDone(ctx, done_ch)
+	}()
+
+	candidates, err := r.PointInPolygonCandidates(ctx, coord, filters...)
+
+	if err != nil {
+		timeout.SendError(ctx, err_ch, err)
+		return
+	}
+
+	for _, c := range candidates {
+
+		select {
+		case <-ctx.Done():
+			return
+		case rsp_ch <- c:
+			// pass
+		}
+	}
+}
+
+// getIntersectsByCoord returns the polygons whose bounding box intersects a tiny rectangle around 'coord', the
+// same rectangle used by the sqlite:// database, so that both databases return the same candidates.
+func (r *InMemorySpatialDatabase) getIntersectsByCoord(coord *geom.Coord) []*polygon {
+
+	offset := geom.Coord{
+		X: 0.00001,
+		Y: 0.00001,
+	}
+
+	rect := geom.Rect{
+		Min: coord.Minus(offset),
+		Max: coord.Plus(offset),
+	}
+
+	intersects := make([]*polygon, 0)
+
+	r.rtree.Search(rect, func(item rtreeItem) bool {
+		intersects = append(intersects, item.(*polygon))
+		return true
+	})
+
+	return intersects
+}
+
+// whosonfirst/go-reader interface
+
+func (r *InMemorySpatialDatabase) Read(ctx context.Context, str_uri string) (io.ReadSeekCloser, error) {
+
+	id, uri_args, err := uri.ParseURI(str_uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	alt_label := ""
+
+	if uri_args.IsAlternate {
+
+		source, err := uri_args.AltGeom.String()
+
+		if err != nil {
+			return nil, err
+		}
+
+		alt_label = source
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.records[featurePath(strconv.FormatInt(id, 10), alt_label)]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return ioutil.NewReadSeekCloser(bytes.NewReader(rec.body))
+}
+
+func (r *InMemorySpatialDatabase) ReaderURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+// whosonfirst/go-writer interface
+
+func (r *InMemorySpatialDatabase) Write(ctx context.Context, key string, fh io.ReadSeeker) (int64, error) {
+	return 0, fmt.Errorf("Not implemented")
+}
+
+func (r *InMemorySpatialDatabase) WriterURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+func (r *InMemorySpatialDatabase) Close(ctx context.Context) error {
+	return nil
+}
+
+// featurePath returns the key used to store the feature whose ID is 'id' and whose alternate geometry label
+// is 'alt_label'. This is the same as the value returned by the sqlite:// database's RTreeSpatialIndex.Path method.
+func featurePath(id string, alt_label string) string {
+
+	if alt_label != "" {
+		return fmt.Sprintf("%s-alt-%s", id, alt_label)
+	}
+
+	return id
+}
@@ -0,0 +1,68 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"testing"
+)
+
+func TestSpatialDatabase(t *testing.T) {
+
+	ctx := context.Background()
+
+	new_db := func(ctx context.Context) (database.SpatialDatabase, error) {
+		return database.NewSpatialDatabase(ctx, "inmemory://")
+	}
+
+	err := spatialtest.TestSpatialDatabase(ctx, new_db)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryCancelled(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, "inmemory://?query_timeout=1m")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	coord, err := geo.NewCoordinate(12.0, 12.0)
+
+	if err != nil {
+		t.Fatalf("Failed to create coordinate, %v", err)
+	}
+
+	cancelled_ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err = db.PointInPolygon(cancelled_ctx, coord)
+
+	if err != context.Canceled {
+		t.Fatalf("Expected point in polygon query to be cancelled, got %v", err)
+	}
+
+	_, err = db.PointInPolygonCandidates(cancelled_ctx, coord)
+
+	if err != context.Canceled {
+		t.Fatalf("Expected candidates query to be cancelled, got %v", err)
+	}
+
+	candidates, err := db.PointInPolygonCandidates(ctx, coord)
+
+	if err != nil {
+		t.Fatalf("Candidates query failed, %v", err)
+	}
+
+	if len(candidates) != 2 {
+		t.Fatalf("Expected 2 candidates but got %d", len(candidates))
+	}
+}
@@ -0,0 +1,478 @@
+package inmemory
+
+// This is a simple R-tree, as described in Antonin Guttman's "R-Trees: A Dynamic Index Structure for
+// Spatial Searching" (1984), using the quadratic split algorithm. Entries removed from nodes that become
+// underfull are reinserted individually rather than at the level they were removed from.
+
+import (
+	"github.com/skelterjohn/geom"
+	"math"
+)
+
+const rtreeMaxEntries int = 16
+
+const rtreeMinEntries int = 6
+
+// rtreeItem is the interface for items stored in an rtree.
+type rtreeItem interface {
+	Bounds() geom.Rect
+}
+
+type rtree struct {
+	root *rtreeNode
+	size int
+}
+
+type rtreeNode struct {
+	parent   *rtreeNode
+	leaf     bool
+	bounds   geom.Rect
+	children []*rtreeNode
+	items    []rtreeItem
+}
+
+func newRTree() *rtree {
+
+	t := &rtree{
+		root: newRTreeNode(true),
+	}
+
+	return t
+}
+
+func newRTreeNode(leaf bool) *rtreeNode {
+
+	n := &rtreeNode{
+		leaf:     leaf,
+		bounds:   geom.NilRect(),
+		children: make([]*rtreeNode, 0),
+		items:    make([]rtreeItem, 0),
+	}
+
+	return n
+}
+
+// Len returns the number of items in the tree.
+func (t *rtree) Len() int {
+	return t.size
+}
+
+// Insert adds 'item' to the tree.
+func (t *rtree) Insert(item rtreeItem) {
+
+	n := t.chooseLeaf(item.Bounds())
+	n.items = append(n.items, item)
+
+	t.size += 1
+	t.adjust(n)
+}
+
+// Delete removes 'item' from the tree, returning false if it could not be found. Items are compared by
+// equality so 'item' must be the same value (or pointer) that was inserted.
+func (t *rtree) Delete(item rtreeItem) bool {
+
+	n, idx := t.root.findLeaf(item)
+
+	if n == nil {
+		return false
+	}
+
+	n.items = append(n.items[:idx], n.items[idx+1:]...)
+	t.size -= 1
+
+	t.condense(n)
+	return true
+}
+
+// Search calls 'cb' for every item whose bounds intersect 'rect' until 'cb' returns false.
+func (t *rtree) Search(rect geom.Rect, cb func(rtreeItem) bool) {
+	t.root.search(rect, cb)
+}
+
+// chooseLeaf returns the leaf node whose bounds need the least enlargement to include 'bounds'.
+func (t *rtree) chooseLeaf(bounds geom.Rect) *rtreeNode {
+
+	n := t.root
+
+	for !n.leaf {
+
+		var best *rtreeNode
+		best_enlargement := math.Inf(1)
+		best_area := math.Inf(1)
+
+		for _, child := range n.children {
+
+			area := rectArea(child.bounds)
+			enlargement := rectArea(rectUnion(child.bounds, bounds)) - area
+
+			if enlargement < best_enlargement || (enlargement == best_enlargement && area < best_area) {
+				best = child
+				best_enlargement = enlargement
+				best_area = area
+			}
+		}
+
+		n = best
+	}
+
+	return n
+}
+
+// adjust recalculates the bounds of 'n' and all its ancestors, splitting any nodes that have too many entries.
+func (t *rtree) adjust(n *rtreeNode) {
+
+	for n != nil {
+
+		var sibling *rtreeNode
+
+		if n.len() > rtreeMaxEntries {
+			sibling = n.split()
+		}
+
+		n.recalculate()
+
+		parent := n.parent
+
+		if sibling != nil {
+
+			if parent == nil {
+
+				root := newRTreeNode(false)
+				root.children = append(root.children, n, sibling)
+
+				n.parent = root
+				sibling.parent = root
+
+				root.recalculate()
+
+				t.root = root
+				return
+			}
+
+			sibling.parent = parent
+			parent.children = append(parent.children, sibling)
+		}
+
+		n = parent
+	}
+}
+
+// condense removes 'n' and any of its ancestors that have too few entries, reinserting their items, and
+// recalculates the bounds of the remaining ancestors.
+func (t *rtree) condense(n *rtreeNode) {
+
+	orphans := make([]rtreeItem, 0)
+
+	for n.parent != nil {
+
+		parent := n.parent
+
+		if n.len() < rtreeMinEntries {
+
+			for i, child := range parent.children {
+
+				if child == n {
+					parent.children = append(parent.children[:i], parent.children[i+1:]...)
+					break
+				}
+			}
+
+			orphans = n.collect(orphans)
+
+		} else {
+			n.recalculate()
+		}
+
+		n = parent
+	}
+
+	n.recalculate()
+
+	// Shorten the tree if the root has been left with a single child
+
+	for !t.root.leaf && len(t.root.children) == 1 {
+		t.root = t.root.children[0]
+		t.root.parent = nil
+	}
+
+	if !t.root.leaf && len(t.root.children) == 0 {
+		t.root = newRTreeNode(true)
+	}
+
+	for _, item := range orphans {
+		t.size -= 1
+		t.Insert(item)
+	}
+}
+
+func (n *rtreeNode) len() int {
+
+	if n.leaf {
+		return len(n.items)
+	}
+
+	return len(n.children)
+}
+
+func (n *rtreeNode) entryBounds(i int) geom.Rect {
+
+	if n.leaf {
+		return n.items[i].Bounds()
+	}
+
+	return n.children[i].bounds
+}
+
+func (n *rtreeNode) recalculate() {
+
+	bounds := geom.NilRect()
+
+	for i := 0; i < n.len(); i++ {
+		bounds.ExpandToContainRect(n.entryBounds(i))
+	}
+
+	n.bounds = bounds
+}
+
+// collect appends every item in 'n', and its descendants, to 'items'.
+func (n *rtreeNode) collect(items []rtreeItem) []rtreeItem {
+
+	if n.leaf {
+		return append(items, n.items...)
+	}
+
+	for _, child := range n.children {
+		items = child.collect(items)
+	}
+
+	return items
+}
+
+func (n *rtreeNode) findLeaf(item rtreeItem) (*rtreeNode, int) {
+
+	bounds := item.Bounds()
+
+	if n.leaf {
+
+		for i, candidate := range n.items {
+
+			if candidate == item {
+				return n, i
+			}
+		}
+
+		return nil, -1
+	}
+
+	for _, child := range n.children {
+
+		if !child.bounds.ContainsRect(bounds) {
+			continue
+		}
+
+		leaf, idx := child.findLeaf(item)
+
+		if leaf != nil {
+			return leaf, idx
+		}
+	}
+
+	return nil, -1
+}
+
+func (n *rtreeNode) search(rect geom.Rect, cb func(rtreeItem) bool) bool {
+
+	if n.leaf {
+
+		for _, item := range n.items {
+
+			if !rectsIntersect(item.Bounds(), rect) {
+				continue
+			}
+
+			if !cb(item) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	for _, child := range n.children {
+
+		if !rectsIntersect(child.bounds, rect) {
+			continue
+		}
+
+		if !child.search(rect, cb) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// split moves the entries in 'n' in to two groups using Guttman's quadratic split algorithm, leaving the first
+// group in 'n' and returning a new node, with the same parent, containing the second.
+func (n *rtreeNode) split() *rtreeNode {
+
+	count := n.len()
+	bounds := make([]geom.Rect, count)
+
+	for i := 0; i < count; i++ {
+		bounds[i] = n.entryBounds(i)
+	}
+
+	group_a, group_b := quadraticSplit(bounds)
+
+	sibling := newRTreeNode(n.leaf)
+	sibling.parent = n.parent
+
+	if n.leaf {
+
+		items := n.items
+		n.items = make([]rtreeItem, 0, len(group_a))
+
+		for _, i := range group_a {
+			n.items = append(n.items, items[i])
+		}
+
+		for _, i := range group_b {
+			sibling.items = append(sibling.items, items[i])
+		}
+
+	} else {
+
+		children := n.children
+		n.children = make([]*rtreeNode, 0, len(group_a))
+
+		for _, i := range group_a {
+			n.children = append(n.children, children[i])
+		}
+
+		for _, i := range group_b {
+			child := children[i]
+			child.parent = sibling
+			sibling.children = append(sibling.children, child)
+		}
+	}
+
+	sibling.recalculate()
+	return sibling
+}
+
+// quadraticSplit divides the indices of 'bounds' in to two groups with at least rtreeMinEntries each.
+func quadraticSplit(bounds []geom.Rect) ([]int, []int) {
+
+	// Pick the two entries that would waste the most area if they were in the same group
+
+	seed_a := 0
+	seed_b := 1
+	worst := math.Inf(-1)
+
+	for i := 0; i < len(bounds); i++ {
+
+		for j := i + 1; j < len(bounds); j++ {
+
+			d := rectArea(rectUnion(bounds[i], bounds[j])) - rectArea(bounds[i]) - rectArea(bounds[j])
+
+			if d > worst {
+				seed_a = i
+				seed_b = j
+				worst = d
+			}
+		}
+	}
+
+	group_a := []int{seed_a}
+	group_b := []int{seed_b}
+
+	bounds_a := bounds[seed_a]
+	bounds_b := bounds[seed_b]
+
+	remaining := make([]int, 0, len(bounds)-2)
+
+	for i := range bounds {
+
+		if i != seed_a && i != seed_b {
+			remaining = append(remaining, i)
+		}
+	}
+
+	for len(remaining) > 0 {
+
+		// If one group needs all the remaining entries to have the minimum number then it gets them
+
+		if len(group_a)+len(remaining) <= rtreeMinEntries {
+			group_a = append(group_a, remaining...)
+			break
+		}
+
+		if len(group_b)+len(remaining) <= rtreeMinEntries {
+			group_b = append(group_b, remaining...)
+			break
+		}
+
+		// Otherwise pick the entry with the greatest preference for one group over the other
+
+		next := 0
+		preference := math.Inf(-1)
+
+		for i, idx := range remaining {
+
+			d_a := rectArea(rectUnion(bounds_a, bounds[idx])) - rectArea(bounds_a)
+			d_b := rectArea(rectUnion(bounds_b, bounds[idx])) - rectArea(bounds_b)
+
+			if math.Abs(d_a-d_b) > preference {
+				next = i
+				preference = math.Abs(d_a - d_b)
+			}
+		}
+
+		idx := remaining[next]
+		remaining = append(remaining[:next], remaining[next+1:]...)
+
+		d_a := rectArea(rectUnion(bounds_a, bounds[idx])) - rectArea(bounds_a)
+		d_b := rectArea(rectUnion(bounds_b, bounds[idx])) - rectArea(bounds_b)
+
+		add_to_a := false
+
+		switch {
+		case d_a < d_b:
+			add_to_a = true
+		case d_a > d_b:
+			add_to_a = false
+		case rectArea(bounds_a) != rectArea(bounds_b):
+			add_to_a = rectArea(bounds_a) < rectArea(bounds_b)
+		default:
+			add_to_a = len(group_a) <= len(group_b)
+		}
+
+		if add_to_a {
+			group_a = append(group_a, idx)
+			bounds_a = rectUnion(bounds_a, bounds[idx])
+		} else {
+			group_b = append(group_b, idx)
+			bounds_b = rectUnion(bounds_b, bounds[idx])
+		}
+	}
+
+	return group_a, group_b
+}
+
+func rectArea(r geom.Rect) float64 {
+	return r.Width() * r.Height()
+}
+
+func rectUnion(a geom.Rect, b geom.Rect) geom.Rect {
+
+	r := a
+	r.ExpandToContainRect(b)
+
+	return r
+}
+
+// rectsIntersect returns true if 'a' and 'b' intersect, including if they only share an edge.
+func rectsIntersect(a geom.Rect, b geom.Rect) bool {
+	return a.Min.X <= b.Max.X && a.Max.X >= b.Min.X && a.Min.Y <= b.Max.Y && a.Max.Y >= b.Min.Y
+}
@@ -0,0 +1,260 @@
+package inmemory
+
+import (
+	"fmt"
+	"github.com/skelterjohn/geom"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type testItem struct {
+	id     int
+	bounds geom.Rect
+}
+
+func (i *testItem) Bounds() geom.Rect {
+	return i.bounds
+}
+
+func randomRect(rnd *rand.Rand) geom.Rect {
+
+	x := rnd.Float64()*360.0 - 180.0
+	y := rnd.Float64()*180.0 - 90.0
+
+	// Mostly small rectangles, with the occasional large one, and some points
+
+	var w float64
+	var h float64
+
+	switch rnd.Intn(10) {
+	case 0:
+		w = rnd.Float64() * 90.0
+		h = rnd.Float64() * 45.0
+	case 1:
+		// pass
+	default:
+		w = rnd.Float64() * 5.0
+		h = rnd.Float64() * 5.0
+	}
+
+	return geom.Rect{
+		Min: geom.Coord{X: x, Y: y},
+		Max: geom.Coord{X: x + w, Y: y + h},
+	}
+}
+
+// TestRTree checks the results of searching an rtree, after a random sequence of inserts and deletes large
+// enough to cause nodes to be split and condensed, against a brute-force search of the same items.
+func TestRTree(t *testing.T) {
+
+	rnd := rand.New(rand.NewSource(1))
+
+	tree := newRTree()
+	items := make(map[int]*testItem)
+
+	next_id := 0
+
+	for step := 0; step < 20000; step++ {
+
+		// Grow the tree for the first half of the test and then shrink it, deleting
+		// more items than are inserted, so that it ends up with only a few levels
+
+		insert_odds := 7
+
+		if step > 10000 {
+			insert_odds = 3
+		}
+
+		if len(items) == 0 || rnd.Intn(10) < insert_odds {
+
+			item := &testItem{
+				id:     next_id,
+				bounds: randomRect(rnd),
+			}
+
+			next_id += 1
+
+			tree.Insert(item)
+			items[item.id] = item
+
+		} else {
+
+			// Pick an item to delete deterministically, since map iteration is random
+
+			ids := make([]int, 0, len(items))
+
+			for id := range items {
+				ids = append(ids, id)
+			}
+
+			sort.Ints(ids)
+
+			id := ids[rnd.Intn(len(ids))]
+
+			if !tree.Delete(items[id]) {
+				t.Fatalf("Step %d: failed to delete item %d", step, id)
+			}
+
+			delete(items, id)
+		}
+
+		if tree.Len() != len(items) {
+			t.Fatalf("Step %d: expected %d items but tree has %d", step, len(items), tree.Len())
+		}
+
+		if step%500 == 0 {
+
+			err := checkRTree(tree)
+
+			if err != nil {
+				t.Fatalf("Step %d: %v", step, err)
+			}
+		}
+
+		if step%10 == 0 {
+
+			search := randomRect(rnd)
+
+			err := compareSearch(tree, items, search)
+
+			if err != nil {
+				t.Fatalf("Step %d: %v", step, err)
+			}
+		}
+	}
+
+	err := checkRTree(tree)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete everything that's left and make sure the tree is empty
+
+	for id, item := range items {
+
+		if !tree.Delete(item) {
+			t.Fatalf("Failed to delete item %d", id)
+		}
+	}
+
+	if tree.Len() != 0 {
+		t.Fatalf("Expected empty tree but it has %d items", tree.Len())
+	}
+
+	err = compareSearch(tree, map[int]*testItem{}, geom.Rect{Min: geom.Coord{X: -180, Y: -90}, Max: geom.Coord{X: 180, Y: 90}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := &testItem{
+		id:     -1,
+		bounds: randomRect(rnd),
+	}
+
+	if tree.Delete(deleted) {
+		t.Fatalf("Expected deleting an item that was never inserted to fail")
+	}
+}
+
+// compareSearch returns an error if searching 'tree' for 'search' doesn't return the same items as a brute-force search of 'items'.
+func compareSearch(tree *rtree, items map[int]*testItem, search geom.Rect) error {
+
+	expected := make([]int, 0)
+
+	for id, item := range items {
+
+		if overlaps(item.bounds, search) {
+			expected = append(expected, id)
+		}
+	}
+
+	found := make([]int, 0)
+
+	tree.Search(search, func(i rtreeItem) bool {
+		found = append(found, i.(*testItem).id)
+		return true
+	})
+
+	sort.Ints(expected)
+	sort.Ints(found)
+
+	if fmt.Sprintf("%v", expected) != fmt.Sprintf("%v", found) {
+		return fmt.Errorf("Search for %v returned %d items, expected %d", search, len(found), len(expected))
+	}
+
+	return nil
+}
+
+// overlaps is a deliberately separate copy of the intersection test, so that the brute-force search doesn't
+// depend on the code being tested.
+func overlaps(a geom.Rect, b geom.Rect) bool {
+	return a.Min.X <= b.Max.X && a.Max.X >= b.Min.X && a.Min.Y <= b.Max.Y && a.Max.Y >= b.Min.Y
+}
+
+// checkRTree returns an error if any of the nodes in 'tree' have too many (or, except for the root, too few)
+// entries, have bounds that don't match their entries or the wrong parent, or if the leaves are not all at
+// the same depth.
+func checkRTree(tree *rtree) error {
+
+	if tree.root.parent != nil {
+		return fmt.Errorf("Root node has a parent")
+	}
+
+	leaf_depth := -1
+
+	var check func(n *rtreeNode, depth int) error
+
+	check = func(n *rtreeNode, depth int) error {
+
+		if n.len() > rtreeMaxEntries {
+			return fmt.Errorf("Node at depth %d has %d entries", depth, n.len())
+		}
+
+		if n != tree.root && n.len() < rtreeMinEntries {
+			return fmt.Errorf("Node at depth %d has %d entries", depth, n.len())
+		}
+
+		bounds := geom.NilRect()
+
+		for i := 0; i < n.len(); i++ {
+			bounds.ExpandToContainRect(n.entryBounds(i))
+		}
+
+		if n.len() > 0 && bounds != n.bounds {
+			return fmt.Errorf("Node at depth %d has bounds %v, expected %v", depth, n.bounds, bounds)
+		}
+
+		if n.leaf {
+
+			if leaf_depth == -1 {
+				leaf_depth = depth
+			}
+
+			if depth != leaf_depth {
+				return fmt.Errorf("Leaf at depth %d, expected %d", depth, leaf_depth)
+			}
+
+			return nil
+		}
+
+		for _, child := range n.children {
+
+			if child.parent != n {
+				return fmt.Errorf("Node at depth %d has the wrong parent", depth+1)
+			}
+
+			err := check(child, depth+1)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return check(tree.root, 0)
+}
@@ -0,0 +1,169 @@
+package mapping
+
+import (
+	"fmt"
+	"github.com/sfomuseum/go-edtf"
+	"github.com/sfomuseum/go-edtf/parser"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"strconv"
+)
+
+// MappedFeature is a geojson.Feature whose ID, name and placetype (and SPR properties) are derived
+// using a PropertyMapping. Any properties that are not mapped, or are missing, are derived from the
+// underlying feature.
+type MappedFeature struct {
+	geojson.Feature
+	id        string
+	name      string
+	placetype string
+	inception *edtf.EDTFDate
+	cessation *edtf.EDTFDate
+	country   string
+	repo      string
+}
+
+// MappedStandardPlacesResult is a spr.StandardPlacesResult for a MappedFeature.
+type MappedStandardPlacesResult struct {
+	spr.StandardPlacesResult
+	feature      *MappedFeature
+	max_latitude float64
+}
+
+// NewMappedFeature returns a new MappedFeature instance for 'f' using the property mapping defined
+// by 'm'. It returns an error if the (mapped) ID of 'f' is not an integer or if its (mapped) inception
+// or cessation dates are not valid EDTF strings.
+func NewMappedFeature(f geojson.Feature, m *PropertyMapping) (geojson.Feature, error) {
+
+	if m == nil {
+		m = &PropertyMapping{}
+	}
+
+	body := f.Bytes()
+
+	lookup := func(path string, d string) string {
+
+		if path == "" {
+			return d
+		}
+
+		rsp := gjson.GetBytes(body, path)
+
+		if !rsp.Exists() || rsp.String() == "" {
+			return d
+		}
+
+		return rsp.String()
+	}
+
+	id := lookup(m.Id, f.Id())
+
+	// The rtree and spr tables, and the code that retrieves SPR records for results,
+	// all assume integer IDs
+
+	_, err := strconv.ParseInt(id, 10, 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("Feature ID '%s' is not an integer", id)
+	}
+
+	inception, err := parser.ParseString(lookup(m.Inception, edtf.UNSPECIFIED))
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid inception date for feature %s, %v", id, err)
+	}
+
+	cessation, err := parser.ParseString(lookup(m.Cessation, edtf.UNSPECIFIED))
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cessation date for feature %s, %v", id, err)
+	}
+
+	mf := &MappedFeature{
+		Feature:   f,
+		id:        id,
+		name:      lookup(m.Name, f.Name()),
+		placetype: lookup(m.Placetype, f.Placetype()),
+		inception: inception,
+		cessation: cessation,
+		country:   lookup(m.Country, ""),
+		repo:      lookup(m.Repo, ""),
+	}
+
+	return mf, nil
+}
+
+func (f *MappedFeature) Id() string {
+	return f.id
+}
+
+func (f *MappedFeature) Name() string {
+	return f.name
+}
+
+func (f *MappedFeature) Placetype() string {
+	return f.placetype
+}
+
+func (f *MappedFeature) SPR() (spr.StandardPlacesResult, error) {
+
+	s, err := f.Feature.SPR()
+
+	if err != nil {
+		return nil, err
+	}
+
+	bboxes, err := f.BoundingBoxes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	mapped_s := &MappedStandardPlacesResult{
+		StandardPlacesResult: s,
+		feature:              f,
+		max_latitude:         bboxes.MBR().Max.Y,
+	}
+
+	return mapped_s, nil
+}
+
+func (s *MappedStandardPlacesResult) Id() string {
+	return s.feature.id
+}
+
+func (s *MappedStandardPlacesResult) Name() string {
+	return s.feature.name
+}
+
+func (s *MappedStandardPlacesResult) Placetype() string {
+	return s.feature.placetype
+}
+
+func (s *MappedStandardPlacesResult) Inception() *edtf.EDTFDate {
+	return s.feature.inception
+}
+
+func (s *MappedStandardPlacesResult) Cessation() *edtf.EDTFDate {
+	return s.feature.cessation
+}
+
+func (s *MappedStandardPlacesResult) Country() string {
+
+	if s.feature.country == "" {
+		return s.StandardPlacesResult.Country()
+	}
+
+	return s.feature.country
+}
+
+func (s *MappedStandardPlacesResult) Repo() string {
+	return s.feature.repo
+}
+
+// MaxLatitude returns the maximum latitude of the feature's bounding box. The go-whosonfirst-geojson-v2
+// GeoJSONStandardPlacesResult returns the centroid latitude instead.
+func (s *MappedStandardPlacesResult) MaxLatitude() float64 {
+	return s.max_latitude
+}
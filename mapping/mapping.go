@@ -0,0 +1,111 @@
+// Package mapping provides methods for mapping the properties of "plain old" GeoJSON features
+// on to the properties of a Who's On First Standard Places Response (SPR).
+package mapping
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/flags"
+	"io"
+	"os"
+)
+
+// PropertyMapping defines which properties in a "plain old" GeoJSON feature map to the properties of
+// a Standard Places Response (SPR). Each value is a tidwall/gjson path that is evaluated against the
+// entire feature, for example "properties.BUILDING_ID" or "id". Empty values are ignored.
+type PropertyMapping struct {
+	Id        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Placetype string `json:"placetype,omitempty"`
+	Inception string `json:"inception,omitempty"`
+	Cessation string `json:"cessation,omitempty"`
+	Country   string `json:"country,omitempty"`
+	Repo      string `json:"repo,omitempty"`
+}
+
+// NewPropertyMappingFromFile returns a new PropertyMapping instance derived from the JSON-encoded
+// file 'path'.
+func NewPropertyMappingFromFile(path string) (*PropertyMapping, error) {
+
+	fh, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer fh.Close()
+
+	return NewPropertyMappingFromReader(fh)
+}
+
+// NewPropertyMappingFromReader returns a new PropertyMapping instance derived from the JSON-encoded
+// body of 'r'.
+func NewPropertyMappingFromReader(r io.Reader) (*PropertyMapping, error) {
+
+	var m *PropertyMapping
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&m)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode property mapping, %v", err)
+	}
+
+	return m, nil
+}
+
+// NewPropertyMappingWithFlagSet returns a new PropertyMapping instance derived from the values in 'fs'.
+// Values assigned by individual -property-mapping-* flags take precedence over those defined in the
+// -property-mapping file. If no mapping flags are set it returns nil.
+func NewPropertyMappingWithFlagSet(fs *flag.FlagSet) (*PropertyMapping, error) {
+
+	path, err := lookup.StringVar(fs, flags.PROPERTY_MAPPING)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := &PropertyMapping{}
+
+	if path != "" {
+
+		m, err = NewPropertyMappingFromFile(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load property mapping from %s, %v", path, err)
+		}
+	}
+
+	overrides := map[string]*string{
+		flags.PROPERTY_MAPPING_ID:        &m.Id,
+		flags.PROPERTY_MAPPING_NAME:      &m.Name,
+		flags.PROPERTY_MAPPING_PLACETYPE: &m.Placetype,
+		flags.PROPERTY_MAPPING_INCEPTION: &m.Inception,
+		flags.PROPERTY_MAPPING_CESSATION: &m.Cessation,
+		flags.PROPERTY_MAPPING_COUNTRY:   &m.Country,
+		flags.PROPERTY_MAPPING_REPO:      &m.Repo,
+	}
+
+	for k, ptr := range overrides {
+
+		v, err := lookup.StringVar(fs, k)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if v != "" {
+			*ptr = v
+		}
+	}
+
+	if *m == (PropertyMapping{}) {
+		return nil, nil
+	}
+
+	return m, nil
+}
@@ -0,0 +1,239 @@
+package mapping
+
+import (
+	"flag"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/flags"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A "plain old" GeoJSON feature whose geometry is a rectangle from (0, 0) to (10, 20).
+const plainFeature string = `{
+  "type": "Feature",
+  "id": 1234,
+  "properties": {
+    "building_id": "5678",
+    "label": "Tower",
+    "kind": "building",
+    "opened": "1970-05",
+    "closed": "..",
+    "bad_date": "last tuesday",
+    "cc": "CA",
+    "source": "example"
+  },
+  "geometry": {
+    "type": "Polygon",
+    "coordinates": [
+      [[0.0, 0.0], [10.0, 0.0], [10.0, 20.0], [0.0, 20.0], [0.0, 0.0]]
+    ]
+  }
+}`
+
+func TestNewPropertyMappingWithFlagSet(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "mapping")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "mapping.json")
+
+	err = ioutil.WriteFile(path, []byte(`{"id": "properties.building_id", "name": "properties.label", "country": "properties.cc"}`), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write property mapping, %v", err)
+	}
+
+	invalid_path := filepath.Join(root, "invalid.json")
+
+	err = ioutil.WriteFile(invalid_path, []byte(`{"identifier": "properties.building_id"}`), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write property mapping, %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected *PropertyMapping
+		invalid  bool
+	}{
+		{
+			name:     "none",
+			args:     []string{},
+			expected: nil,
+		},
+		{
+			name:     "flags",
+			args:     []string{"-property-mapping-name", "properties.label", "-property-mapping-placetype", "properties.kind"},
+			expected: &PropertyMapping{Name: "properties.label", Placetype: "properties.kind"},
+		},
+		{
+			name:     "file",
+			args:     []string{"-property-mapping", path},
+			expected: &PropertyMapping{Id: "properties.building_id", Name: "properties.label", Country: "properties.cc"},
+		},
+		{
+			name:     "flags override file",
+			args:     []string{"-property-mapping", path, "-property-mapping-name", "properties.kind", "-property-mapping-repo", "properties.source"},
+			expected: &PropertyMapping{Id: "properties.building_id", Name: "properties.kind", Country: "properties.cc", Repo: "properties.source"},
+		},
+		{
+			name:    "unknown property in file",
+			args:    []string{"-property-mapping", invalid_path},
+			invalid: true,
+		},
+		{
+			name:    "missing file",
+			args:    []string{"-property-mapping", filepath.Join(root, "missing.json")},
+			invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+		err := flags.AppendPropertyMappingFlags(fs)
+
+		if err != nil {
+			t.Fatalf("%s: failed to append flags, %v", test.name, err)
+		}
+
+		err = fs.Parse(test.args)
+
+		if err != nil {
+			t.Fatalf("%s: failed to parse flags, %v", test.name, err)
+		}
+
+		m, err := NewPropertyMappingWithFlagSet(fs)
+
+		if test.invalid {
+
+			if err == nil {
+				t.Fatalf("%s: expected property mapping to be invalid", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: failed to create property mapping, %v", test.name, err)
+		}
+
+		if test.expected == nil {
+
+			if m != nil {
+				t.Fatalf("%s: expected no property mapping but got %v", test.name, m)
+			}
+
+			continue
+		}
+
+		if m == nil || *m != *test.expected {
+			t.Fatalf("%s: expected %v but got %v", test.name, test.expected, m)
+		}
+	}
+}
+
+func TestNewMappedFeature(t *testing.T) {
+
+	f, err := feature.LoadFeature([]byte(plainFeature))
+
+	if err != nil {
+		t.Fatalf("Failed to load feature, %v", err)
+	}
+
+	m := &PropertyMapping{
+		Id:        "properties.building_id",
+		Name:      "properties.label",
+		Placetype: "properties.kind",
+		Inception: "properties.opened",
+		Cessation: "properties.closed",
+		Country:   "properties.cc",
+		Repo:      "properties.source",
+	}
+
+	mf, err := NewMappedFeature(f, m)
+
+	if err != nil {
+		t.Fatalf("Failed to create mapped feature, %v", err)
+	}
+
+	s, err := mf.SPR()
+
+	if err != nil {
+		t.Fatalf("Failed to create SPR, %v", err)
+	}
+
+	tests := map[string][2]string{
+		"id":        {s.Id(), "5678"},
+		"name":      {s.Name(), "Tower"},
+		"placetype": {s.Placetype(), "building"},
+		"inception": {s.Inception().String(), "1970-05"},
+		"cessation": {s.Cessation().String(), ".."},
+		"country":   {s.Country(), "CA"},
+		"repo":      {s.Repo(), "example"},
+	}
+
+	for k, v := range tests {
+
+		if v[0] != v[1] {
+			t.Fatalf("Expected %s to be '%s' but got '%s'", k, v[1], v[0])
+		}
+	}
+
+	// The go-whosonfirst-geojson-v2 SPR returns the centroid latitude for MaxLatitude
+
+	if s.MinLatitude() != 0.0 || s.MaxLatitude() != 20.0 {
+		t.Fatalf("Expected latitudes to be 0 to 20 but got %f to %f", s.MinLatitude(), s.MaxLatitude())
+	}
+
+	if s.MinLongitude() != 0.0 || s.MaxLongitude() != 10.0 {
+		t.Fatalf("Expected longitudes to be 0 to 10 but got %f to %f", s.MinLongitude(), s.MaxLongitude())
+	}
+
+	// Properties that aren't mapped, or are missing, fall back to the feature's own values
+
+	mf, err = NewMappedFeature(f, &PropertyMapping{Name: "properties.missing"})
+
+	if err != nil {
+		t.Fatalf("Failed to create mapped feature, %v", err)
+	}
+
+	if mf.Id() != "1234" {
+		t.Fatalf("Expected unmapped ID to be 1234 but got %s", mf.Id())
+	}
+
+	_, err = NewMappedFeature(f, nil)
+
+	if err != nil {
+		t.Fatalf("Failed to create mapped feature without a property mapping, %v", err)
+	}
+
+	invalid := map[string]*PropertyMapping{
+		"non-integer ID":    {Id: "properties.label"},
+		"invalid inception": {Inception: "properties.bad_date"},
+		"invalid cessation": {Cessation: "properties.bad_date"},
+	}
+
+	for name, m := range invalid {
+
+		_, err := NewMappedFeature(f, m)
+
+		if err == nil {
+			t.Fatalf("Expected %s to fail", name)
+		}
+
+		if !strings.Contains(err.Error(), "1234") && !strings.Contains(err.Error(), "Tower") {
+			t.Fatalf("Expected error for %s to identify the feature, got %v", name, err)
+		}
+	}
+}
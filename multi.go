@@ -0,0 +1,451 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/skelterjohn/geom"
+	wof_geojson "github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/timeout"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"io"
+	"net/url"
+	"sort"
+)
+
+func init() {
+	ctx := context.Background()
+	database.RegisterSpatialDatabase(ctx, "multi", NewMultiSpatialDatabase)
+}
+
+// MultiSpatialDatabase is a database.SpatialDatabase implementation that wraps one or more other spatial
+// databases, querying all of them concurrently and merging their results. Results for the same feature
+// (and alternate geometry) returned by more than one database are only included once. It is read-only;
+// features must be indexed by the databases it wraps.
+type MultiSpatialDatabase struct {
+	database.SpatialDatabase
+	databases []database.SpatialDatabase
+}
+
+// NewMultiSpatialDatabase returns a new MultiSpatialDatabase instance configured by 'uri' which is expected
+// to take the form of:
+//
+//	multi://?database={URI}&database={URI}
+//
+// Where each {URI} is a (URL-escaped) valid database.SpatialDatabase URI.
+func NewMultiSpatialDatabase(ctx context.Context, uri string) (database.SpatialDatabase, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+
+	uris := q["database"]
+
+	if len(uris) == 0 {
+		return nil, errors.New("Missing 'database' parameter")
+	}
+
+	databases := make([]database.SpatialDatabase, 0)
+
+	for _, db_uri := range uris {
+
+		db, err := database.NewSpatialDatabase(ctx, db_uri)
+
+		if err != nil {
+
+			for _, other := range databases {
+				other.Disconnect(ctx)
+			}
+
+			return nil, fmt.Errorf("Failed to create spatial database for '%s', %v", db_uri, err)
+		}
+
+		databases = append(databases, db)
+	}
+
+	return NewMultiSpatialDatabaseWithDatabases(ctx, databases...)
+}
+
+// NewMultiSpatialDatabaseWithDatabases returns a new MultiSpatialDatabase instance wrapping 'databases'.
+func NewMultiSpatialDatabaseWithDatabases(ctx context.Context, databases ...database.SpatialDatabase) (database.SpatialDatabase, error) {
+
+	if len(databases) == 0 {
+		return nil, errors.New("No spatial databases")
+	}
+
+	db := &MultiSpatialDatabase{
+		databases: databases,
+	}
+
+	return db, nil
+}
+
+func (m *MultiSpatialDatabase) Disconnect(ctx context.Context) error {
+
+	errs := make([]string, 0)
+
+	for _, db := range m.databases {
+
+		err := db.Disconnect(ctx)
+
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Failed to disconnect one or more databases, %v", errs)
+	}
+
+	return nil
+}
+
+func (m *MultiSpatialDatabase) IndexFeature(ctx context.Context, f wof_geojson.Feature) error {
+	return errors.New("Multi spatial databases are read-only, features must be indexed by the databases they wrap")
+}
+
+func (m *MultiSpatialDatabase) PointInPolygon(ctx context.Context, coord *geom.Coord, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	query := func(ctx context.Context, db database.SpatialDatabase) (spr.StandardPlacesResults, error) {
+		return db.PointInPolygon(ctx, coord, filters...)
+	}
+
+	return m.queryAll(ctx, m.databases, query, false)
+}
+
+func (m *MultiSpatialDatabase) PointInPolygonWithChannels(ctx context.Context, rsp_ch chan spr.StandardPlacesResult, err_ch chan error, done_ch chan bool, coord *geom.Coord, filters ...spatial.Filter) {
+
+	defer func() {
+		timeout.SendDone(ctx, done_ch)
+	}()
+
+	rsp, err := m.PointInPolygon(ctx, coord, filters...)
+
+	if err != nil {
+		timeout.SendError(ctx, err_ch, err)
+		return
+	}
+
+	for _, r := range rsp.Results() {
+
+		select {
+		case <-ctx.Done():
+			return
+		case rsp_ch <- r:
+			// pass
+		}
+	}
+}
+
+func (m *MultiSpatialDatabase) PointInPolygonCandidates(ctx context.Context, coord *geom.Coord, filters ...spatial.Filter) ([]*spatial.PointInPolygonCandidate, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type candidates_rsp struct {
+		index      int
+		candidates []*spatial.PointInPolygonCandidate
+		err        error
+	}
+
+	rsp_ch := make(chan *candidates_rsp)
+
+	for i, db := range m.databases {
+
+		go func(i int, db database.SpatialDatabase) {
+
+			c, err := db.PointInPolygonCandidates(ctx, coord, filters...)
+
+			select {
+			case <-ctx.Done():
+				// pass
+			case rsp_ch <- &candidates_rsp{index: i, candidates: c, err: err}:
+				// pass
+			}
+
+		}(i, db)
+	}
+
+	results := make([][]*spatial.PointInPolygonCandidate, len(m.databases))
+
+	for remaining := len(m.databases); remaining > 0; remaining-- {
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case rsp := <-rsp_ch:
+
+			if rsp.err != nil {
+				return nil, rsp.err
+			}
+
+			results[rsp.index] = rsp.candidates
+		}
+	}
+
+	candidates := make([]*spatial.PointInPolygonCandidate, 0)
+	seen := make(map[string]bool)
+
+	for _, possible := range results {
+
+		for _, c := range possible {
+
+			key := fmt.Sprintf("%s#%s#%s", c.FeatureId, c.AltLabel, c.Id)
+
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			candidates = append(candidates, c)
+		}
+	}
+
+	return candidates, nil
+}
+
+func (m *MultiSpatialDatabase) PointInPolygonCandidatesWithChannels(ctx context.Context, rsp_ch chan *spatial.PointInPolygonCandidate, err_ch chan error, done_ch chan bool, coord *geom.Coord, filters ...spatial.Filter) {
+
+	defer func() {
+		timeout.SendDone(ctx, done_ch)
+	}()
+
+	candidates, err := m.PointInPolygonCandidates(ctx, coord, filters...)
+
+	if err != nil {
+		timeout.SendError(ctx, err_ch, err)
+		return
+	}
+
+	for _, c := range candidates {
+
+		select {
+		case <-ctx.Done():
+			return
+		case rsp_ch <- c:
+			// pass
+		}
+	}
+}
+
+type distanceDatabase interface {
+	PointInPolygonWithDistance(context.Context, *geom.Coord, float64, float64, ...spatial.Filter) (spr.StandardPlacesResults, error)
+}
+
+type nearbyDatabase interface {
+	Nearby(context.Context, *geom.Coord, int, float64, ...spatial.Filter) (spr.StandardPlacesResults, error)
+}
+
+// PointInPolygonWithDistance performs a radius and/or boundary tolerance query against every database that
+// supports them, skipping the ones that don't. It returns an error if none of them do. Results are sorted by
+// distance.
+func (m *MultiSpatialDatabase) PointInPolygonWithDistance(ctx context.Context, coord *geom.Coord, radius float64, tolerance float64, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	databases := make([]database.SpatialDatabase, 0)
+
+	for _, db := range m.databases {
+
+		_, ok := db.(distanceDatabase)
+
+		if ok {
+			databases = append(databases, db)
+		}
+	}
+
+	if len(databases) == 0 {
+		return nil, errors.New("None of the spatial databases support radius or tolerance queries")
+	}
+
+	query := func(ctx context.Context, db database.SpatialDatabase) (spr.StandardPlacesResults, error) {
+		return db.(distanceDatabase).PointInPolygonWithDistance(ctx, coord, radius, tolerance, filters...)
+	}
+
+	return m.queryAll(ctx, databases, query, true)
+}
+
+// Nearby performs a nearby query against every database that supports them, skipping the ones that don't. It
+// returns an error if none of them do. Results are sorted by distance and, if 'limit' is greater than 0, no more
+// than 'limit' results are returned.
+func (m *MultiSpatialDatabase) Nearby(ctx context.Context, coord *geom.Coord, limit int, radius float64, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	databases := make([]database.SpatialDatabase, 0)
+
+	for _, db := range m.databases {
+
+		_, ok := db.(nearbyDatabase)
+
+		if ok {
+			databases = append(databases, db)
+		}
+	}
+
+	if len(databases) == 0 {
+		return nil, errors.New("None of the spatial databases support nearby queries")
+	}
+
+	query := func(ctx context.Context, db database.SpatialDatabase) (spr.StandardPlacesResults, error) {
+		return db.(nearbyDatabase).Nearby(ctx, coord, limit, radius, filters...)
+	}
+
+	rsp, err := m.queryAll(ctx, databases, query, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := rsp.Results()
+
+	if limit > 0 && len(results) > limit {
+		results = results[0:limit]
+	}
+
+	nearby_results := &NearbyResults{
+		Places: results,
+	}
+
+	return nearby_results, nil
+}
+
+type multiQueryFunc func(context.Context, database.SpatialDatabase) (spr.StandardPlacesResults, error)
+
+// queryAll runs 'query' against each of 'databases' concurrently and merges the results, in database order, removing
+// duplicates. If 'by_distance' is true the merged results are sorted by distance and, for duplicates, the result
+// with the shortest distance is kept.
+func (m *MultiSpatialDatabase) queryAll(ctx context.Context, databases []database.SpatialDatabase, query multiQueryFunc, by_distance bool) (spr.StandardPlacesResults, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type query_rsp struct {
+		index   int
+		results spr.StandardPlacesResults
+		err     error
+	}
+
+	rsp_ch := make(chan *query_rsp)
+
+	for i, db := range databases {
+
+		go func(i int, db database.SpatialDatabase) {
+
+			rsp, err := query(ctx, db)
+
+			select {
+			case <-ctx.Done():
+				// pass
+			case rsp_ch <- &query_rsp{index: i, results: rsp, err: err}:
+				// pass
+			}
+
+		}(i, db)
+	}
+
+	responses := make([]spr.StandardPlacesResults, len(databases))
+
+	for remaining := len(databases); remaining > 0; remaining-- {
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case rsp := <-rsp_ch:
+
+			if rsp.err != nil {
+				return nil, rsp.err
+			}
+
+			responses[rsp.index] = rsp.results
+		}
+	}
+
+	places := make([]spr.StandardPlacesResult, 0)
+
+	for _, rsp := range responses {
+		places = append(places, rsp.Results()...)
+	}
+
+	if by_distance {
+
+		sort.SliceStable(places, func(i, j int) bool {
+			return resultDistance(places[i]) < resultDistance(places[j])
+		})
+	}
+
+	merged := make([]spr.StandardPlacesResult, 0)
+	seen := make(map[string]bool)
+
+	for _, s := range places {
+
+		path := s.Path()
+
+		if seen[path] {
+			continue
+		}
+
+		seen[path] = true
+		merged = append(merged, s)
+	}
+
+	results := &SQLiteResults{
+		Places: merged,
+	}
+
+	return results, nil
+}
+
+func resultDistance(s spr.StandardPlacesResult) float64 {
+
+	switch r := s.(type) {
+	case *PointInPolygonResult:
+		return r.Distance
+	case *NearbyResult:
+		return r.Distance
+	default:
+		return 0.0
+	}
+}
+
+// whosonfirst/go-reader interface
+
+// Read returns the body of 'str_uri' from the first database, in the order they were defined, that contains it.
+func (m *MultiSpatialDatabase) Read(ctx context.Context, str_uri string) (io.ReadSeekCloser, error) {
+
+	var last_err error
+
+	for _, db := range m.databases {
+
+		fh, err := db.Read(ctx, str_uri)
+
+		if err != nil {
+			last_err = err
+			continue
+		}
+
+		return fh, nil
+	}
+
+	return nil, fmt.Errorf("Failed to read %s from any database, %v", str_uri, last_err)
+}
+
+func (m *MultiSpatialDatabase) ReaderURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+// whosonfirst/go-writer interface
+
+func (m *MultiSpatialDatabase) Write(ctx context.Context, key string, fh io.ReadSeeker) (int64, error) {
+	return 0, fmt.Errorf("Not implemented")
+}
+
+func (m *MultiSpatialDatabase) WriterURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+func (m *MultiSpatialDatabase) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,301 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	_ "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/inmemory"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMultiPointInPolygon(t *testing.T) {
+
+	ctx := context.Background()
+
+	// 1006 is indexed by both databases
+
+	db, err := newMultiDatabase(ctx, []string{"1001", "1006"}, []string{"1006", "1002"})
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	tests := []struct {
+		name      string
+		longitude float64
+		latitude  float64
+		expected  []string
+	}{
+		{name: "both databases", longitude: 12.0, latitude: 12.0, expected: []string{"1001", "1006"}},
+		{name: "duplicate", longitude: 22.0, latitude: 22.0, expected: []string{"1006"}},
+		{name: "second database", longitude: 31.0, latitude: 11.0, expected: []string{"1002"}},
+		{name: "none", longitude: -50.0, latitude: -50.0, expected: []string{}},
+	}
+
+	for _, test := range tests {
+
+		coord, err := geo.NewCoordinate(test.longitude, test.latitude)
+
+		if err != nil {
+			t.Fatalf("%s: failed to create coordinate, %v", test.name, err)
+		}
+
+		rsp, err := db.PointInPolygon(ctx, coord)
+
+		if err != nil {
+			t.Fatalf("%s: point in polygon query failed, %v", test.name, err)
+		}
+
+		ids := make([]string, 0)
+
+		for _, r := range rsp.Results() {
+			ids = append(ids, r.Id())
+		}
+
+		sort.Strings(ids)
+
+		if strings.Join(ids, ",") != strings.Join(test.expected, ",") {
+			t.Fatalf("%s: expected %v but got %v", test.name, test.expected, ids)
+		}
+	}
+}
+
+func TestMultiRead(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := newMultiDatabase(ctx, []string{"1001", "1006"}, []string{"1006", "1002"})
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{uri: "1001.geojson", expected: "1001"},
+		{uri: "1006.geojson", expected: "1006"},
+		{uri: "1002.geojson", expected: "1002"},
+		{uri: "1003.geojson", expected: ""},
+	}
+
+	for _, test := range tests {
+
+		fh, err := db.Read(ctx, test.uri)
+
+		if test.expected == "" {
+
+			if err == nil {
+				fh.Close()
+				t.Fatalf("Expected reading %s to fail", test.uri)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", test.uri, err)
+		}
+
+		body, err := ioutil.ReadAll(fh)
+		fh.Close()
+
+		if err != nil {
+			t.Fatalf("Failed to read body of %s, %v", test.uri, err)
+		}
+
+		if !strings.Contains(string(body), `"wof:id": `+test.expected) {
+			t.Fatalf("Expected reading %s to return %s", test.uri, test.expected)
+		}
+	}
+}
+
+func TestMultiNearby(t *testing.T) {
+
+	ctx := context.Background()
+
+	origin, err := geo.NewCoordinate(0.0, 0.0)
+
+	if err != nil {
+		t.Fatalf("Failed to create coordinate, %v", err)
+	}
+
+	// In-memory databases share a cache so, to be distinct, these need to be files
+
+	root, err := ioutil.TempDir("", "multi")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	first_uri := fmt.Sprintf("sqlite://?dsn=%s", url.QueryEscape(filepath.Join(root, "first.db")))
+	second_uri := fmt.Sprintf("sqlite://?dsn=%s", url.QueryEscape(filepath.Join(root, "second.db")))
+
+	first_features, err := nearbyFeatures(nearby_fixtures...)
+
+	if err != nil {
+		t.Fatalf("Failed to create features, %v", err)
+	}
+
+	first, err := spatialtest.NewDatabaseWithFeatures(ctx, first_uri, first_features...)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	// Some of the same points as the first database, and one that sorts between them
+
+	second_features, err := nearbyFeatures(
+		nearby_fixtures[1],
+		nearby_fixtures[3],
+		&nearbyFixture{id: 4006, name: "Middle", placetype: "venue", longitude: 0.01, latitude: 0.0},
+	)
+
+	if err != nil {
+		t.Fatalf("Failed to create features, %v", err)
+	}
+
+	second, err := spatialtest.NewDatabaseWithFeatures(ctx, second_uri, second_features...)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	// Databases that don't support nearby queries are skipped
+
+	third, err := database.NewSpatialDatabase(ctx, "inmemory://")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	db, err := NewMultiSpatialDatabaseWithDatabases(ctx, first, second, third)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	tests := []struct {
+		name     string
+		limit    int
+		radius   float64
+		expected []string
+	}{
+		{name: "limit", limit: 3, expected: []string{"Origin", "Near", "Middle"}},
+		{name: "limit (all)", limit: 10, expected: []string{"Origin", "Near", "Middle", "Town", "Far", "Antipode"}},
+		{name: "radius", radius: 2000.0, expected: []string{"Origin", "Near", "Middle"}},
+	}
+
+	for _, test := range tests {
+
+		rsp, err := db.(*MultiSpatialDatabase).Nearby(ctx, origin, test.limit, test.radius)
+
+		if err != nil {
+			t.Fatalf("%s: nearby query failed, %v", test.name, err)
+		}
+
+		names := make([]string, 0)
+		last_distance := -1.0
+
+		for _, r := range rsp.Results() {
+
+			d := r.(*NearbyResult).Distance
+
+			if d < last_distance {
+				t.Fatalf("%s: results are not sorted by distance", test.name)
+			}
+
+			last_distance = d
+			names = append(names, r.Name())
+		}
+
+		if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+			t.Fatalf("%s: expected %v but got %v", test.name, test.expected, names)
+		}
+	}
+
+	// Make sure the results were merged from both databases, rather than the first one containing every point
+
+	rsp, err := first.(*SQLiteSpatialDatabase).Nearby(ctx, origin, 10, 0.0)
+
+	if err != nil {
+		t.Fatalf("Nearby query failed, %v", err)
+	}
+
+	if len(rsp.Results()) != len(nearby_fixtures) {
+		t.Fatalf("Expected first database to return %d results but got %d", len(nearby_fixtures), len(rsp.Results()))
+	}
+}
+
+func TestMultiNearbyUnsupported(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := newMultiDatabase(ctx, []string{"1005"}, []string{"1008"})
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	coord, err := geo.NewCoordinate(12.0, 12.0)
+
+	if err != nil {
+		t.Fatalf("Failed to create coordinate, %v", err)
+	}
+
+	_, err = db.(*MultiSpatialDatabase).Nearby(ctx, coord, 1, 0.0)
+
+	if err == nil {
+		t.Fatalf("Expected nearby query to fail when no database supports them")
+	}
+
+	_, err = db.(*MultiSpatialDatabase).PointInPolygonWithDistance(ctx, coord, 1000.0, 0.0)
+
+	if err == nil {
+		t.Fatalf("Expected radius query to fail when no database supports them")
+	}
+}
+
+// newMultiDatabase returns a multi database wrapping an inmemory:// database for each of 'ids', which list the
+// spatialtest fixtures to index in it.
+func newMultiDatabase(ctx context.Context, ids ...[]string) (database.SpatialDatabase, error) {
+
+	databases := make([]database.SpatialDatabase, 0)
+
+	for _, db_ids := range ids {
+
+		db, err := spatialtest.NewFixturesDatabase(ctx, "inmemory://", db_ids...)
+
+		if err != nil {
+
+			for _, db := range databases {
+				db.Disconnect(ctx)
+			}
+
+			return nil, err
+		}
+
+		databases = append(databases, db)
+	}
+
+	return NewMultiSpatialDatabaseWithDatabases(ctx, databases...)
+}
@@ -0,0 +1,278 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/skelterjohn/geom"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/timeout"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	sqlite_spr "github.com/whosonfirst/go-whosonfirst-sqlite-spr"
+	"sort"
+)
+
+// The radius, in metres, of the first search performed when looking for the nearest features without
+// an explicit radius. Each subsequent search multiplies the radius by NEARBY_RADIUS_FACTOR.
+const NEARBY_INITIAL_RADIUS float64 = 1000.0
+
+const NEARBY_RADIUS_FACTOR float64 = 4.0
+
+// NearbyResult is a SQLiteStandardPlacesResult annotated with its distance, in metres, from the coordinate
+// being queried.
+type NearbyResult struct {
+	*sqlite_spr.SQLiteStandardPlacesResult
+	Distance float64 `json:"spatial:distance"`
+}
+
+type NearbyResults struct {
+	spr.StandardPlacesResults `json:",omitempty"`
+	Places                    []spr.StandardPlacesResult `json:"places"`
+}
+
+func (r *NearbyResults) Results() []spr.StandardPlacesResult {
+	return r.Places
+}
+
+type nearbyPoint struct {
+	path     string
+	distance float64
+}
+
+// Nearby returns the point features closest to 'coord', sorted by distance, that match 'filters'. If 'radius'
+// is greater than 0 only features within that many metres of 'coord' are returned. If 'limit' is greater than
+// 0 no more than that many features are returned. At least one of 'limit' or 'radius' must be greater than 0.
+func (r *SQLiteSpatialDatabase) Nearby(ctx context.Context, coord *geom.Coord, limit int, radius float64, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	if limit < 0 {
+		return nil, fmt.Errorf("Invalid limit '%d'", limit)
+	}
+
+	if radius < 0 {
+		return nil, fmt.Errorf("Invalid radius '%f'", radius)
+	}
+
+	if limit == 0 && radius == 0 {
+		return nil, errors.New("Nearby queries require a limit or a radius")
+	}
+
+	ctx, cancel := timeout.WithQueryTimeout(ctx, r.query_timeout)
+	defer cancel()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var results []*NearbyResult
+	var err error
+
+	if radius > 0 {
+
+		results, err = r.nearbyWithinRadius(ctx, coord, 0.0, radius, limit, filters...)
+
+		if err != nil {
+			return nil, err
+		}
+
+	} else {
+
+		// Without a radius there is no way to know in advance how far away the nearest
+		// features are so keep widening the search until there are enough results or
+		// the search covers the whole world. Every point within the previous radius
+		// has already been considered so each search only looks at the points beyond
+		// it, which are all further away than the results found so far.
+
+		results = make([]*NearbyResult, 0)
+
+		inner := 0.0
+		search := NEARBY_INITIAL_RADIUS
+
+		for {
+
+			more, err := r.nearbyWithinRadius(ctx, coord, inner, search, limit-len(results), filters...)
+
+			if err != nil {
+				return nil, err
+			}
+
+			results = append(results, more...)
+
+			if len(results) >= limit || search >= geo.MAX_DISTANCE {
+				break
+			}
+
+			inner = search
+			search = search * NEARBY_RADIUS_FACTOR
+		}
+	}
+
+	if limit > 0 && len(results) > limit {
+		results = results[0:limit]
+	}
+
+	places := make([]spr.StandardPlacesResult, len(results))
+
+	for i, rsp := range results {
+		places[i] = rsp
+	}
+
+	nearby_results := &NearbyResults{
+		Places: places,
+	}
+
+	return nearby_results, nil
+}
+
+// nearbyWithinRadius returns the features, sorted by distance, whose points are more than 'inner' metres and no
+// more than 'outer' metres from 'coord' and that match 'filters'. If 'inner' is 0 then points at 'coord' are
+// included. If 'limit' is greater than 0 then SPRs stop being retrieved once there are that many results.
+func (r *SQLiteSpatialDatabase) nearbyWithinRadius(ctx context.Context, coord *geom.Coord, inner float64, outer float64, limit int, filters ...spatial.Filter) ([]*NearbyResult, error) {
+
+	points, err := r.getPointsWithinRadius(ctx, coord, inner, outer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*NearbyResult, 0)
+
+	for _, pt := range points {
+
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			// pass
+		}
+
+		// Nearby queries may need to consider every point in the database, if their filters
+		// don't match many features, so SPRs are only cached for a limited time rather than
+		// for as long as the database is open
+
+		s, err := retrieveCachedSPRWithExpiration(ctx, r.db, r.spr_table, r.gocache, pt.path, gocache.DefaultExpiration)
+
+		if err != nil {
+			r.Logger.Error("Failed to retrieve feature cache for %s, %v", pt.path, err)
+			continue
+		}
+
+		ok := true
+
+		for _, f := range filters {
+
+			err = filter.FilterSPR(f, s)
+
+			if err != nil {
+				r.Logger.Debug("SKIP %s because filter error %s", pt.path, err)
+				ok = false
+				break
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		rsp := &NearbyResult{
+			SQLiteStandardPlacesResult: s.(*sqlite_spr.SQLiteStandardPlacesResult),
+			Distance:                   pt.distance,
+		}
+
+		results = append(results, rsp)
+	}
+
+	return results, nil
+}
+
+// getPointsWithinRadius returns the points, sorted by distance, that are more than 'inner' metres and no more than
+// 'outer' metres from 'coord'. If 'inner' is 0 then points at 'coord' are included.
+func (r *SQLiteSpatialDatabase) getPointsWithinRadius(ctx context.Context, coord *geom.Coord, inner float64, outer float64) ([]*nearbyPoint, error) {
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf("SELECT wof_id, is_alt, alt_label, min_x, min_y FROM %s WHERE min_x <= ? AND max_x >= ? AND min_y <= ? AND max_y >= ?", r.points_table.Name())
+
+	points := make([]*nearbyPoint, 0)
+	seen := make(map[string]bool)
+
+	for _, rect := range geo.BoundingBoxesForRadius(coord, outer) {
+
+		rows, err := conn.QueryContext(ctx, q, rect.Max.X, rect.Min.X, rect.Max.Y, rect.Min.Y)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+
+			var feature_id string
+			var is_alt int32
+			var alt_label string
+			var x float64
+			var y float64
+
+			err := rows.Scan(&feature_id, &is_alt, &alt_label, &x, &y)
+
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			sp := RTreeSpatialIndex{
+				FeatureId: feature_id,
+			}
+
+			if is_alt == 1 {
+				sp.IsAlt = true
+				sp.AltLabel = alt_label
+			}
+
+			path := sp.Path()
+
+			if seen[path] {
+				continue
+			}
+
+			seen[path] = true
+
+			pt := &geom.Coord{
+				X: x,
+				Y: y,
+			}
+
+			d := geo.Haversine(coord, pt)
+
+			if d > outer || (inner > 0.0 && d <= inner) {
+				continue
+			}
+
+			points = append(points, &nearbyPoint{
+				path:     path,
+				distance: d,
+			})
+		}
+
+		err = rows.Err()
+		rows.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].distance < points[j].distance
+	})
+
+	return points, nil
+}
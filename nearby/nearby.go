@@ -0,0 +1,68 @@
+// Package nearby provides methods for querying spatial databases for the point features closest to a coordinate.
+package nearby
+
+import (
+	"context"
+	"fmt"
+	"github.com/skelterjohn/geom"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial-pip"
+	spatial_app "github.com/whosonfirst/go-whosonfirst-spatial/app"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+)
+
+// The number of results to return if a request does not specify a limit or a radius.
+const DEFAULT_LIMIT int = 10
+
+// NearbyDatabase is an interface for spatial databases that can return the point features closest to a coordinate.
+type NearbyDatabase interface {
+	Nearby(context.Context, *geom.Coord, int, float64, ...spatial.Filter) (spr.StandardPlacesResults, error)
+}
+
+// NearbyRequest is a pip.PointInPolygonRequest with additional properties for limiting the number of results
+// returned and the distance, in metres, that they may be from the coordinate being queried.
+type NearbyRequest struct {
+	pip.PointInPolygonRequest
+	Limit  int     `json:"limit,omitempty"`
+	Radius float64 `json:"radius,omitempty"`
+}
+
+// QueryNearby returns the point features closest to the coordinate defined by 'req'. If neither a limit or
+// a radius are defined then DEFAULT_LIMIT results are returned.
+func QueryNearby(ctx context.Context, app *spatial_app.SpatialApplication, req *NearbyRequest) (spr.StandardPlacesResults, error) {
+
+	db, ok := app.SpatialDatabase.(NearbyDatabase)
+
+	if !ok {
+		return nil, fmt.Errorf("Spatial database does not support nearby queries")
+	}
+
+	if req.Limit < 0 {
+		return nil, fmt.Errorf("Invalid limit '%d'", req.Limit)
+	}
+
+	if req.Radius < 0 {
+		return nil, fmt.Errorf("Invalid radius '%f'", req.Radius)
+	}
+
+	c, err := geo.NewCoordinate(req.Longitude, req.Latitude)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new coordinate, %v", err)
+	}
+
+	f, err := pip.NewSPRFilterFromPointInPolygonRequest(&req.PointInPolygonRequest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+
+	if limit == 0 && req.Radius == 0 {
+		limit = DEFAULT_LIMIT
+	}
+
+	return db.Nearby(ctx, c, limit, req.Radius, f)
+}
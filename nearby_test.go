@@ -0,0 +1,287 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"math"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type nearbyFixture struct {
+	id        int64
+	name      string
+	placetype string
+	longitude float64
+	latitude  float64
+}
+
+// Points at increasing distances east of (0, 0) and one on the other side of the world.
+var nearby_fixtures = []*nearbyFixture{
+	{id: 4001, name: "Origin", placetype: "venue", longitude: 0.0, latitude: 0.0},
+	{id: 4002, name: "Near", placetype: "venue", longitude: 0.005, latitude: 0.0},
+	{id: 4003, name: "Town", placetype: "locality", longitude: 0.05, latitude: 0.0},
+	{id: 4004, name: "Far", placetype: "venue", longitude: 1.0, latitude: 0.0},
+	{id: 4005, name: "Antipode", placetype: "locality", longitude: 179.9, latitude: 0.0},
+}
+
+type nearbyTest struct {
+	name     string
+	limit    int
+	radius   float64
+	query    string
+	expected []string
+}
+
+var nearby_tests = []*nearbyTest{
+	{name: "limit", limit: 2, expected: []string{"Origin", "Near"}},
+	{name: "limit (all)", limit: 10, expected: []string{"Origin", "Near", "Town", "Far", "Antipode"}},
+	{name: "radius", radius: 1000.0, expected: []string{"Origin", "Near"}},
+	{name: "radius and limit", radius: 10000.0, limit: 1, expected: []string{"Origin"}},
+	{name: "radius (large)", radius: 200000.0, expected: []string{"Origin", "Near", "Town", "Far"}},
+	{name: "filter", limit: 1, query: "placetype=locality", expected: []string{"Town"}},
+	{name: "filter (whole world)", limit: 5, query: "placetype=locality", expected: []string{"Town", "Antipode"}},
+	{name: "filter and radius", radius: 1000.0, query: "placetype=locality", expected: []string{}},
+}
+
+func TestNearby(t *testing.T) {
+
+	ctx := context.Background()
+
+	features, err := nearbyFeatures(nearby_fixtures...)
+
+	if err != nil {
+		t.Fatalf("Failed to create features, %v", err)
+	}
+
+	db, err := spatialtest.NewDatabaseWithFeatures(ctx, "sqlite://?dsn=:memory:", features...)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	origin, err := geo.NewCoordinate(0.0, 0.0)
+
+	if err != nil {
+		t.Fatalf("Failed to create coordinate, %v", err)
+	}
+
+	for _, test := range nearby_tests {
+
+		filters := make([]spatial.Filter, 0)
+
+		if test.query != "" {
+
+			q, err := url.ParseQuery(test.query)
+
+			if err != nil {
+				t.Fatalf("%s: failed to parse query, %v", test.name, err)
+			}
+
+			f, err := filter.NewSPRFilterFromQuery(q)
+
+			if err != nil {
+				t.Fatalf("%s: failed to create filter, %v", test.name, err)
+			}
+
+			filters = append(filters, f)
+		}
+
+		rsp, err := sqlite_db.Nearby(ctx, origin, test.limit, test.radius, filters...)
+
+		if err != nil {
+			t.Fatalf("%s: nearby query failed, %v", test.name, err)
+		}
+
+		names := make([]string, 0)
+		last_distance := -1.0
+
+		for _, r := range rsp.Results() {
+
+			nearby_r := r.(*NearbyResult)
+
+			if nearby_r.Distance < last_distance {
+				t.Fatalf("%s: results are not sorted by distance", test.name)
+			}
+
+			if test.radius > 0 && nearby_r.Distance > test.radius {
+				t.Fatalf("%s: %s is %f metres away, beyond the radius", test.name, r.Name(), nearby_r.Distance)
+			}
+
+			last_distance = nearby_r.Distance
+			names = append(names, r.Name())
+		}
+
+		if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+			t.Fatalf("%s: expected %v but got %v", test.name, test.expected, names)
+		}
+	}
+}
+
+func TestNearbyDistance(t *testing.T) {
+
+	ctx := context.Background()
+
+	features, err := nearbyFeatures(nearby_fixtures...)
+
+	if err != nil {
+		t.Fatalf("Failed to create features, %v", err)
+	}
+
+	db, err := spatialtest.NewDatabaseWithFeatures(ctx, "sqlite://?dsn=:memory:", features...)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	origin, err := geo.NewCoordinate(0.0, 0.0)
+
+	if err != nil {
+		t.Fatalf("Failed to create coordinate, %v", err)
+	}
+
+	rsp, err := db.(*SQLiteSpatialDatabase).Nearby(ctx, origin, 2, 0.0)
+
+	if err != nil {
+		t.Fatalf("Nearby query failed, %v", err)
+	}
+
+	results := rsp.Results()
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results but got %d", len(results))
+	}
+
+	// 0.005 degrees of longitude at the equator is about 556 metres
+
+	expected := []float64{0.0, 556.0}
+
+	for i, r := range results {
+
+		d := r.(*NearbyResult).Distance
+
+		if math.Abs(d-expected[i]) > 1.0 {
+			t.Fatalf("Expected %s to be %f metres away but got %f", r.Name(), expected[i], d)
+		}
+	}
+}
+
+// TestNearbyStopsAtLimit checks that nearby queries stop retrieving SPRs once they have enough results, rather
+// than retrieving one for every point within the radius being searched.
+func TestNearbyStopsAtLimit(t *testing.T) {
+
+	ctx := context.Background()
+
+	origin, err := geo.NewCoordinate(0.0, 0.0)
+
+	if err != nil {
+		t.Fatalf("Failed to create coordinate, %v", err)
+	}
+
+	features, err := nearbyFeatures(nearby_fixtures...)
+
+	if err != nil {
+		t.Fatalf("Failed to create features, %v", err)
+	}
+
+	q, err := url.ParseQuery("placetype=locality")
+
+	if err != nil {
+		t.Fatalf("Failed to parse query, %v", err)
+	}
+
+	f, err := filter.NewSPRFilterFromQuery(q)
+
+	if err != nil {
+		t.Fatalf("Failed to create filter, %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		radius    float64
+		filters   []spatial.Filter
+		retrieved []string
+		skipped   []string
+	}{
+		{name: "radius", radius: 200000.0, retrieved: []string{"4001"}, skipped: []string{"4002", "4003", "4004"}},
+		{name: "filter", filters: []spatial.Filter{f}, retrieved: []string{"4001", "4002", "4003"}, skipped: []string{"4004", "4005"}},
+	}
+
+	for _, test := range tests {
+
+		db, err := spatialtest.NewDatabaseWithFeatures(ctx, "sqlite://?dsn=:memory:", features...)
+
+		if err != nil {
+			t.Fatalf("Failed to create database, %v", err)
+		}
+
+		sqlite_db := db.(*SQLiteSpatialDatabase)
+
+		_, err = sqlite_db.Nearby(ctx, origin, 1, test.radius, test.filters...)
+
+		if err != nil {
+			t.Fatalf("%s: nearby query failed, %v", test.name, err)
+		}
+
+		for _, id := range test.retrieved {
+
+			_, ok := sqlite_db.gocache.Get(id)
+
+			if !ok {
+				t.Fatalf("%s: expected SPR for %s to have been retrieved", test.name, id)
+			}
+		}
+
+		for _, id := range test.skipped {
+
+			_, ok := sqlite_db.gocache.Get(id)
+
+			if ok {
+				t.Fatalf("%s: expected SPR for %s, which is further away than the nearest result, not to have been retrieved", test.name, id)
+			}
+		}
+
+		db.Disconnect(ctx)
+	}
+}
+
+// nearbyFeatures returns a point feature for each of 'fixtures'.
+func nearbyFeatures(fixtures ...*nearbyFixture) ([]geojson.Feature, error) {
+
+	features := make([]geojson.Feature, len(fixtures))
+
+	for i, fixture := range fixtures {
+
+		opts := &spatialtest.FeatureOptions{
+			Id:        fixture.id,
+			Name:      fixture.name,
+			Placetype: fixture.placetype,
+			MinX:      fixture.longitude,
+			MinY:      fixture.latitude,
+			MaxX:      fixture.longitude,
+			MaxY:      fixture.latitude,
+		}
+
+		f, err := spatialtest.NewFeature(opts)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load %d, %v", fixture.id, err)
+		}
+
+		features[i] = f
+	}
+
+	return features, nil
+}
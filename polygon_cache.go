@@ -0,0 +1,158 @@
+package sqlite
+
+import (
+	"container/list"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	"sync"
+)
+
+// PolygonCacheStats records the current state of, and activity for, a SQLiteSpatialDatabase instance's
+// prepared polygon cache.
+type PolygonCacheStats struct {
+	Enabled   bool  `json:"enabled"`
+	Entries   int   `json:"entries"`
+	Size      int64 `json:"size"`
+	MaxSize   int64 `json:"max_size"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// polygonCache is a least-recently-used cache of geo.PreparedPolygon instances, keyed by rtree row ID, whose
+// total (approximate) size in memory is bounded.
+type polygonCache struct {
+	mu        *sync.Mutex
+	max_size  int64
+	size      int64
+	items     map[string]*list.Element
+	lru       *list.List
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type polygonCacheItem struct {
+	key     string
+	polygon *geo.PreparedPolygon
+	size    int64
+}
+
+func newPolygonCache(max_size int64) *polygonCache {
+
+	c := &polygonCache{
+		mu:       new(sync.Mutex),
+		max_size: max_size,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+
+	return c
+}
+
+func (c *polygonCache) Get(key string) (*geo.PreparedPolygon, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+
+	if !ok {
+		c.misses += 1
+		return nil, false
+	}
+
+	c.hits += 1
+	c.lru.MoveToFront(el)
+
+	return el.Value.(*polygonCacheItem).polygon, true
+}
+
+func (c *polygonCache) Set(key string, p *geo.PreparedPolygon) {
+
+	size := p.Size() + int64(len(key))
+
+	// Polygons larger than the cache itself are never cached
+
+	if size > c.max_size {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+
+	if ok {
+		c.removeElement(el)
+	}
+
+	item := &polygonCacheItem{
+		key:     key,
+		polygon: p,
+		size:    size,
+	}
+
+	c.items[key] = c.lru.PushFront(item)
+	c.size += size
+
+	for c.size > c.max_size {
+
+		el := c.lru.Back()
+
+		if el == nil {
+			break
+		}
+
+		c.removeElement(el)
+		c.evictions += 1
+	}
+}
+
+func (c *polygonCache) Delete(key string) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+
+	if ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *polygonCache) Flush() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+}
+
+func (c *polygonCache) Stats() *PolygonCacheStats {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := &PolygonCacheStats{
+		Enabled:   true,
+		Entries:   len(c.items),
+		Size:      c.size,
+		MaxSize:   c.max_size,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+
+	return stats
+}
+
+func (c *polygonCache) removeElement(el *list.Element) {
+
+	item := el.Value.(*polygonCacheItem)
+
+	c.lru.Remove(el)
+	delete(c.items, item.key)
+	c.size -= item.size
+}
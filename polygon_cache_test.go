@@ -0,0 +1,125 @@
+package sqlite
+
+import (
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	"testing"
+)
+
+func TestPolygonCache(t *testing.T) {
+
+	square := geo.NewPreparedPolygon([][][]float64{
+		{{0.0, 0.0}, {1.0, 0.0}, {1.0, 1.0}, {0.0, 1.0}, {0.0, 0.0}},
+	})
+
+	// All the keys are the same length so every item is the same size
+
+	item_size := square.Size() + int64(len("a#1"))
+
+	c := newPolygonCache(item_size * 3)
+
+	checkStats := func(label string, entries int, size int64, hits int64, misses int64, evictions int64) {
+
+		stats := c.Stats()
+
+		if stats.Entries != entries || stats.Size != size {
+			t.Fatalf("%s: expected %d entries of size %d but got %d of size %d", label, entries, size, stats.Entries, stats.Size)
+		}
+
+		if stats.Hits != hits || stats.Misses != misses || stats.Evictions != evictions {
+			t.Fatalf("%s: expected %d hits, %d misses and %d evictions but got %d, %d and %d", label, hits, misses, evictions, stats.Hits, stats.Misses, stats.Evictions)
+		}
+
+		if stats.MaxSize != item_size*3 {
+			t.Fatalf("%s: expected maximum size to be %d but got %d", label, item_size*3, stats.MaxSize)
+		}
+	}
+
+	checkCached := func(label string, key string, expected bool) {
+
+		_, ok := c.Get(key)
+
+		if ok != expected {
+			t.Fatalf("%s: expected %s to be cached: %t", label, key, expected)
+		}
+	}
+
+	for _, key := range []string{"a#1", "b#1", "c#1"} {
+		c.Set(key, square)
+	}
+
+	checkStats("set", 3, item_size*3, 0, 0, 0)
+
+	// Setting an existing key replaces the item rather than adding to the size of the cache
+
+	c.Set("c#1", square)
+
+	checkStats("replace", 3, item_size*3, 0, 0, 0)
+
+	// Getting "a#1" makes "b#1" the least recently used item so it is the one evicted
+
+	checkCached("get", "a#1", true)
+
+	c.Set("d#1", square)
+
+	checkStats("evict", 3, item_size*3, 1, 0, 1)
+
+	checkCached("evict", "b#1", false)
+	checkCached("evict", "a#1", true)
+	checkCached("evict", "c#1", true)
+	checkCached("evict", "d#1", true)
+
+	checkStats("evict", 3, item_size*3, 4, 1, 1)
+
+	// The least recently used item is now "a#1"
+
+	c.Set("e#1", square)
+
+	checkCached("evict again", "a#1", false)
+	checkCached("evict again", "c#1", true)
+
+	checkStats("evict again", 3, item_size*3, 5, 2, 2)
+
+	c.Delete("c#1")
+	c.Delete("missing")
+
+	checkStats("delete", 2, item_size*2, 5, 2, 2)
+
+	checkCached("delete", "c#1", false)
+
+	// Polygons larger than the cache are never cached, and don't evict anything
+
+	large_ring := make([][]float64, 0)
+
+	for i := 0; i < 100; i++ {
+		large_ring = append(large_ring, []float64{float64(i), float64(i % 2)})
+	}
+
+	large_ring = append(large_ring, large_ring[0])
+
+	large := geo.NewPreparedPolygon([][][]float64{large_ring})
+
+	if large.Size() <= item_size*3 {
+		t.Fatalf("Expected large polygon to be larger than the cache")
+	}
+
+	c.Set("f#1", large)
+
+	checkCached("large", "f#1", false)
+
+	checkStats("large", 2, item_size*2, 5, 4, 2)
+
+	c.Flush()
+
+	checkStats("flush", 0, 0, 5, 4, 2)
+
+	checkCached("flush", "d#1", false)
+	checkCached("flush", "e#1", false)
+
+	// The cache is still usable after it has been flushed
+
+	c.Set("g#1", square)
+
+	checkCached("after flush", "g#1", true)
+
+	checkStats("after flush", 1, item_size, 6, 6, 2)
+}
@@ -0,0 +1,66 @@
+// Package query provides methods for point-in-polygon queries that extend those in the go-whosonfirst-spatial-pip package.
+package query
+
+import (
+	"context"
+	"fmt"
+	"github.com/skelterjohn/geom"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial-pip"
+	spatial_app "github.com/whosonfirst/go-whosonfirst-spatial/app"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+)
+
+// DistanceDatabase is an interface for spatial databases that can return the polygons intersecting a circle
+// (radius) centered on a coordinate or whose boundaries are near (tolerance) that coordinate.
+type DistanceDatabase interface {
+	PointInPolygonWithDistance(context.Context, *geom.Coord, float64, float64, ...spatial.Filter) (spr.StandardPlacesResults, error)
+}
+
+// PointInPolygonRequest is a pip.PointInPolygonRequest with an optional radius and boundary tolerance, both
+// in metres. If the radius is greater than 0 then every polygon intersecting a circle of that size centered on
+// the coordinate is returned rather than only those polygons which contain it. If the tolerance is greater than 0
+// then every polygon whose boundary is within that distance of the coordinate is also returned, flagged as being
+// "on boundary".
+type PointInPolygonRequest struct {
+	pip.PointInPolygonRequest
+	Radius    float64 `json:"radius,omitempty"`
+	Tolerance float64 `json:"tolerance,omitempty"`
+}
+
+// QueryPointInPolygon performs a point-in-polygon query for 'req'.
+func QueryPointInPolygon(ctx context.Context, app *spatial_app.SpatialApplication, req *PointInPolygonRequest) (spr.StandardPlacesResults, error) {
+
+	if req.Radius < 0 {
+		return nil, fmt.Errorf("Invalid radius '%f'", req.Radius)
+	}
+
+	if req.Tolerance < 0 {
+		return nil, fmt.Errorf("Invalid tolerance '%f'", req.Tolerance)
+	}
+
+	if req.Radius == 0 && req.Tolerance == 0 {
+		return pip.QueryPointInPolygon(ctx, app, &req.PointInPolygonRequest)
+	}
+
+	db, ok := app.SpatialDatabase.(DistanceDatabase)
+
+	if !ok {
+		return nil, fmt.Errorf("Spatial database does not support radius or tolerance queries")
+	}
+
+	c, err := geo.NewCoordinate(req.Longitude, req.Latitude)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new coordinate, %v", err)
+	}
+
+	f, err := pip.NewSPRFilterFromPointInPolygonRequest(&req.PointInPolygonRequest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db.PointInPolygonWithDistance(ctx, c, req.Radius, req.Tolerance, f)
+}
@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-ioutil"
+	"github.com/whosonfirst/go-reader"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var re_identifier = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+func init() {
+	ctx := context.Background()
+	reader.RegisterReader(ctx, "sqlite", NewSQLiteReader)
+}
+
+// SQLiteReader is a whosonfirst/go-reader.Reader implementation for reading documents stored in
+// a column of a SQLite database table.
+type SQLiteReader struct {
+	reader.Reader
+	db          *sqlite_database.SQLiteDatabase
+	table       string
+	key_column  string
+	body_column string
+}
+
+// NewSQLiteReader returns a new SQLiteReader instance for 'uri' which is expected to take the form of:
+//
+//	sqlite://{TABLE}/{KEY_COLUMN}/{BODY_COLUMN}?dsn={DSN}
+//
+// Calls to the Read method will return the value of {BODY_COLUMN} for the row where {KEY_COLUMN}
+// matches the path being read. {DSN} must be the path to, or a SQLite "file:" URI for, an existing
+// database file which is opened read-only.
+func NewSQLiteReader(ctx context.Context, uri string) (reader.Reader, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+
+	dsn := q.Get("dsn")
+
+	if dsn == "" {
+		return nil, errors.New("Missing 'dsn' parameter")
+	}
+
+	path := strings.TrimLeft(u.Path, "/")
+	parts := strings.Split(path, "/")
+
+	if len(parts) != 2 {
+		return nil, errors.New("Invalid path, expected {KEY_COLUMN}/{BODY_COLUMN}")
+	}
+
+	table := u.Host
+	key_column := parts[0]
+	body_column := parts[1]
+
+	for _, name := range []string{table, key_column, body_column} {
+
+		if !re_identifier.MatchString(name) {
+			return nil, fmt.Errorf("Invalid table or column name '%s'", name)
+		}
+	}
+
+	// Custom placetypes are read before any features are indexed and every connection to
+	// a ":memory:" database is a new, empty, database so there would never be anything to read
+
+	if isMemoryDSN(dsn) {
+		return nil, errors.New("In-memory databases can not be read, 'dsn' must be the path to a database file")
+	}
+
+	// Open database files read-only so that a mistyped path fails rather than silently
+	// creating an empty database
+
+	var db *sqlite_database.SQLiteDatabase
+
+	if strings.HasPrefix(dsn, "file:") {
+		db, err = openReadOnlyURI(dsn)
+	} else {
+		db, err = openReadOnlyDatabase(dsn, false)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s, %v", dsn, err)
+	}
+
+	r := &SQLiteReader{
+		db:          db,
+		table:       table,
+		key_column:  key_column,
+		body_column: body_column,
+	}
+
+	return r, nil
+}
+
+func (r *SQLiteReader) Read(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", r.body_column, r.table, r.key_column)
+
+	row := conn.QueryRowContext(ctx, q, key)
+
+	var body string
+
+	err = row.Scan(&body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sr := strings.NewReader(body)
+	return ioutil.NewReadSeekCloser(sr)
+}
+
+func (r *SQLiteReader) ReaderURI(ctx context.Context, key string) string {
+	return key
+}
+
+// Close closes the underlying SQLite database.
+func (r *SQLiteReader) Close() error {
+	return r.db.Close()
+}
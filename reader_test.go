@@ -0,0 +1,96 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSQLiteReader(t *testing.T) {
+
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "reader")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "placetypes.db")
+
+	rw_db, err := sql.Open("sqlite3", fileURI(path, url.Values{"mode": []string{"rwc"}}))
+
+	if err != nil {
+		t.Fatalf("Failed to create %s, %v", path, err)
+	}
+
+	_, err = rw_db.Exec("CREATE TABLE placetypes (id TEXT, body TEXT); INSERT INTO placetypes VALUES ('test', '{}')")
+
+	if err != nil {
+		t.Fatalf("Failed to populate %s, %v", path, err)
+	}
+
+	rw_db.Close()
+
+	for _, dsn := range []string{path, fileURI(path, url.Values{}), fileURI(path, url.Values{"mode": []string{"rwc"}})} {
+
+		r, err := NewSQLiteReader(ctx, "sqlite://placetypes/id/body?dsn="+url.QueryEscape(dsn))
+
+		if err != nil {
+			t.Fatalf("Failed to create reader for %s, %v", dsn, err)
+		}
+
+		fh, err := r.Read(ctx, "test")
+
+		if err != nil {
+			t.Fatalf("Failed to read from %s, %v", dsn, err)
+		}
+
+		body, err := ioutil.ReadAll(fh)
+
+		if err != nil {
+			t.Fatalf("Failed to read body from %s, %v", dsn, err)
+		}
+
+		if string(body) != "{}" {
+			t.Fatalf("Unexpected body from %s, '%s'", dsn, body)
+		}
+
+		conn, err := r.(*SQLiteReader).db.Conn()
+
+		if err != nil {
+			t.Fatalf("Failed to connect to %s, %v", dsn, err)
+		}
+
+		_, err = conn.Exec("INSERT INTO placetypes VALUES ('write', '{}')")
+
+		if err == nil {
+			t.Fatalf("Expected %s to be opened read-only", dsn)
+		}
+
+		r.(*SQLiteReader).Close()
+	}
+
+	missing := filepath.Join(root, "missing.db")
+
+	for _, dsn := range []string{":memory:", "file::memory:?cache=shared", "file:test?mode=memory", missing, fileURI(missing, url.Values{})} {
+
+		_, err := NewSQLiteReader(ctx, "sqlite://placetypes/id/body?dsn="+url.QueryEscape(dsn))
+
+		if err == nil {
+			t.Fatalf("Expected creating a reader for %s to fail", dsn)
+		}
+	}
+
+	_, err = os.Stat(missing)
+
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected no database to be created at %s", missing)
+	}
+}
@@ -0,0 +1,197 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// The maximum number of (open and idle) connections to a database opened in read-only mode.
+var DEFAULT_READ_ONLY_CONNECTIONS int = runtime.NumCPU() * 2
+
+// readOnlyOptions returns whether the database URI parameters in 'q' define a read-only database and, if so,
+// whether it is also immutable. The "immutable" parameter implies read-only mode.
+func readOnlyOptions(q url.Values) (bool, bool, error) {
+
+	read_only := false
+	immutable := false
+
+	mode := q.Get("mode")
+
+	switch mode {
+	case "", "rw", "rwc":
+		// pass
+	case "ro":
+		read_only = true
+	default:
+		return false, false, fmt.Errorf("Invalid 'mode' parameter '%s'", mode)
+	}
+
+	str_immutable := q.Get("immutable")
+
+	if str_immutable != "" {
+
+		v, err := strconv.ParseBool(str_immutable)
+
+		if err != nil {
+			return false, false, fmt.Errorf("Invalid 'immutable' parameter, %v", err)
+		}
+
+		immutable = v
+	}
+
+	if immutable {
+		read_only = true
+	}
+
+	return read_only, immutable, nil
+}
+
+// openReadOnlyDatabase opens the database file at 'path' in read-only mode. If 'immutable' is true SQLite is told
+// that the file can not change, which means it doesn't do any locking, so it can be read from filesystems that
+// don't support locks. Each connection has its own cache, rather than using SQLite's shared cache which serializes
+// access to tables, and idle connections are kept open since concurrent readers don't block each other.
+func openReadOnlyDatabase(path string, immutable bool) (*sqlite_database.SQLiteDatabase, error) {
+
+	if path == ":memory:" || strings.HasPrefix(path, "file:") {
+		return nil, errors.New("Read-only mode requires the path to an existing database file")
+	}
+
+	_, err := os.Stat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	q.Set("mode", "ro")
+
+	if immutable {
+		q.Set("immutable", "1")
+	}
+
+	db, err := sqlite_database.NewDB(fileURI(path, q))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLiteDatabase.Conn never fails, because database/sql doesn't open the file until it is used,
+	// so make sure the file is actually a database that can be queried
+
+	err = checkDatabase(db)
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to connect to database, %v", err)
+	}
+
+	conn.SetMaxOpenConns(DEFAULT_READ_ONLY_CONNECTIONS)
+	conn.SetMaxIdleConns(DEFAULT_READ_ONLY_CONNECTIONS)
+
+	return db, nil
+}
+
+// openReadOnlyURI opens the database identified by the SQLite "file:" URI 'dsn' in read-only mode, replacing any
+// "mode" parameter in the URI, and checks that it can be queried.
+func openReadOnlyURI(dsn string) (*sqlite_database.SQLiteDatabase, error) {
+
+	if isMemoryDSN(dsn) {
+		return nil, errors.New("Read-only mode requires an existing database file")
+	}
+
+	path := dsn
+	query := ""
+
+	idx := strings.Index(dsn, "?")
+
+	if idx != -1 {
+		path = dsn[0:idx]
+		query = dsn[idx+1:]
+	}
+
+	q, err := url.ParseQuery(query)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid URI, %v", err)
+	}
+
+	q.Set("mode", "ro")
+
+	db, err := sqlite_database.NewDB(fmt.Sprintf("%s?%s", path, q.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkDatabase(db)
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// checkDatabase ensures that 'db' can be queried, which is the first time SQLite actually opens the database
+// file, so that a path to a file that doesn't exist, or isn't a SQLite database, fails when it is opened.
+func checkDatabase(db *sqlite_database.SQLiteDatabase) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to connect to database, %v", err)
+	}
+
+	ctx := context.Background()
+
+	err = conn.PingContext(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to connect to database, %v", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT 1 FROM sqlite_master LIMIT 1")
+
+	if err != nil {
+		return fmt.Errorf("Failed to query database, %v", err)
+	}
+
+	return rows.Close()
+}
+
+// isMemoryDSN returns true if 'dsn' identifies an in-memory database rather than a database file.
+func isMemoryDSN(dsn string) bool {
+
+	if dsn == ":memory:" || strings.HasPrefix(dsn, "file::memory:") {
+		return true
+	}
+
+	return strings.HasPrefix(dsn, "file:") && strings.Contains(dsn, "mode=memory")
+}
+
+// fileURI returns a SQLite URI filename for the database file at 'path' with the parameters in 'q'. The path is
+// escaped so that characters like '?', '#' and '%' in it are not mistaken for the start of the URI's query string
+// or fragment, or for an escape sequence.
+func fileURI(path string, q url.Values) string {
+
+	u := &url.URL{
+		Path: path,
+	}
+
+	return fmt.Sprintf("file:%s?%s", u.EscapedPath(), q.Encode())
+}
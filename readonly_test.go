@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenReadOnlyDatabase(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "readonly")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"test.db", "test?mode=rwc.db", "test#1.db", "test%20.db", "with space.db"} {
+
+		path := filepath.Join(root, name)
+
+		// Create the database with a table whose name is derived from the path so that opening the
+		// wrong file can be detected
+
+		rw_db, err := sql.Open("sqlite3", fileURI(path, url.Values{"mode": []string{"rwc"}}))
+
+		if err != nil {
+			t.Fatalf("Failed to create %s, %v", path, err)
+		}
+
+		_, err = rw_db.Exec("CREATE TABLE test (name TEXT); INSERT INTO test VALUES (?)", name)
+
+		if err != nil {
+			t.Fatalf("Failed to populate %s, %v", path, err)
+		}
+
+		rw_db.Close()
+
+		for _, immutable := range []bool{false, true} {
+
+			db, err := openReadOnlyDatabase(path, immutable)
+
+			if err != nil {
+				t.Fatalf("Failed to open %s (immutable %t), %v", path, immutable, err)
+			}
+
+			conn, err := db.Conn()
+
+			if err != nil {
+				t.Fatalf("Failed to connect to %s, %v", path, err)
+			}
+
+			var stored string
+
+			err = conn.QueryRow("SELECT name FROM test").Scan(&stored)
+
+			if err != nil {
+				t.Fatalf("Failed to query %s (immutable %t), %v", path, immutable, err)
+			}
+
+			if stored != name {
+				t.Fatalf("Expected to open %s but opened %s", name, stored)
+			}
+
+			_, err = conn.Exec("INSERT INTO test VALUES ('write')")
+
+			if err == nil {
+				t.Fatalf("Expected %s (immutable %t) to be read-only", path, immutable)
+			}
+
+			db.Close()
+		}
+	}
+
+	_, err = os.Stat(filepath.Join(root, "test"))
+
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected no database to be created at the unescaped path")
+	}
+
+	// A file that exists but isn't a SQLite database should fail when it is opened, rather than the first
+	// time it is queried
+
+	not_db := filepath.Join(root, "not.db")
+
+	err = ioutil.WriteFile(not_db, []byte("This is not a SQLite database, it is just some text that is long enough to have a header."), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write %s, %v", not_db, err)
+	}
+
+	for _, immutable := range []bool{false, true} {
+
+		_, err = openReadOnlyDatabase(not_db, immutable)
+
+		if err == nil {
+			t.Fatalf("Expected opening %s (immutable %t) to fail", not_db, immutable)
+		}
+	}
+}
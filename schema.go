@@ -0,0 +1,367 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	local_geo "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	local_tables "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/tables"
+	"github.com/whosonfirst/go-whosonfirst-sqlite"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"github.com/whosonfirst/go-whosonfirst-sqlite/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The version of the schema for the tables created by SQLiteSpatialDatabase instances. It should be incremented
+// whenever the schema for any of those tables changes.
+const SCHEMA_VERSION int = 2
+
+// The metadata key for the version of the schema a database was created with.
+const METADATA_SCHEMA_VERSION string = "schema_version"
+
+// The metadata key for the encoding used to store geometries in the rtree table.
+const METADATA_GEOMETRY_FORMAT string = "geometry_format"
+
+// The metadata key for the (RFC3339) time a database was created.
+const METADATA_CREATED string = "created"
+
+// The metadata key for the iterator URI, including any filters, used by the build tool to index a database.
+const METADATA_BUILD_ITERATOR_URI string = "build_iterator_uri"
+
+// The metadata key for the (JSON-encoded) list of paths indexed by the build tool.
+const METADATA_BUILD_PATHS string = "build_paths"
+
+// The metadata key for whether the documents indexed by the build tool were Who's On First documents.
+const METADATA_BUILD_IS_WOF string = "build_is_wof"
+
+// The metadata key for the (JSON-encoded) property mapping used by the build tool to index "plain old" GeoJSON documents.
+const METADATA_BUILD_PROPERTY_MAPPING string = "build_property_mapping"
+
+// The metadata key for the (RFC3339) time the build tool finished indexing a database.
+const METADATA_BUILD_FINISHED string = "build_finished"
+
+// SchemaReport describes how the tables in a database compare to the schemas expected by SQLiteSpatialDatabase.
+type SchemaReport struct {
+	// The schema version recorded in the database's metadata table or 0 if it is unknown.
+	Version int `json:"version"`
+	// The key-value pairs in the database's metadata table.
+	Metadata map[string]string `json:"metadata"`
+	// A report for each of the tables used by SQLiteSpatialDatabase.
+	Tables []*local_tables.SchemaReport `json:"tables"`
+}
+
+// Schema returns a report describing how the tables in the database compare to the schemas they are expected to have.
+func (r *SQLiteSpatialDatabase) Schema(ctx context.Context) (*SchemaReport, error) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.schemaReport(ctx, r.db)
+}
+
+// Metadata returns the key-value pairs in the database's metadata table.
+func (r *SQLiteSpatialDatabase) Metadata(ctx context.Context) (map[string]string, error) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return readMetadata(ctx, r.db, r.metadata_table)
+}
+
+// SetMetadata stores 'value' for 'key' in the database's metadata table, replacing any existing value. It is
+// used to record the parameters a database was indexed with.
+func (r *SQLiteSpatialDatabase) SetMetadata(ctx context.Context, key string, value string) error {
+
+	if r.read_only {
+		return ErrReadOnly
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.metadata_table.Set(ctx, r.db, key, value)
+}
+
+func (r *SQLiteSpatialDatabase) schemaReport(ctx context.Context, db *sqlite_database.SQLiteDatabase) (*SchemaReport, error) {
+
+	metadata, err := readMetadata(ctx, db, r.metadata_table)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read metadata, %v", err)
+	}
+
+	report := &SchemaReport{
+		Metadata: metadata,
+		Tables:   make([]*local_tables.SchemaReport, 0),
+	}
+
+	str_version, ok := metadata[METADATA_SCHEMA_VERSION]
+
+	if ok {
+
+		v, err := strconv.Atoi(str_version)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s metadata, %v", METADATA_SCHEMA_VERSION, err)
+		}
+
+		report.Version = v
+	}
+
+	for _, t := range []sqlite.Table{r.rtree_table, r.spr_table, r.points_table, r.geojson_table, r.rows_table} {
+
+		table_report, err := local_tables.CompareSchema(ctx, db, t)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compare schema for %s table, %v", t.Name(), err)
+		}
+
+		report.Tables = append(report.Tables, table_report)
+	}
+
+	return report, nil
+}
+
+// readMetadata returns the key-value pairs in the metadata table for 'db' or an empty map if it doesn't have one.
+func readMetadata(ctx context.Context, db *sqlite_database.SQLiteDatabase, t *local_tables.MetadataTable) (map[string]string, error) {
+
+	has_table, err := utils.HasTable(db, t.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !has_table {
+		return make(map[string]string), nil
+	}
+
+	return t.Get(ctx, db)
+}
+
+// initializeMetadata records the schema version and build parameters for a database, if they haven't been
+// recorded already.
+func (r *SQLiteSpatialDatabase) initializeMetadata(ctx context.Context, geometry_format string) error {
+
+	metadata, err := r.metadata_table.Get(ctx, r.db)
+
+	if err != nil {
+		return err
+	}
+
+	defaults := map[string]string{
+		METADATA_SCHEMA_VERSION:  strconv.Itoa(SCHEMA_VERSION),
+		METADATA_GEOMETRY_FORMAT: geometry_format,
+		METADATA_CREATED:         time.Now().UTC().Format(time.RFC3339),
+	}
+
+	for k, v := range defaults {
+
+		_, ok := metadata[k]
+
+		if ok {
+			continue
+		}
+
+		err := r.metadata_table.Set(ctx, r.db, k, v)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// detectGeometryFormat returns the format of the first geometry in the rtree table for 'db' or an empty string
+// if the table doesn't exist or is empty.
+func detectGeometryFormat(ctx context.Context, db *sqlite_database.SQLiteDatabase) (string, error) {
+
+	rtree_table, err := local_tables.NewRTreeTable()
+
+	if err != nil {
+		return "", err
+	}
+
+	has_table, err := utils.HasTable(db, rtree_table.Name())
+
+	if err != nil {
+		return "", err
+	}
+
+	if !has_table {
+		return "", nil
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return "", err
+	}
+
+	q := fmt.Sprintf("SELECT geometry FROM %s LIMIT 1", rtree_table.Name())
+
+	row := conn.QueryRowContext(ctx, q)
+
+	var body []byte
+
+	err = row.Scan(&body)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return local_geo.GeometryFormat(body), nil
+}
+
+// validateDatabase ensures that 'db' has the tables, and the columns, necessary to answer point-in-polygon
+// queries. It does not write to 'db' so it can be used to check a database before deciding to use it. Problems
+// that won't cause queries to fail, like missing indexes, are logged as warnings.
+func (r *SQLiteSpatialDatabase) validateDatabase(ctx context.Context, db *sqlite_database.SQLiteDatabase) error {
+
+	report, err := r.schemaReport(ctx, db)
+
+	if err != nil {
+		return err
+	}
+
+	if report.Version > SCHEMA_VERSION {
+		return fmt.Errorf("Database schema version %d is newer than the supported version (%d)", report.Version, SCHEMA_VERSION)
+	}
+
+	if report.Version > 0 && report.Version < SCHEMA_VERSION {
+		r.Logger.Warning("Database schema version %d is older than the current version (%d)", report.Version, SCHEMA_VERSION)
+	}
+
+	required := map[string]bool{
+		r.rtree_table.Name(): true,
+		r.spr_table.Name():   true,
+	}
+
+	problems := make([]string, 0)
+
+	for _, t := range report.Tables {
+
+		switch {
+		case !t.Exists && required[t.Name]:
+			problems = append(problems, fmt.Sprintf("missing %s table", t.Name))
+		case !t.Exists && !r.read_only:
+
+			// Missing tables for optional features are created by migrateDatabase
+
+		case !t.Exists && t.Name == r.rows_table.Name():
+
+			// The rows table is only used when features are indexed or removed, which
+			// read-only databases don't do
+
+		case !t.Exists:
+
+			// Databases created by other tools may not have a points table, which is only
+			// used for nearby queries, or a geojson table, which is only used by Read
+
+			r.Logger.Warning("Database is missing %s table, queries that depend on it will fail", t.Name)
+
+		case len(t.MissingColumns) > 0 && required[t.Name]:
+			problems = append(problems, fmt.Sprintf("%s table is missing columns: %s", t.Name, strings.Join(t.MissingColumns, ", ")))
+		case len(t.MissingColumns) > 0:
+			r.Logger.Warning("Database %s table is missing columns: %s, queries that depend on it will fail", t.Name, strings.Join(t.MissingColumns, ", "))
+		default:
+			// pass
+		}
+
+		if len(t.MissingIndexes) > 0 {
+			r.Logger.Warning("Database %s table is missing indexes: %s", t.Name, strings.Join(t.MissingIndexes, ", "))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid schema, %s", strings.Join(problems, "; "))
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return err
+	}
+
+	// Make sure the rtree table can actually be queried
+
+	q := fmt.Sprintf("SELECT id FROM %s LIMIT 1", r.rtree_table.Name())
+
+	rows, err := conn.QueryContext(ctx, q)
+
+	if err != nil {
+		return fmt.Errorf("Failed to query %s table, %v", r.rtree_table.Name(), err)
+	}
+
+	return rows.Close()
+}
+
+// migrateDatabase creates the tables for optional features in 'db' if they are missing and brings tables created
+// by older versions of the schema up to date. It should only be called once 'db' has passed validation.
+func (r *SQLiteSpatialDatabase) migrateDatabase(ctx context.Context, db *sqlite_database.SQLiteDatabase) error {
+
+	if r.read_only {
+		return ErrReadOnly
+	}
+
+	for _, t := range []sqlite.Table{r.points_table, r.geojson_table, r.metadata_table} {
+
+		err := utils.CreateTableIfNecessary(db, t)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create %s table, %v", t.Name(), err)
+		}
+	}
+
+	return r.migrateRowsTable(ctx, db)
+}
+
+// migrateRowsTable creates the rows table in 'db' if it doesn't exist and, since databases created before schema
+// version 2 will already have rows in their rtree and points tables, populates it from those tables.
+func (r *SQLiteSpatialDatabase) migrateRowsTable(ctx context.Context, db *sqlite_database.SQLiteDatabase) error {
+
+	has_table, err := utils.HasTable(db, r.rows_table.Name())
+
+	if err != nil {
+		return err
+	}
+
+	if has_table {
+		return nil
+	}
+
+	err = r.rows_table.InitializeTable(db)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create %s table, %v", r.rows_table.Name(), err)
+	}
+
+	has_rtree, err := utils.HasTable(db, r.rtree_table.Name())
+
+	if err != nil {
+		return err
+	}
+
+	// The rtree table is required so databases without one will fail validation
+
+	if !has_rtree {
+		return nil
+	}
+
+	err = r.rows_table.Populate(ctx, db, r.rtree_table, r.points_table)
+
+	if err != nil {
+		return err
+	}
+
+	// Populating the rows table brings the database up to date so make sure it isn't
+	// reported as having an older schema
+
+	return r.metadata_table.Set(ctx, db, METADATA_SCHEMA_VERSION, strconv.Itoa(SCHEMA_VERSION))
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/index"
+	"github.com/whosonfirst/go-whosonfirst-spatial/app"
+)
+
+// NewSpatialApplicationWithFlagSet returns a new app.SpatialApplication instance derived from 'fl'. It is
+// identical to the go-whosonfirst-spatial/app.NewSpatialApplicationWithFlagSet method except that the
+// iterator is created by the local index package and custom placetypes are appended by the local
+// AppendCustomPlacetypesWithFlagSet method.
+func NewSpatialApplicationWithFlagSet(ctx context.Context, fl *flag.FlagSet) (*app.SpatialApplication, error) {
+
+	logger, err := app.NewApplicationLoggerWithFlagSet(ctx, fl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	spatial_db, err := app.NewSpatialDatabaseWithFlagSet(ctx, fl)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed instantiate spatial database, %v", err)
+	}
+
+	properties_r, err := app.NewPropertiesReaderWithFlagsSet(ctx, fl)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create properties reader, %v", err)
+	}
+
+	if properties_r == nil {
+		properties_r = spatial_db
+	}
+
+	iter, err := index.NewIteratorWithFlagSet(ctx, fl, spatial_db)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to instantiate iterator, %v", err)
+	}
+
+	err = AppendCustomPlacetypesWithFlagSet(ctx, fl)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to append custom placetypes, %v", err)
+	}
+
+	sp := &app.SpatialApplication{
+		SpatialDatabase:  spatial_db,
+		PropertiesReader: properties_r,
+		Iterator:         iter,
+		Logger:           logger,
+	}
+
+	return sp, nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/whosonfirst/go-reader"
+	"github.com/whosonfirst/go-whosonfirst-placetypes"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// AppendCustomPlacetypesWithFlagSet appends custom placetypes derived from the values in 'fs'. It is
+// identical to the go-whosonfirst-spatial/app.AppendCustomPlacetypesWithFlagSet method except that custom
+// placetypes may also be read from the whosonfirst/go-reader URI defined by the -custom-placetypes-source flag.
+func AppendCustomPlacetypesWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	enable_custom_placetypes, _ := lookup.BoolVar(fs, spatial_flags.ENABLE_CUSTOM_PLACETYPES)
+
+	if !enable_custom_placetypes {
+		return nil
+	}
+
+	custom_placetypes_source, _ := lookup.StringVar(fs, spatial_flags.CUSTOM_PLACETYPES_SOURCE)
+	custom_placetypes, _ := lookup.StringVar(fs, spatial_flags.CUSTOM_PLACETYPES)
+
+	var custom_reader io.Reader
+
+	if custom_placetypes_source == "" {
+		custom_reader = strings.NewReader(custom_placetypes)
+	} else {
+
+		fh, err := ReadCustomPlacetypesSource(ctx, custom_placetypes_source)
+
+		if err != nil {
+			return fmt.Errorf("Failed to read custom placetypes from %s, %v", custom_placetypes_source, err)
+		}
+
+		defer fh.Close()
+
+		custom_reader = fh
+	}
+
+	spec, err := placetypes.NewWOFPlacetypeSpecificationWithReader(custom_reader)
+
+	if err != nil {
+		return err
+	}
+
+	return placetypes.AppendPlacetypeSpecification(spec)
+}
+
+// ReadCustomPlacetypesSource returns an io.ReadSeekCloser for the document identified by 'source'
+// which is a whosonfirst/go-reader URI followed by a '#{KEY}' fragment. If 'source' uses the file://
+// scheme and has no fragment then the URI's path is split in to a reader root and key. Closing the
+// io.ReadSeekCloser also closes the reader, if it can be closed.
+func ReadCustomPlacetypesSource(ctx context.Context, source string) (io.ReadSeekCloser, error) {
+
+	u, err := url.Parse(source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := u.Fragment
+	u.Fragment = ""
+
+	if key == "" {
+
+		switch u.Scheme {
+		case "file", "fs":
+			key = filepath.Base(u.Path)
+			u.Path = filepath.Dir(u.Path)
+		default:
+			return nil, fmt.Errorf("Missing '#{KEY}' fragment")
+		}
+	}
+
+	r, err := reader.NewService(ctx, u.String())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create reader, %v", err)
+	}
+
+	fh, err := r.Read(ctx, key)
+
+	// Some readers, like sqlite://, hold on to resources that need to be released once the
+	// document has been read
+
+	closer, ok := r.(io.Closer)
+
+	if !ok {
+		return fh, err
+	}
+
+	if err != nil {
+		closer.Close()
+		return nil, err
+	}
+
+	rc := &readerCloser{
+		ReadSeekCloser: fh,
+		reader:         closer,
+	}
+
+	return rc, nil
+}
+
+// readerCloser is an io.ReadSeekCloser which also closes the reader it was read from when it is closed.
+type readerCloser struct {
+	io.ReadSeekCloser
+	reader io.Closer
+}
+
+func (rc *readerCloser) Close() error {
+
+	err := rc.ReadSeekCloser.Close()
+
+	if err != nil {
+		rc.reader.Close()
+		return err
+	}
+
+	return rc.reader.Close()
+}
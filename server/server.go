@@ -0,0 +1,688 @@
+package server
+
+// This is a local implementation of the go-whosonfirst-spatial-www/server package which allows
+// us to add handlers, and indexing behaviours, specific to SQLite-backed spatial databases.
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/NYTimes/gziphandler"
+	"github.com/aaronland/go-http-bootstrap"
+	"github.com/aaronland/go-http-leaflet"
+	"github.com/aaronland/go-http-ping"
+	"github.com/aaronland/go-http-server"
+	"github.com/aaronland/go-http-tangramjs"
+	"github.com/rs/cors"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/lookup"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/flags"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/http"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/index"
+	www_flags "github.com/whosonfirst/go-whosonfirst-spatial-www/flags"
+	www "github.com/whosonfirst/go-whosonfirst-spatial-www/http"
+	"github.com/whosonfirst/go-whosonfirst-spatial-www/templates/html"
+	spatial_flags "github.com/whosonfirst/go-whosonfirst-spatial/flags"
+	"html/template"
+	"log"
+	gohttp "net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+type HTTPServerApplication struct{}
+
+func NewHTTPServerApplication(ctx context.Context) (*HTTPServerApplication, error) {
+
+	server_app := &HTTPServerApplication{}
+	return server_app, nil
+}
+
+func (server_app *HTTPServerApplication) DefaultFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs, err := spatial_flags.CommonFlags()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive common spatial flags, %v", err)
+	}
+
+	err = spatial_flags.AppendIndexingFlags(fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to append indexing flags, %v", err)
+	}
+
+	err = flags.AppendIndexingFlags(fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to append local indexing flags, %v", err)
+	}
+
+	err = www_flags.AppendWWWFlags(fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to append www flags, %v", err)
+	}
+
+	err = flags.AppendCustomPlacetypesFlags(fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to append custom placetypes flags, %v", err)
+	}
+
+	err = flags.AppendPropertyMappingFlags(fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to append property mapping flags, %v", err)
+	}
+
+	err = flags.AppendFilterFlags(fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to append filter flags, %v", err)
+	}
+
+	err = flags.AppendAdminFlags(fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to append admin flags, %v", err)
+	}
+
+	return fs, nil
+}
+
+func (server_app *HTTPServerApplication) Run(ctx context.Context) error {
+
+	fs, err := server_app.DefaultFlagSet(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create default flagset, %v", err)
+	}
+
+	return server_app.RunWithFlagSet(ctx, fs)
+}
+
+func (server_app *HTTPServerApplication) RunWithFlagSet(ctx context.Context, fs *flag.FlagSet) error {
+
+	flagset.Parse(fs)
+
+	err := flagset.SetFlagsFromEnvVarsWithFeedback(fs, "WHOSONFIRST", true)
+
+	if err != nil {
+		return fmt.Errorf("Failed to set flags from environment variables, %v", err)
+	}
+
+	err = spatial_flags.ValidateCommonFlags(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate common flags, %v", err)
+	}
+
+	err = spatial_flags.ValidateIndexingFlags(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate indexing flags, %v", err)
+	}
+
+	err = flags.ValidateIndexingFlags(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate local indexing flags, %v", err)
+	}
+
+	err = www_flags.ValidateWWWFlags(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate www flags, %v", err)
+	}
+
+	err = flags.ValidateCustomPlacetypesFlags(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate custom placetypes flags, %v", err)
+	}
+
+	err = flags.ValidatePropertyMappingFlags(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate property mapping flags, %v", err)
+	}
+
+	err = flags.ValidateFilterFlags(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate filter flags, %v", err)
+	}
+
+	err = flags.ValidateAdminFlags(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate admin flags, %v", err)
+	}
+
+	enable_www, _ := lookup.BoolVar(fs, www_flags.ENABLE_WWW)
+	enable_geojson, _ := lookup.BoolVar(fs, www_flags.ENABLE_GEOJSON)
+	enable_cors, _ := lookup.BoolVar(fs, www_flags.ENABLE_CORS)
+	enable_gzip, _ := lookup.BoolVar(fs, www_flags.ENABLE_GZIP)
+	enable_tangram, _ := lookup.BoolVar(fs, www_flags.ENABLE_TANGRAM)
+
+	path_prefix, _ := lookup.StringVar(fs, www_flags.PATH_PREFIX)
+	path_api, _ := lookup.StringVar(fs, www_flags.PATH_API)
+	path_ping, _ := lookup.StringVar(fs, www_flags.PATH_PING)
+	path_pip, _ := lookup.StringVar(fs, www_flags.PATH_PIP)
+	path_data, _ := lookup.StringVar(fs, www_flags.PATH_DATA)
+
+	enable_admin, _ := lookup.BoolVar(fs, flags.ENABLE_ADMIN)
+	admin_token, _ := lookup.StringVar(fs, flags.ADMIN_TOKEN)
+	path_admin, _ := lookup.StringVar(fs, flags.PATH_ADMIN)
+
+	// Append any filters to the -iterator-uri flag itself so that they are applied by
+	// every iterator (and watcher) derived from the flagset
+
+	emitter_uri, err := flags.IteratorURIWithFlagSet(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive iterator URI, %v", err)
+	}
+
+	err = fs.Set(spatial_flags.ITERATOR_URI, emitter_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to assign iterator URI, %v", err)
+	}
+
+	server_uri, _ := lookup.StringVar(fs, www_flags.SERVER_URI)
+	error_report_path, _ := lookup.StringVar(fs, flags.INDEX_ERROR_REPORT)
+
+	watch, _ := lookup.BoolVar(fs, flags.WATCH)
+	watch_interval, _ := lookup.IntVar(fs, flags.WATCH_INTERVAL)
+	snapshot_path, _ := lookup.StringVar(fs, flags.INDEX_SNAPSHOT)
+
+	error_policy, err := index.NewErrorPolicyWithFlagSet(fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create indexing error policy, %v", err)
+	}
+
+	spatial_app, err := NewSpatialApplicationWithFlagSet(ctx, fs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new spatial application, %v", err)
+	}
+
+	emitter_cb, err := index.NewIteratorCallbackWithFlagSet(ctx, fs, spatial_app.SpatialDatabase)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create iterator callback, %v", err)
+	}
+
+	indexer_opts := &index.IndexerOptions{
+		SpatialDatabase: spatial_app.SpatialDatabase,
+		EmitterURI:      emitter_uri,
+		EmitterCallback: emitter_cb,
+		ErrorPolicy:     error_policy,
+		ErrorReportPath: error_report_path,
+		Logger:          spatial_app.Logger,
+	}
+
+	indexer, err := index.NewIndexer(ctx, indexer_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create indexer, %v", err)
+	}
+
+	paths := fs.Args()
+
+	if len(paths) > 0 {
+
+		var watcher *index.Watcher
+
+		if watch {
+
+			watcher_opts := &index.WatcherOptions{
+				SpatialDatabase: spatial_app.SpatialDatabase,
+				EmitterURI:      emitter_uri,
+				EmitterCallback: emitter_cb,
+				Interval:        watch_interval,
+				Logger:          spatial_app.Logger,
+			}
+
+			// Who's On First filenames encode the ID of the feature they contain but the IDs
+			// of "plain old" GeoJSON features need to be recorded before their files are deleted
+
+			is_wof, _ := lookup.BoolVar(fs, spatial_flags.IS_WOF)
+
+			if !is_wof {
+
+				loader, err := index.NewFeatureLoaderWithFlagSet(fs)
+
+				if err != nil {
+					return fmt.Errorf("Failed to create feature loader, %v", err)
+				}
+
+				watcher_opts.FeatureLoader = loader
+			}
+
+			w, err := index.NewWatcher(ctx, watcher_opts, paths...)
+
+			if err != nil {
+				return fmt.Errorf("Failed to create watcher, %v", err)
+			}
+
+			// Record the state of the paths being watched before they are indexed so that
+			// any changes made while indexing is in progress will be picked up
+
+			_, err = w.Scan(ctx)
+
+			if err != nil {
+				return fmt.Errorf("Failed to scan paths to watch, %v", err)
+			}
+
+			watcher = w
+		}
+
+		// If there is a current snapshot of the database restore it instead of indexing the paths
+
+		var snapshot_opts *snapshotOptions
+		restored := false
+
+		if snapshot_path != "" {
+
+			snapshot_db, ok := spatial_app.SpatialDatabase.(SnapshotDatabase)
+
+			if !ok {
+				return fmt.Errorf("The -%s flag is not supported by %T databases", flags.INDEX_SNAPSHOT, spatial_app.SpatialDatabase)
+			}
+
+			build_metadata, err := index.BuildMetadataWithFlagSet(fs, emitter_uri, paths...)
+
+			if err != nil {
+				return fmt.Errorf("Failed to derive snapshot metadata, %v", err)
+			}
+
+			snapshot_opts = &snapshotOptions{
+				Database:      snapshot_db,
+				Path:          snapshot_path,
+				EmitterURI:    emitter_uri,
+				Paths:         paths,
+				BuildMetadata: build_metadata,
+				Logger:        spatial_app.Logger,
+			}
+
+			restored, err = restoreSnapshot(ctx, snapshot_opts)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		var job *index.Job
+
+		if !restored {
+
+			// Use the spatial application's own iterator for the initial indexing so that
+			// API handlers will return "indexing" errors until it is complete
+
+			job, err = indexer.IndexURIsWithIterator(ctx, spatial_app.Iterator, paths...)
+
+			if err != nil {
+				return fmt.Errorf("Failed to index paths, %v", err)
+			}
+		}
+
+		go func() {
+
+			if job != nil {
+
+				<-job.Done()
+
+				err := job.Err()
+
+				if err != nil {
+					spatial_app.Logger.Fatal("failed to index paths because %s", err)
+				}
+
+				if snapshot_opts != nil {
+
+					err := writeSnapshot(ctx, snapshot_opts)
+
+					if err != nil {
+						spatial_app.Logger.Error("failed to write snapshot, %v", err)
+					}
+				}
+			}
+
+			if watcher != nil {
+
+				spatial_app.Logger.Status("watching %d paths for changes", len(paths))
+
+				err := watcher.Watch(ctx)
+
+				if err != nil && err != context.Canceled {
+					spatial_app.Logger.Error("failed to watch paths for changes, %v", err)
+				}
+			}
+		}()
+
+		// Reindex paths when the server receives a SIGHUP signal
+
+		go func() {
+
+			sighup_ch := make(chan os.Signal, 1)
+			signal.Notify(sighup_ch, syscall.SIGHUP)
+
+			for range sighup_ch {
+
+				spatial_app.Logger.Status("received SIGHUP, reindexing paths")
+
+				// Only features that have changed are reindexed, whether or not the
+				// database was created with the "incremental" flag
+
+				job, err := indexer.IndexURIs(sqlite.WithIncrementalIndexing(ctx), paths...)
+
+				if err != nil {
+					spatial_app.Logger.Error("failed to reindex paths, %v", err)
+					continue
+				}
+
+				if snapshot_opts != nil {
+
+					go func() {
+
+						<-job.Done()
+
+						if job.Err() != nil {
+							return
+						}
+
+						err := writeSnapshot(ctx, snapshot_opts)
+
+						if err != nil {
+							spatial_app.Logger.Error("failed to write snapshot, %v", err)
+						}
+					}()
+				}
+			}
+		}()
+	}
+
+	mux := gohttp.NewServeMux()
+
+	ping_handler, err := ping.PingHandler()
+
+	if err != nil {
+		return fmt.Errorf("Failed to create ping handler, %v", err)
+	}
+
+	mux.Handle(path_ping, ping_handler)
+
+	var cors_wrapper *cors.Cors
+
+	if enable_cors {
+		cors_wrapper = cors.New(cors.Options{})
+	}
+
+	wrapHandler := func(h gohttp.Handler) gohttp.Handler {
+
+		if enable_cors {
+			h = cors_wrapper.Handler(h)
+		}
+
+		if enable_gzip {
+			h = gziphandler.GzipHandler(h)
+		}
+
+		return h
+	}
+
+	data_handler, err := www.NewDataHandler(spatial_app.SpatialDatabase)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create data handler, %v", err)
+	}
+
+	data_handler = wrapHandler(data_handler)
+
+	if !strings.HasSuffix(path_data, "/") {
+		path_data = fmt.Sprintf("%s/", path_data)
+	}
+
+	mux.Handle(path_data, data_handler)
+
+	api_pip_opts := &http.PointInPolygonHandlerOptions{
+		EnableGeoJSON: enable_geojson,
+	}
+
+	api_pip_handler, err := http.PointInPolygonHandler(spatial_app, api_pip_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create point-in-polygon API handler, %v", err)
+	}
+
+	api_pip_handler = wrapHandler(api_pip_handler)
+
+	path_api_pip := filepath.Join(path_api, "point-in-polygon")
+	mux.Handle(path_api_pip, api_pip_handler)
+
+	api_nearby_opts := &http.NearbyHandlerOptions{
+		EnableGeoJSON: enable_geojson,
+	}
+
+	api_nearby_handler, err := http.NearbyHandler(spatial_app, api_nearby_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create nearby API handler, %v", err)
+	}
+
+	api_nearby_handler = wrapHandler(api_nearby_handler)
+
+	path_api_nearby := filepath.Join(path_api, "nearby")
+	mux.Handle(path_api_nearby, api_nearby_handler)
+
+	if enable_admin {
+
+		reindex_opts := &http.ReindexHandlerOptions{
+			Context: sqlite.WithIncrementalIndexing(ctx),
+			URIs:    paths,
+		}
+
+		reindex_handler, err := http.ReindexHandler(indexer, reindex_opts)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create reindex handler, %v", err)
+		}
+
+		reindex_handler = http.BearerTokenHandler(reindex_handler, admin_token)
+
+		path_admin_reindex := filepath.Join(path_admin, "reindex")
+		mux.Handle(path_admin_reindex, reindex_handler)
+
+		report_handler, err := http.ErrorReportHandler(indexer)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create error report handler, %v", err)
+		}
+
+		report_handler = http.BearerTokenHandler(report_handler, admin_token)
+
+		path_admin_report := filepath.Join(path_admin_reindex, "report")
+		mux.Handle(path_admin_report, report_handler)
+
+		stats_handler, err := http.StatsHandler(spatial_app.SpatialDatabase)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create stats handler, %v", err)
+		}
+
+		stats_handler = http.BearerTokenHandler(stats_handler, admin_token)
+
+		path_admin_stats := filepath.Join(path_admin, "stats")
+		mux.Handle(path_admin_stats, stats_handler)
+
+		schema_handler, err := http.SchemaHandler(spatial_app.SpatialDatabase)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create schema handler, %v", err)
+		}
+
+		schema_handler = http.BearerTokenHandler(schema_handler, admin_token)
+
+		path_admin_schema := filepath.Join(path_admin, "schema")
+		mux.Handle(path_admin_schema, schema_handler)
+
+		swap_handler, err := http.SwapHandler(spatial_app.SpatialDatabase)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create swap handler, %v", err)
+		}
+
+		swap_handler = http.BearerTokenHandler(swap_handler, admin_token)
+
+		path_admin_swap := filepath.Join(path_admin, "swap")
+		mux.Handle(path_admin_swap, swap_handler)
+	}
+
+	if enable_www {
+
+		t := template.New("spatial").Funcs(template.FuncMap{
+			"EnsureRoot": func(path string) string {
+
+				path = strings.TrimLeft(path, "/")
+
+				if path_prefix == "" {
+					return "/" + path
+				}
+
+				return strings.TrimRight(path_prefix, "/") + "/" + path
+			},
+			"DataRoot": func() string {
+
+				if path_prefix == "" {
+					return path_data
+				}
+
+				return filepath.Join(path_prefix, path_data)
+			},
+			"APIRoot": func() string {
+
+				if path_prefix == "" {
+					return path_api
+				}
+
+				return filepath.Join(path_prefix, path_api)
+			},
+		})
+
+		t, err = t.ParseFS(html.FS, "*.html")
+
+		if err != nil {
+			return fmt.Errorf("Unable to parse templates, %v", err)
+		}
+
+		bootstrap_opts := bootstrap.DefaultBootstrapOptions()
+		leaflet_opts := leaflet.DefaultLeafletOptions()
+
+		tangramjs_opts := tangramjs.DefaultTangramJSOptions()
+		tangramjs_opts.Nextzen.APIKey, _ = lookup.StringVar(fs, www_flags.NEXTZEN_APIKEY)
+		tangramjs_opts.Nextzen.StyleURL, _ = lookup.StringVar(fs, www_flags.NEXTZEN_STYLE_URL)
+		tangramjs_opts.Nextzen.TileURL, _ = lookup.StringVar(fs, www_flags.NEXTZEN_TILE_URL)
+
+		err = bootstrap.AppendAssetHandlersWithPrefix(mux, path_prefix)
+
+		if err != nil {
+			return fmt.Errorf("Failed to append Bootstrap assets, %v", err)
+		}
+
+		if enable_tangram {
+
+			err = tangramjs.AppendAssetHandlersWithPrefix(mux, path_prefix)
+
+			if err != nil {
+				return fmt.Errorf("Failed to append Tangram.js assets, %v", err)
+			}
+
+		} else {
+
+			err = leaflet.AppendAssetHandlersWithPrefix(mux, path_prefix)
+
+			if err != nil {
+				return fmt.Errorf("Failed to append Leaflet assets, %v", err)
+			}
+		}
+
+		err = www.AppendStaticAssetHandlersWithPrefix(mux, path_prefix)
+
+		if err != nil {
+			return fmt.Errorf("Failed to append static assets, %v", err)
+		}
+
+		initial_lat, _ := lookup.Float64Var(fs, www_flags.INITIAL_LATITUDE)
+		initial_lon, _ := lookup.Float64Var(fs, www_flags.INITIAL_LONGITUDE)
+		initial_zoom, _ := lookup.IntVar(fs, www_flags.INITIAL_ZOOM)
+		max_bounds, _ := lookup.StringVar(fs, www_flags.MAX_BOUNDS)
+		leaflet_tile_url, _ := lookup.StringVar(fs, www_flags.LEAFLET_TILE_URL)
+
+		http_pip_opts := &www.PointInPolygonHandlerOptions{
+			Templates:        t,
+			InitialLatitude:  initial_lat,
+			InitialLongitude: initial_lon,
+			InitialZoom:      initial_zoom,
+			MaxBounds:        max_bounds,
+			LeafletTileURL:   leaflet_tile_url,
+		}
+
+		http_pip_handler, err := www.PointInPolygonHandler(spatial_app, http_pip_opts)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create point-in-polygon handler, %v", err)
+		}
+
+		http_pip_handler = bootstrap.AppendResourcesHandlerWithPrefix(http_pip_handler, bootstrap_opts, path_prefix)
+
+		if enable_tangram {
+			http_pip_handler = tangramjs.AppendResourcesHandlerWithPrefix(http_pip_handler, tangramjs_opts, path_prefix)
+		} else {
+			http_pip_handler = leaflet.AppendResourcesHandlerWithPrefix(http_pip_handler, leaflet_opts, path_prefix)
+		}
+
+		mux.Handle(path_pip, http_pip_handler)
+
+		if !strings.HasSuffix(path_pip, "/") {
+			mux.Handle(path_pip+"/", http_pip_handler)
+		}
+
+		index_opts := &www.IndexHandlerOptions{
+			Templates: t,
+		}
+
+		index_handler, err := www.IndexHandler(index_opts)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create index handler, %v", err)
+		}
+
+		index_handler = bootstrap.AppendResourcesHandlerWithPrefix(index_handler, bootstrap_opts, path_prefix)
+
+		mux.Handle("/", index_handler)
+	}
+
+	s, err := server.NewServer(ctx, server_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new server for '%s', %v", server_uri, err)
+	}
+
+	log.Printf("Listening on %s\n", s.Address())
+
+	err = s.ListenAndServe(ctx, mux)
+
+	if err != nil {
+		return fmt.Errorf("Failed to start server, %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-log"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/index"
+	"net/url"
+	"os"
+	"time"
+)
+
+// SnapshotDatabase is an interface for spatial databases that can be copied to, and restored from, a file.
+type SnapshotDatabase interface {
+	Metadata(context.Context) (map[string]string, error)
+	SetMetadata(context.Context, string, string) error
+	Snapshot(context.Context, string) error
+	RestoreSnapshot(context.Context, string) error
+}
+
+// snapshotOptions defines the snapshot of a spatial database that is used instead of indexing the paths
+// passed to the server at startup.
+type snapshotOptions struct {
+	Database SnapshotDatabase
+	Path     string
+	// The emitter URI used to index Paths.
+	EmitterURI string
+	Paths      []string
+	// The metadata describing how Paths are indexed, as returned by index.BuildMetadataWithFlagSet.
+	BuildMetadata map[string]string
+	Logger        *log.WOFLogger
+}
+
+// restoreSnapshot restores the snapshot defined by 'opts' in to its spatial database, returning true, if it is
+// newer than the files it was indexed from and was indexed with the same options. Otherwise it returns false
+// and the paths should be indexed as usual.
+func restoreSnapshot(ctx context.Context, opts *snapshotOptions) (bool, error) {
+
+	info, err := os.Stat(opts.Path)
+
+	if err != nil {
+
+		if os.IsNotExist(err) {
+			opts.Logger.Status("snapshot %s does not exist, indexing paths", opts.Path)
+			return false, nil
+		}
+
+		return false, fmt.Errorf("Failed to stat %s, %v", opts.Path, err)
+	}
+
+	last_modified, err := index.LastModified(ctx, opts.EmitterURI, opts.Paths...)
+
+	if err != nil {
+		opts.Logger.Warning("failed to determine when paths were last modified, indexing paths, %v", err)
+		return false, nil
+	}
+
+	if !info.ModTime().After(last_modified) {
+		opts.Logger.Status("snapshot %s is older than the paths being indexed, indexing paths", opts.Path)
+		return false, nil
+	}
+
+	// Check the snapshot (without restoring it) to make sure it was indexed from the same paths
+	// with the same options and uses the same geometry format as the current database
+
+	snapshot_metadata, err := readSnapshotMetadata(ctx, opts.Path)
+
+	if err != nil {
+		opts.Logger.Warning("failed to read snapshot %s, indexing paths, %v", opts.Path, err)
+		return false, nil
+	}
+
+	metadata, err := opts.Database.Metadata(ctx)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to read metadata, %v", err)
+	}
+
+	expected := map[string]string{
+		sqlite.METADATA_GEOMETRY_FORMAT: metadata[sqlite.METADATA_GEOMETRY_FORMAT],
+	}
+
+	for k, v := range opts.BuildMetadata {
+		expected[k] = v
+	}
+
+	for k, v := range expected {
+
+		if snapshot_metadata[k] != v {
+			opts.Logger.Status("snapshot %s has a different %s, indexing paths", opts.Path, k)
+			return false, nil
+		}
+	}
+
+	err = opts.Database.RestoreSnapshot(ctx, opts.Path)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to restore snapshot %s, %v", opts.Path, err)
+	}
+
+	opts.Logger.Status("restored snapshot %s, created %s", opts.Path, snapshot_metadata[sqlite.METADATA_BUILD_FINISHED])
+	return true, nil
+}
+
+// writeSnapshot records how the paths defined by 'opts' were indexed in the spatial database's metadata table
+// and then writes a snapshot of the database.
+func writeSnapshot(ctx context.Context, opts *snapshotOptions) error {
+
+	metadata := map[string]string{
+		sqlite.METADATA_BUILD_FINISHED: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	for k, v := range opts.BuildMetadata {
+		metadata[k] = v
+	}
+
+	for k, v := range metadata {
+
+		err := opts.Database.SetMetadata(ctx, k, v)
+
+		if err != nil {
+			return fmt.Errorf("Failed to set %s metadata, %v", k, err)
+		}
+	}
+
+	t1 := time.Now()
+
+	err := opts.Database.Snapshot(ctx, opts.Path)
+
+	if err != nil {
+		return err
+	}
+
+	opts.Logger.Status("wrote snapshot %s in %v", opts.Path, time.Since(t1))
+	return nil
+}
+
+// readSnapshotMetadata returns the contents of the metadata table in the snapshot at 'path', which is opened read-only.
+func readSnapshotMetadata(ctx context.Context, path string) (map[string]string, error) {
+
+	q := url.Values{}
+	q.Set("dsn", path)
+	q.Set("mode", "ro")
+
+	uri := fmt.Sprintf("sqlite://?%s", q.Encode())
+
+	db, err := sqlite.NewSQLiteSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Disconnect(ctx)
+
+	return db.(*sqlite.SQLiteSpatialDatabase).Metadata(ctx)
+}
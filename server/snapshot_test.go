@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-log"
+	sqlite "github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestoreSnapshot(t *testing.T) {
+
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "snapshot")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	// The files being indexed, last modified an hour ago
+
+	data := filepath.Join(root, "data")
+
+	err = os.Mkdir(data, 0755)
+
+	if err != nil {
+		t.Fatalf("Failed to create data directory, %v", err)
+	}
+
+	fixtures, err := spatialtest.Fixtures()
+
+	if err != nil {
+		t.Fatalf("Failed to load fixtures, %v", err)
+	}
+
+	last_modified := time.Now().Add(-1 * time.Hour)
+
+	for i, f := range fixtures {
+
+		path := filepath.Join(data, fmt.Sprintf("%d.geojson", i))
+
+		err := ioutil.WriteFile(path, f.Bytes(), 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write %s, %v", path, err)
+		}
+
+		err = os.Chtimes(path, last_modified, last_modified)
+
+		if err != nil {
+			t.Fatalf("Failed to set modification time for %s, %v", path, err)
+		}
+	}
+
+	build_metadata := map[string]string{
+		sqlite.METADATA_BUILD_PATHS: data,
+	}
+
+	path := filepath.Join(root, "snapshot.db")
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	opts := &snapshotOptions{
+		Database:      db.(*sqlite.SQLiteSpatialDatabase),
+		Path:          path,
+		EmitterURI:    "directory://",
+		Paths:         []string{data},
+		BuildMetadata: build_metadata,
+		Logger:        log.SimpleWOFLogger(),
+	}
+
+	err = writeSnapshot(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to write snapshot, %v", err)
+	}
+
+	// In-memory databases share a cache so the database needs to be closed, as it would be
+	// when the server is restarted, before restoring the snapshot in to a new one
+
+	db.Disconnect(ctx)
+
+	tests := []struct {
+		name string
+		// Metadata to use instead of build_metadata, if not nil.
+		metadata map[string]string
+		// The modification time to give the snapshot, if not zero.
+		modified time.Time
+		path     string
+		restored bool
+	}{
+		{name: "restored", restored: true},
+		{name: "different metadata", metadata: map[string]string{sqlite.METADATA_BUILD_PATHS: root}},
+		{name: "additional metadata", metadata: map[string]string{sqlite.METADATA_BUILD_PATHS: data, sqlite.METADATA_BUILD_IS_WOF: "true"}},
+		{name: "older than files", modified: last_modified.Add(-1 * time.Minute)},
+		{name: "missing", path: filepath.Join(root, "missing.db")},
+		{name: "restored (again)", modified: time.Now(), restored: true},
+	}
+
+	for _, test := range tests {
+
+		db, err := sqlite.NewSQLiteSpatialDatabase(ctx, "sqlite://?dsn=:memory:")
+
+		if err != nil {
+			t.Fatalf("%s: failed to create database, %v", test.name, err)
+		}
+
+		opts := &snapshotOptions{
+			Database:      db.(*sqlite.SQLiteSpatialDatabase),
+			Path:          path,
+			EmitterURI:    "directory://",
+			Paths:         []string{data},
+			BuildMetadata: build_metadata,
+			Logger:        log.SimpleWOFLogger(),
+		}
+
+		if test.metadata != nil {
+			opts.BuildMetadata = test.metadata
+		}
+
+		if test.path != "" {
+			opts.Path = test.path
+		}
+
+		if !test.modified.IsZero() {
+
+			err := os.Chtimes(path, test.modified, test.modified)
+
+			if err != nil {
+				t.Fatalf("%s: failed to set modification time for snapshot, %v", test.name, err)
+			}
+		}
+
+		restored, err := restoreSnapshot(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("%s: failed to restore snapshot, %v", test.name, err)
+		}
+
+		if restored != test.restored {
+			t.Fatalf("%s: expected restored to be %t", test.name, test.restored)
+		}
+
+		coord, err := geo.NewCoordinate(12.0, 12.0)
+
+		if err != nil {
+			t.Fatalf("%s: failed to create coordinate, %v", test.name, err)
+		}
+
+		rsp, err := db.PointInPolygon(ctx, coord)
+
+		if err != nil {
+			t.Fatalf("%s: point in polygon query failed, %v", test.name, err)
+		}
+
+		// 1001 and 1006 if the snapshot was restored, otherwise nothing since the paths haven't been indexed
+
+		expected := 0
+
+		if test.restored {
+			expected = 2
+		}
+
+		if len(rsp.Results()) != expected {
+			t.Fatalf("%s: expected %d results but got %d", test.name, expected, len(rsp.Results()))
+		}
+
+		db.Disconnect(ctx)
+	}
+}
@@ -0,0 +1,198 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Snapshot writes a copy of the database to 'path' using SQLite's online backup API. The copy is written to a
+// temporary file which is moved in to place once it is complete, so an existing file at 'path' is never left
+// half-written. Features can not be indexed or removed while the copy is being made.
+func (r *SQLiteSpatialDatabase) Snapshot(ctx context.Context, path string) error {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tmp_path := fmt.Sprintf("%s.tmp", path)
+
+	err := os.Remove(tmp_path)
+
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove %s, %v", tmp_path, err)
+	}
+
+	dest, err := sql.Open("sqlite3", fileURI(tmp_path, url.Values{"mode": []string{"rwc"}}))
+
+	if err != nil {
+		return fmt.Errorf("Failed to open %s, %v", tmp_path, err)
+	}
+
+	src, err := r.db.Conn()
+
+	if err != nil {
+		dest.Close()
+		return fmt.Errorf("Failed to connect to database, %v", err)
+	}
+
+	err = backupDatabase(ctx, dest, src)
+
+	// The destination needs to be closed, and any pending writes flushed, before it is moved in to place
+
+	close_err := dest.Close()
+
+	if err != nil {
+		os.Remove(tmp_path)
+		return fmt.Errorf("Failed to copy database, %v", err)
+	}
+
+	if close_err != nil {
+		os.Remove(tmp_path)
+		return fmt.Errorf("Failed to close %s, %v", tmp_path, close_err)
+	}
+
+	err = os.Rename(tmp_path, path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to move snapshot to %s, %v", path, err)
+	}
+
+	return nil
+}
+
+// RestoreSnapshot replaces the contents of the database with the contents of the database file at 'path', typically
+// one written by the Snapshot method, using SQLite's online backup API. Queries wait until the restore is complete.
+func (r *SQLiteSpatialDatabase) RestoreSnapshot(ctx context.Context, path string) error {
+
+	if r.read_only {
+		return ErrReadOnly
+	}
+
+	_, err := os.Stat(path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to stat %s, %v", path, err)
+	}
+
+	src, err := sql.Open("sqlite3", fileURI(path, url.Values{"mode": []string{"ro"}}))
+
+	if err != nil {
+		return fmt.Errorf("Failed to open %s, %v", path, err)
+	}
+
+	defer src.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dest, err := r.db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to connect to database, %v", err)
+	}
+
+	err = backupDatabase(ctx, dest, src)
+
+	if err != nil {
+		return fmt.Errorf("Failed to restore %s, %v", path, err)
+	}
+
+	// Cached SPR and polygon data belongs to the previous contents of the database
+
+	r.gocache.Flush()
+
+	if r.polygon_cache != nil {
+		r.polygon_cache.Flush()
+	}
+
+	err = r.validateDatabase(ctx, r.db)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate %s, %v", path, err)
+	}
+
+	err = r.migrateDatabase(ctx, r.db)
+
+	if err != nil {
+		return fmt.Errorf("Failed to migrate %s, %v", path, err)
+	}
+
+	return nil
+}
+
+// backupDatabase copies the "main" database in 'src' to the "main" database in 'dest', replacing its contents.
+func backupDatabase(ctx context.Context, dest *sql.DB, src *sql.DB) error {
+
+	dest_conn, err := dest.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer dest_conn.Close()
+
+	src_conn, err := src.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer src_conn.Close()
+
+	return dest_conn.Raw(func(dest_driver interface{}) error {
+
+		return src_conn.Raw(func(src_driver interface{}) error {
+
+			dest_sqlite, ok := dest_driver.(*sqlite3.SQLiteConn)
+
+			if !ok {
+				return fmt.Errorf("Unsupported destination connection %T", dest_driver)
+			}
+
+			src_sqlite, ok := src_driver.(*sqlite3.SQLiteConn)
+
+			if !ok {
+				return fmt.Errorf("Unsupported source connection %T", src_driver)
+			}
+
+			backup, err := dest_sqlite.Backup("main", src_sqlite, "main")
+
+			if err != nil {
+				return err
+			}
+
+			// Copy every page in a single step; Step returns false, without an error, if the
+			// database is busy or locked in which case wait and try again
+
+			for {
+
+				select {
+				case <-ctx.Done():
+					backup.Close()
+					return ctx.Err()
+				default:
+					// pass
+				}
+
+				done, err := backup.Step(-1)
+
+				if err != nil {
+					backup.Close()
+					return err
+				}
+
+				if done {
+					break
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			return backup.Close()
+		})
+	})
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "snapshot")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "snapshot.db")
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	sqlite_db := db.(*SQLiteSpatialDatabase)
+
+	err = sqlite_db.SetMetadata(ctx, METADATA_BUILD_PATHS, "test")
+
+	if err != nil {
+		t.Fatalf("Failed to set metadata, %v", err)
+	}
+
+	// Snapshot twice to make sure an existing snapshot is replaced
+
+	for i := 0; i < 2; i++ {
+
+		err = sqlite_db.Snapshot(ctx, path)
+
+		if err != nil {
+			t.Fatalf("Failed to write snapshot, %v", err)
+		}
+	}
+
+	_, err = os.Stat(path + ".tmp")
+
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected temporary snapshot file to have been removed")
+	}
+
+	// In-memory databases share a cache, so the source database needs to be closed before
+	// creating another one to restore the snapshot in to, as it would be when restarting
+
+	db.Disconnect(ctx)
+
+	restored, err := database.NewSpatialDatabase(ctx, "sqlite://?dsn=:memory:")
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer restored.Disconnect(ctx)
+
+	restored_db := restored.(*SQLiteSpatialDatabase)
+
+	err = checkSwapResults(ctx, restored_db)
+
+	if err != nil {
+		t.Fatalf("Before restoring snapshot, %v", err)
+	}
+
+	err = restored_db.RestoreSnapshot(ctx, path)
+
+	if err != nil {
+		t.Fatalf("Failed to restore snapshot, %v", err)
+	}
+
+	err = checkSwapResults(ctx, restored_db, "1001", "1006")
+
+	if err != nil {
+		t.Fatalf("After restoring snapshot, %v", err)
+	}
+
+	metadata, err := restored_db.Metadata(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to read metadata, %v", err)
+	}
+
+	if metadata[METADATA_BUILD_PATHS] != "test" {
+		t.Fatalf("Expected restored metadata to include %s", METADATA_BUILD_PATHS)
+	}
+
+	fh, err := restored_db.Read(ctx, "1001.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to read 1001 from restored database, %v", err)
+	}
+
+	body, err := ioutil.ReadAll(fh)
+	fh.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to read body of 1001, %v", err)
+	}
+
+	if !strings.Contains(string(body), `"wof:name": "Donut"`) {
+		t.Fatalf("Unexpected body for 1001 in restored database")
+	}
+
+	err = restored_db.RestoreSnapshot(ctx, filepath.Join(root, "missing.db"))
+
+	if err == nil {
+		t.Fatalf("Expected restoring a missing snapshot to fail")
+	}
+}
+
+func TestRestoreSnapshotReadOnly(t *testing.T) {
+
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "snapshot")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "snapshot.db")
+
+	err = createSwapDatabase(ctx, path, "1001")
+
+	if err != nil {
+		t.Fatalf("Failed to create %s, %v", path, err)
+	}
+
+	db, err := database.NewSpatialDatabase(ctx, "sqlite://?mode=ro&dsn="+path)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	err = db.(*SQLiteSpatialDatabase).RestoreSnapshot(ctx, path)
+
+	if err != ErrReadOnly {
+		t.Fatalf("Expected restoring a snapshot in to a read-only database to fail with ErrReadOnly, got %v", err)
+	}
+}
@@ -0,0 +1,486 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/skelterjohn/geom"
+	wof_geojson "github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/geometry"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"github.com/whosonfirst/go-whosonfirst-log"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/timeout"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"github.com/whosonfirst/go-whosonfirst-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-sqlite-features/tables"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+func init() {
+	ctx := context.Background()
+	database.RegisterSpatialDatabase(ctx, "spatialite", NewSpatiaLiteSpatialDatabase)
+}
+
+// SpatiaLiteSpatialDatabase is a database.SpatialDatabase implementation that stores geometries in the SpatiaLite
+// "geometries" table defined by the go-whosonfirst-sqlite-features package and uses SpatiaLite's spatial index and
+// ST_Contains and ST_Intersects functions to answer queries. It returns the same SPR results as SQLiteSpatialDatabase
+// so that the two can be compared. It requires the SpatiaLite extension (mod_spatialite) to be installed.
+type SpatiaLiteSpatialDatabase struct {
+	database.SpatialDatabase
+	Logger           *log.WOFLogger
+	mu               *sync.RWMutex
+	db               *sqlite_database.SQLiteDatabase
+	geometries_table sqlite.Table
+	spr_table        sqlite.Table
+	geojson_table    sqlite.Table
+	gocache          *gocache.Cache
+	query_timeout    time.Duration
+}
+
+type spatiaLiteRow struct {
+	id        string
+	is_alt    bool
+	alt_label string
+}
+
+func (row *spatiaLiteRow) Path() string {
+
+	if row.is_alt {
+		return fmt.Sprintf("%s-alt-%s", row.id, row.alt_label)
+	}
+
+	return row.id
+}
+
+// NewSpatiaLiteSpatialDatabase returns a new SpatiaLiteSpatialDatabase instance configured by 'uri' which is
+// expected to take the form of:
+//
+//	spatialite://?dsn={DSN}
+//
+// Where {DSN} is the path to a SQLite database. An optional 'query_timeout' parameter, whose value is a Go
+// duration string, may also be included.
+func NewSpatiaLiteSpatialDatabase(ctx context.Context, uri string) (database.SpatialDatabase, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+
+	dsn := q.Get("dsn")
+
+	if dsn == "" {
+		return nil, errors.New("Missing 'dsn' parameter")
+	}
+
+	// The "spatialite" driver is registered by the go-spatialite package and loads the
+	// SpatiaLite extension for every new connection
+
+	sqlite_db, err := sqlite_database.NewDBWithDriver("spatialite", dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSpatiaLiteSpatialDatabaseWithDatabase(ctx, uri, sqlite_db)
+}
+
+// NewSpatiaLiteSpatialDatabaseWithDatabase returns a new SpatiaLiteSpatialDatabase instance for 'sqlite_db',
+// which must have been opened using the "spatialite" driver, configured by 'uri'.
+func NewSpatiaLiteSpatialDatabaseWithDatabase(ctx context.Context, uri string, sqlite_db *sqlite_database.SQLiteDatabase) (database.SpatialDatabase, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+
+	query_timeout, err := timeout.QueryTimeout(q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Creating the geometries table will fail if the SpatiaLite extension isn't available
+
+	geometries_table, err := tables.NewGeometriesTableWithDatabase(sqlite_db)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create geometries table, %v", err)
+	}
+
+	spr_table, err := tables.NewSPRTableWithDatabase(sqlite_db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	geojson_table, err := tables.NewGeoJSONTableWithDatabase(sqlite_db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger := log.SimpleWOFLogger("index")
+
+	expires := 5 * time.Minute
+	cleanup := 30 * time.Minute
+
+	gc := gocache.New(expires, cleanup)
+
+	spatial_db := &SpatiaLiteSpatialDatabase{
+		Logger:           logger,
+		mu:               new(sync.RWMutex),
+		db:               sqlite_db,
+		geometries_table: geometries_table,
+		spr_table:        spr_table,
+		geojson_table:    geojson_table,
+		gocache:          gc,
+		query_timeout:    query_timeout,
+	}
+
+	return spatial_db, nil
+}
+
+func (r *SpatiaLiteSpatialDatabase) Disconnect(ctx context.Context) error {
+	return r.db.Close()
+}
+
+func (r *SpatiaLiteSpatialDatabase) IndexFeature(ctx context.Context, f wof_geojson.Feature) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Like the rtree table only polygons are indexed for spatial queries
+
+	switch geometry.Type(f) {
+	case "Polygon", "MultiPolygon":
+
+		err := r.geometries_table.IndexRecord(r.db, f)
+
+		if err != nil {
+			return err
+		}
+
+	default:
+
+		// Remove any geometry indexed for an earlier version of the feature that was a polygon
+		// so that it is no longer returned by spatial queries
+
+		conn, err := r.db.Conn()
+
+		if err != nil {
+			return err
+		}
+
+		q := fmt.Sprintf("DELETE FROM %s WHERE id = ? AND alt_label = ?", r.geometries_table.Name())
+
+		_, err = conn.ExecContext(ctx, q, f.Id(), whosonfirst.AltLabel(f))
+
+		if err != nil {
+			return fmt.Errorf("Failed to remove geometry for %s, %v", f.Id(), err)
+		}
+	}
+
+	err := r.spr_table.IndexRecord(r.db, f)
+
+	if err != nil {
+		return err
+	}
+
+	return r.geojson_table.IndexRecord(r.db, f)
+}
+
+func (r *SpatiaLiteSpatialDatabase) PointInPolygon(ctx context.Context, coord *geom.Coord, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	// The spatial index is used to find the geometries whose bounding box contains 'coord'
+	// before the (more expensive) ST_Contains test is performed
+
+	q := fmt.Sprintf(`SELECT g.id, g.is_alt, g.alt_label FROM %[1]s AS g WHERE ST_Contains(g.geom, MakePoint(?, ?, 4326)) AND g.ROWID IN (
+		SELECT ROWID FROM SpatialIndex WHERE f_table_name = '%[1]s' AND f_geometry_column = 'geom' AND search_frame = MakePoint(?, ?, 4326)
+	)`, r.geometries_table.Name())
+
+	return r.query(ctx, q, []interface{}{coord.X, coord.Y, coord.X, coord.Y}, filters...)
+}
+
+// Intersects returns every feature whose geometry intersects 'rect' and that matches 'filters'.
+func (r *SpatiaLiteSpatialDatabase) Intersects(ctx context.Context, rect *geom.Rect, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	q := fmt.Sprintf(`SELECT g.id, g.is_alt, g.alt_label FROM %[1]s AS g WHERE ST_Intersects(g.geom, BuildMbr(?, ?, ?, ?, 4326)) AND g.ROWID IN (
+		SELECT ROWID FROM SpatialIndex WHERE f_table_name = '%[1]s' AND f_geometry_column = 'geom' AND search_frame = BuildMbr(?, ?, ?, ?, 4326)
+	)`, r.geometries_table.Name())
+
+	args := []interface{}{
+		rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y,
+		rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y,
+	}
+
+	return r.query(ctx, q, args, filters...)
+}
+
+// query performs 'q', which is expected to return the id, is_alt and alt_label columns from the geometries
+// table, and returns the SPR for each feature (and alternate geometry) that matches 'filters'.
+func (r *SpatiaLiteSpatialDatabase) query(ctx context.Context, q string, args []interface{}, filters ...spatial.Filter) (spr.StandardPlacesResults, error) {
+
+	ctx, cancel := timeout.WithQueryTimeout(ctx, r.query_timeout)
+	defer cancel()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matches, err := r.queryRows(ctx, q, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]spr.StandardPlacesResult, 0)
+	seen := make(map[string]bool)
+
+	for _, row := range matches {
+
+		path := row.Path()
+
+		if seen[path] {
+			continue
+		}
+
+		seen[path] = true
+
+		s, err := retrieveCachedSPR(ctx, r.db, r.spr_table, r.gocache, path)
+
+		if err != nil {
+			r.Logger.Error("Failed to retrieve feature cache for %s, %v", path, err)
+			continue
+		}
+
+		matches_filters := true
+
+		for _, f := range filters {
+
+			err = filter.FilterSPR(f, s)
+
+			if err != nil {
+				r.Logger.Debug("SKIP %s because filter error %s", path, err)
+				matches_filters = false
+				break
+			}
+		}
+
+		if matches_filters {
+			results = append(results, s)
+		}
+	}
+
+	spr_results := &SQLiteResults{
+		Places: results,
+	}
+
+	return spr_results, nil
+}
+
+func (r *SpatiaLiteSpatialDatabase) queryRows(ctx context.Context, q string, args ...interface{}) ([]*spatiaLiteRow, error) {
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	matches := make([]*spatiaLiteRow, 0)
+
+	for rows.Next() {
+
+		var id string
+		var is_alt int32
+		var alt_label string
+
+		err := rows.Scan(&id, &is_alt, &alt_label)
+
+		if err != nil {
+			return nil, err
+		}
+
+		row := &spatiaLiteRow{
+			id:        id,
+			is_alt:    is_alt == 1,
+			alt_label: alt_label,
+		}
+
+		matches = append(matches, row)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+func (r *SpatiaLiteSpatialDatabase) PointInPolygonWithChannels(ctx context.Context, rsp_ch chan spr.StandardPlacesResult, err_ch chan error, done_ch chan bool, coord *geom.Coord, filters ...spatial.Filter) {
+
+	defer func() {
+		timeout.SendDone(ctx, done_ch)
+	}()
+
+	rsp, err := r.PointInPolygon(ctx, coord, filters...)
+
+	if err != nil {
+		timeout.SendError(ctx, err_ch, err)
+		return
+	}
+
+	for _, s := range rsp.Results() {
+
+		select {
+		case <-ctx.Done():
+			return
+		case rsp_ch <- s:
+			// pass
+		}
+	}
+}
+
+func (r *SpatiaLiteSpatialDatabase) PointInPolygonCandidates(ctx context.Context, coord *geom.Coord, filters ...spatial.Filter) ([]*spatial.PointInPolygonCandidate, error) {
+
+	ctx, cancel := timeout.WithQueryTimeout(ctx, r.query_timeout)
+	defer cancel()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Like the rtree backend candidates are the geometries whose bounding box contains 'coord'
+
+	q := fmt.Sprintf(`SELECT g.ROWID, g.id, g.alt_label, MbrMinX(g.geom), MbrMinY(g.geom), MbrMaxX(g.geom), MbrMaxY(g.geom) FROM %[1]s AS g WHERE g.ROWID IN (
+		SELECT ROWID FROM SpatialIndex WHERE f_table_name = '%[1]s' AND f_geometry_column = 'geom' AND search_frame = MakePoint(?, ?, 4326)
+	)`, r.geometries_table.Name())
+
+	rows, err := conn.QueryContext(ctx, q, coord.X, coord.Y)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	candidates := make([]*spatial.PointInPolygonCandidate, 0)
+
+	for rows.Next() {
+
+		var row_id string
+		var id string
+		var alt_label string
+		var minx float64
+		var miny float64
+		var maxx float64
+		var maxy float64
+
+		err := rows.Scan(&row_id, &id, &alt_label, &minx, &miny, &maxx, &maxy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		bounds := geom.Rect{
+			Min: geom.Coord{X: minx, Y: miny},
+			Max: geom.Coord{X: maxx, Y: maxy},
+		}
+
+		c := &spatial.PointInPolygonCandidate{
+			Id:        fmt.Sprintf("%s#%s", id, row_id),
+			FeatureId: id,
+			AltLabel:  alt_label,
+			Bounds:    &bounds,
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return candidates, nil
+}
+
+func (r *SpatiaLiteSpatialDatabase) PointInPolygonCandidatesWithChannels(ctx context.Context, rsp_ch chan *spatial.PointInPolygonCandidate, err_ch chan error, done_ch chan bool, coord *geom.Coord, filters ...spatial.Filter) {
+
+	defer func() {
+		timeout.SendDone(ctx, done_ch)
+	}()
+
+	candidates, err := r.PointInPolygonCandidates(ctx, coord, filters...)
+
+	if err != nil {
+		timeout.SendError(ctx, err_ch, err)
+		return
+	}
+
+	for _, c := range candidates {
+
+		select {
+		case <-ctx.Done():
+			return
+		case rsp_ch <- c:
+			// pass
+		}
+	}
+}
+
+// whosonfirst/go-reader interface
+
+func (r *SpatiaLiteSpatialDatabase) Read(ctx context.Context, str_uri string) (io.ReadSeekCloser, error) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return readFeature(ctx, r.db, r.geojson_table, str_uri)
+}
+
+func (r *SpatiaLiteSpatialDatabase) ReaderURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+// whosonfirst/go-writer interface
+
+func (r *SpatiaLiteSpatialDatabase) Write(ctx context.Context, key string, fh io.ReadSeeker) (int64, error) {
+	return 0, fmt.Errorf("Not implemented")
+}
+
+func (r *SpatiaLiteSpatialDatabase) WriterURI(ctx context.Context, str_uri string) string {
+	return str_uri
+}
+
+func (r *SpatiaLiteSpatialDatabase) Close(ctx context.Context) error {
+	return nil
+}
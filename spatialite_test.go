@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"os"
+	"testing"
+)
+
+// The SpatiaLite tests are skipped if the SpatiaLite extension (mod_spatialite) isn't installed unless the
+// REQUIRE_SPATIALITE environment variable is set, in which case they fail.
+
+const SPATIALITE_TEST_URI string = "spatialite://?dsn=:memory:"
+
+func TestSpatiaLiteSpatialDatabase(t *testing.T) {
+
+	ctx := context.Background()
+
+	requireSpatiaLite(ctx, t)
+
+	new_db := func(ctx context.Context) (database.SpatialDatabase, error) {
+		return database.NewSpatialDatabase(ctx, SPATIALITE_TEST_URI)
+	}
+
+	// SpatiaLite databases don't split polygons that cross the antimeridian
+
+	opts := &spatialtest.Options{
+		SkipAntimeridian: true,
+	}
+
+	err := spatialtest.TestSpatialDatabaseWithOptions(ctx, new_db, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSpatiaLiteReindexPoint checks that a polygon is no longer returned by spatial queries once its
+// feature has been reindexed with a point geometry.
+func TestSpatiaLiteReindexPoint(t *testing.T) {
+
+	ctx := context.Background()
+
+	requireSpatiaLite(ctx, t)
+
+	db, err := database.NewSpatialDatabase(ctx, SPATIALITE_TEST_URI)
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	for i, max := range []float64{10.0, 0.0} {
+
+		f, err := reindexFeature("Reindexed", int64(1600000000+i), 0.0, max)
+
+		if err != nil {
+			t.Fatalf("Failed to load feature, %v", err)
+		}
+
+		err = db.IndexFeature(ctx, f)
+
+		if err != nil {
+			t.Fatalf("Failed to index feature, %v", err)
+		}
+
+		results, err := pointInPolygonResults(ctx, db, 5.0, 5.0)
+
+		if err != nil {
+			t.Fatalf("Failed to perform point-in-polygon query, %v", err)
+		}
+
+		expected := 1
+
+		if max == 0.0 {
+			expected = 0
+		}
+
+		if len(results) != expected {
+			t.Fatalf("Expected %d results for geometry with maximum %f but got %d", expected, max, len(results))
+		}
+	}
+}
+
+// requireSpatiaLite skips 't', or fails it if REQUIRE_SPATIALITE is set, when a SpatiaLite database can't be created.
+func requireSpatiaLite(ctx context.Context, t *testing.T) {
+
+	// Creating a database fails if the SpatiaLite extension isn't installed
+
+	db, err := database.NewSpatialDatabase(ctx, SPATIALITE_TEST_URI)
+
+	if err != nil {
+
+		if os.Getenv("REQUIRE_SPATIALITE") != "" {
+			t.Fatalf("Failed to create SpatiaLite database, %v", err)
+		}
+
+		t.Skipf("Skipping SpatiaLite tests because the SpatiaLite extension (mod_spatialite) is not available, %v", err)
+	}
+
+	db.Disconnect(ctx)
+}
@@ -0,0 +1,201 @@
+package spatialtest
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"strconv"
+	"text/template"
+)
+
+//go:embed fixtures/templates/*.geojson.tmpl
+var feature_templates embed.FS
+
+var templates = template.Must(template.ParseFS(feature_templates, "fixtures/templates/*.geojson.tmpl"))
+
+// The wof:lastmodified property of features whose FeatureOptions don't define one.
+const DEFAULT_LASTMODIFIED int64 = 1600000000
+
+// FeatureOptions describe a feature, other than the fixtures returned by Fixtures, for tests that need features
+// with particular IDs, names or geometries. The feature's geometry is a point if its minimum and maximum coordinates
+// are the same and otherwise a rectangle from (MinX, MinY) to (MaxX, MaxY).
+type FeatureOptions struct {
+	Id        int64
+	Name      string
+	Placetype string
+	// The wof:lastmodified property for Who's On First features or DEFAULT_LASTMODIFIED if 0.
+	LastModified int64
+	MinX         float64
+	MinY         float64
+	MaxX         float64
+	MaxY         float64
+}
+
+// templateVars are the (JSON-encoded) values passed to the feature templates.
+type templateVars struct {
+	Id           int64
+	Name         string
+	Placetype    string
+	LastModified int64
+	Latitude     string
+	Longitude    string
+	BoundingBox  string
+	Geometry     string
+}
+
+// FeatureBytes returns a Who's On First GeoJSON feature described by 'opts'.
+func FeatureBytes(opts *FeatureOptions) ([]byte, error) {
+	return renderFeature("wof.geojson.tmpl", opts)
+}
+
+// PlainFeatureBytes returns a "plain old" GeoJSON feature described by 'opts', whose properties can be read
+// using the same property mapping as the "plain old" GeoJSON fixture.
+func PlainFeatureBytes(opts *FeatureOptions) ([]byte, error) {
+	return renderFeature("plain.geojson.tmpl", opts)
+}
+
+// NewFeature returns the Who's On First feature described by 'opts'.
+func NewFeature(opts *FeatureOptions) (geojson.Feature, error) {
+
+	body, err := FeatureBytes(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return feature.LoadFeature(body)
+}
+
+// NewDatabaseWithFeatures returns a new spatial database for 'uri' with 'features' indexed in it.
+func NewDatabaseWithFeatures(ctx context.Context, uri string, features ...geojson.Feature) (database.SpatialDatabase, error) {
+
+	db, err := database.NewSpatialDatabase(ctx, uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create %s database, %v", uri, err)
+	}
+
+	for _, f := range features {
+
+		err := db.IndexFeature(ctx, f)
+
+		if err != nil {
+			db.Disconnect(ctx)
+			return nil, fmt.Errorf("Failed to index %s in %s database, %v", f.Id(), uri, err)
+		}
+	}
+
+	return db, nil
+}
+
+// NewFixturesDatabase returns a new spatial database for 'uri' with the fixtures whose IDs are 'ids', including
+// their alternate geometries, indexed in it. If 'ids' is empty all the fixtures are indexed.
+func NewFixturesDatabase(ctx context.Context, uri string, ids ...string) (database.SpatialDatabase, error) {
+
+	fixtures, err := Fixtures()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return NewDatabaseWithFeatures(ctx, uri, fixtures...)
+	}
+
+	features := make([]geojson.Feature, 0)
+
+	for _, f := range fixtures {
+
+		for _, id := range ids {
+
+			if f.Id() == id {
+				features = append(features, f)
+				break
+			}
+		}
+	}
+
+	return NewDatabaseWithFeatures(ctx, uri, features...)
+}
+
+func renderFeature(name string, opts *FeatureOptions) ([]byte, error) {
+
+	str_name, err := json.Marshal(opts.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	str_placetype, err := json.Marshal(opts.Placetype)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var geometry interface{}
+
+	if opts.MinX == opts.MaxX && opts.MinY == opts.MaxY {
+
+		geometry = map[string]interface{}{
+			"type":        "Point",
+			"coordinates": []float64{opts.MinX, opts.MinY},
+		}
+
+	} else {
+
+		ring := [][]float64{
+			{opts.MinX, opts.MinY},
+			{opts.MaxX, opts.MinY},
+			{opts.MaxX, opts.MaxY},
+			{opts.MinX, opts.MaxY},
+			{opts.MinX, opts.MinY},
+		}
+
+		geometry = map[string]interface{}{
+			"type":        "Polygon",
+			"coordinates": [][][]float64{ring},
+		}
+	}
+
+	str_geometry, err := json.Marshal(geometry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	last_modified := opts.LastModified
+
+	if last_modified == 0 {
+		last_modified = DEFAULT_LASTMODIFIED
+	}
+
+	vars := &templateVars{
+		Id:           opts.Id,
+		Name:         string(str_name),
+		Placetype:    string(str_placetype),
+		LastModified: last_modified,
+		Latitude:     formatFloat((opts.MinY + opts.MaxY) / 2),
+		Longitude:    formatFloat((opts.MinX + opts.MaxX) / 2),
+		BoundingBox:  fmt.Sprintf("%s,%s,%s,%s", formatFloat(opts.MinX), formatFloat(opts.MinY), formatFloat(opts.MaxX), formatFloat(opts.MaxY)),
+		Geometry:     string(str_geometry),
+	}
+
+	var buf bytes.Buffer
+
+	err = templates.ExecuteTemplate(&buf, name, vars)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to render %s, %v", name, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,650 @@
+// Package spatialtest implements a suite of conformance tests for go-whosonfirst-spatial/database.SpatialDatabase
+// implementations, in the style of the testing/fstest package. It indexes a bundled set of fixtures, covering
+// polygons with holes, multipolygons, alternate geometries, polygons that cross the antimeridian, a polygon whose
+// edges run along the antimeridian without crossing it, point features and "plain old" GeoJSON features, and checks the results of point-in-polygon, candidate and Read queries.
+package spatialtest
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"github.com/whosonfirst/go-whosonfirst-spatial"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/mapping"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/filter"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed fixtures/*.geojson
+var fixtures embed.FS
+
+// The fixtures in the order they are indexed. Alternate geometries are indexed after the features they belong
+// to so that it is possible to tell whether they have replaced them.
+var fixture_names = []string{
+	"1001.geojson",
+	"1002.geojson",
+	"1003.geojson",
+	"1004.geojson",
+	"1005.geojson",
+	"1006.geojson",
+	"1007.geojson",
+	"1008.geojson",
+	"1001-alt-quattroshapes.geojson",
+}
+
+// The ID of the fixture whose polygon crosses the antimeridian.
+const antimeridian_fixture_id string = "1003"
+
+// A newer version of the multipolygon fixture (1002) without its second polygon. It is not one of the fixtures
+// returned by Fixtures and is only indexed to check that reindexing a feature replaces its previous geometry.
+const shrunk_fixture_name string = "1002-shrunk.geojson"
+
+// The property mapping used for fixtures that are "plain old" GeoJSON features.
+var fixture_mapping = &mapping.PropertyMapping{
+	Name:      "properties.name",
+	Placetype: "properties.type",
+	Country:   "properties.country",
+}
+
+// NewSpatialDatabaseFunc is a function that returns a new, empty, database.SpatialDatabase instance to test.
+type NewSpatialDatabaseFunc func(context.Context) (database.SpatialDatabase, error)
+
+// RemoveFeatureDatabase is an interface for spatial databases that can remove features once they have been
+// indexed. It is only tested for databases that implement it.
+type RemoveFeatureDatabase interface {
+	RemoveFeature(context.Context, string, string) error
+}
+
+type pointInPolygonTest struct {
+	name      string
+	longitude float64
+	latitude  float64
+	query     string
+	expected  []string
+	// Whether the test depends on the fixture whose polygon crosses the antimeridian.
+	crosses_antimeridian bool
+}
+
+// The IDs of the features expected to be returned by point-in-polygon queries for the fixtures.
+var point_in_polygon_tests = []*pointInPolygonTest{
+	{name: "polygon", longitude: 12.0, latitude: 12.0, expected: []string{"1001", "1006"}},
+	{name: "polygon with hole", longitude: 15.0, latitude: 15.0, expected: []string{"1006"}},
+	{name: "outside", longitude: -50.0, latitude: -50.0, expected: []string{}},
+	{name: "multipolygon (first)", longitude: 31.0, latitude: 11.0, expected: []string{"1002"}},
+	{name: "multipolygon (second)", longitude: 36.0, latitude: 11.0, expected: []string{"1002"}},
+	{name: "multipolygon (between)", longitude: 33.5, latitude: 11.0, expected: []string{}},
+	{name: "alternate geometry", longitude: 41.0, latitude: 11.0, expected: []string{}},
+	{name: "antimeridian (east)", longitude: 175.0, latitude: 0.0, expected: []string{"1003"}, crosses_antimeridian: true},
+	{name: "antimeridian (west)", longitude: -175.0, latitude: 0.0, expected: []string{"1003"}, crosses_antimeridian: true},
+	{name: "antimeridian (outside east)", longitude: 160.0, latitude: 0.0, expected: []string{}},
+	{name: "antimeridian (outside west)", longitude: -160.0, latitude: 0.0, expected: []string{}},
+	{name: "antimeridian edges (-120)", longitude: -120.0, latitude: -80.0, expected: []string{"1007"}},
+	{name: "antimeridian edges (-60)", longitude: -60.0, latitude: -80.0, expected: []string{"1007"}},
+	{name: "antimeridian edges (60)", longitude: 60.0, latitude: -80.0, expected: []string{"1007"}},
+	{name: "antimeridian edges (120)", longitude: 120.0, latitude: -80.0, expected: []string{"1007"}},
+	{name: "antimeridian edges (outside)", longitude: 120.0, latitude: -60.0, expected: []string{}},
+	{name: "geojson", longitude: 51.0, latitude: 11.0, expected: []string{"1004"}},
+	{name: "placetype filter", longitude: 12.0, latitude: 12.0, query: "placetype=region", expected: []string{"1001"}},
+	{name: "placetypes filter", longitude: 12.0, latitude: 12.0, query: "placetype=region&placetype=country", expected: []string{"1001", "1006"}},
+	{name: "is_current filter", longitude: 31.0, latitude: 11.0, query: "is_current=1", expected: []string{}},
+	{name: "is_current filter (not current)", longitude: 31.0, latitude: 11.0, query: "is_current=0", expected: []string{"1002"}},
+}
+
+// Query is a point-in-polygon query, with an optional filter, performed against the fixtures.
+type Query struct {
+	Name      string
+	Longitude float64
+	Latitude  float64
+	// A URL-encoded query string, as passed to filter.NewSPRFilterFromQuery, or empty for no filter.
+	Filter string
+}
+
+// Queries returns the point-in-polygon queries performed by TestSpatialDatabase so that other tests can compare
+// the results returned by different spatial databases.
+func Queries() []*Query {
+
+	queries := make([]*Query, len(point_in_polygon_tests))
+
+	for i, test := range point_in_polygon_tests {
+
+		queries[i] = &Query{
+			Name:      test.name,
+			Longitude: test.longitude,
+			Latitude:  test.latitude,
+			Filter:    test.query,
+		}
+	}
+
+	return queries
+}
+
+type candidatesTest struct {
+	name      string
+	longitude float64
+	latitude  float64
+	expected  []string
+	// Whether the test depends on the fixture whose polygon crosses the antimeridian.
+	crosses_antimeridian bool
+}
+
+// The IDs of the features expected to be returned by candidate queries, whose bounding boxes contain the
+// coordinate, for the fixtures.
+var candidates_tests = []*candidatesTest{
+	{name: "polygon", longitude: 12.0, latitude: 12.0, expected: []string{"1001", "1006"}},
+	{name: "polygon with hole", longitude: 15.0, latitude: 15.0, expected: []string{"1001", "1006"}},
+	{name: "multipolygon (between)", longitude: 33.5, latitude: 11.0, expected: []string{}},
+	{name: "alternate geometry", longitude: 41.0, latitude: 11.0, expected: []string{}},
+	{name: "antimeridian (east)", longitude: 175.0, latitude: 0.0, expected: []string{"1003"}, crosses_antimeridian: true},
+	{name: "antimeridian (west)", longitude: -175.0, latitude: 0.0, expected: []string{"1003"}, crosses_antimeridian: true},
+	{name: "antimeridian edges", longitude: 60.0, latitude: -80.0, expected: []string{"1007"}},
+}
+
+type readTest struct {
+	name     string
+	uri      string
+	expected string
+}
+
+// The fixtures expected to be returned by Read for a URI. An empty fixture means that reading the URI
+// should fail.
+var read_tests = []*readTest{
+	{name: "polygon", uri: "1001.geojson", expected: "1001.geojson"},
+	{name: "multipolygon", uri: "1002.geojson", expected: "1002.geojson"},
+	{name: "geojson", uri: "1004.geojson", expected: "1004.geojson"},
+	{name: "point", uri: "1005.geojson", expected: "1005.geojson"},
+	{name: "alternate geometry", uri: "1001-alt-quattroshapes.geojson", expected: ""},
+	{name: "missing", uri: "9999.geojson", expected: ""},
+}
+
+// Fixtures returns the features used to test spatial databases, in the order they should be indexed.
+func Fixtures() ([]geojson.Feature, error) {
+
+	features := make([]geojson.Feature, len(fixture_names))
+
+	for i, name := range fixture_names {
+
+		f, err := loadFixture(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		features[i] = f
+	}
+
+	return features, nil
+}
+
+// IndexFixtures indexes the features returned by Fixtures in 'db'.
+func IndexFixtures(ctx context.Context, db database.SpatialDatabase) error {
+
+	features, err := Fixtures()
+
+	if err != nil {
+		return err
+	}
+
+	for _, f := range features {
+
+		err := db.IndexFeature(ctx, f)
+
+		if err != nil {
+			return fmt.Errorf("Failed to index %s, %v", f.Id(), err)
+		}
+	}
+
+	return nil
+}
+
+// Options define which of the checks performed by TestSpatialDatabaseWithOptions are skipped.
+type Options struct {
+	// Don't index the fixture whose polygon crosses the antimeridian, or check the results that include it,
+	// for spatial databases that don't split those polygons.
+	SkipAntimeridian bool
+}
+
+// TestSpatialDatabase tests the spatial databases returned by 'new_db'. It indexes the fixtures in a new
+// database and checks the results of point-in-polygon (with and without filters), candidate and Read queries.
+// It then indexes the fixtures twice, followed by a feature whose geometry has changed, in a second database to
+// check that re-indexing a feature replaces it and, if the database implements the RemoveFeatureDatabase interface,
+// that removed features are no longer returned. Each database is disconnected before the next one is created. If
+// any checks fail the error returned lists all of them.
+func TestSpatialDatabase(ctx context.Context, new_db NewSpatialDatabaseFunc) error {
+	return TestSpatialDatabaseWithOptions(ctx, new_db, &Options{})
+}
+
+// TestSpatialDatabaseWithOptions tests the spatial databases returned by 'new_db', like TestSpatialDatabase,
+// skipping the checks defined by 'opts'.
+func TestSpatialDatabaseWithOptions(ctx context.Context, new_db NewSpatialDatabaseFunc, opts *Options) error {
+
+	t := &tester{
+		errors: make([]string, 0),
+		opts:   opts,
+	}
+
+	db, err := new_db(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial database, %v", err)
+	}
+
+	err = t.indexFixtures(ctx, db)
+
+	if err != nil {
+		db.Disconnect(ctx)
+		return err
+	}
+
+	for _, test := range point_in_polygon_tests {
+		t.checkPointInPolygon(ctx, db, test)
+	}
+
+	for _, test := range candidates_tests {
+		t.checkCandidates(ctx, db, test)
+	}
+
+	for _, test := range read_tests {
+		t.checkRead(ctx, db, test)
+	}
+
+	err = db.Disconnect(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to disconnect spatial database, %v", err)
+	}
+
+	db, err = new_db(ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create spatial database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	t.checkReindex(ctx, db)
+
+	return t.err()
+}
+
+type tester struct {
+	errors []string
+	opts   *Options
+}
+
+// indexFixtures indexes the fixtures in 'db', except for any that are skipped by the tester's options.
+func (t *tester) indexFixtures(ctx context.Context, db database.SpatialDatabase) error {
+
+	features, err := Fixtures()
+
+	if err != nil {
+		return err
+	}
+
+	for _, f := range features {
+
+		if t.opts.SkipAntimeridian && f.Id() == antimeridian_fixture_id {
+			continue
+		}
+
+		err := db.IndexFeature(ctx, f)
+
+		if err != nil {
+			return fmt.Errorf("Failed to index %s, %v", f.Id(), err)
+		}
+	}
+
+	return nil
+}
+
+func (t *tester) errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *tester) err() error {
+
+	if len(t.errors) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("TestSpatialDatabase found %d errors:\n%s", len(t.errors), strings.Join(t.errors, "\n"))
+}
+
+func (t *tester) checkPointInPolygon(ctx context.Context, db database.SpatialDatabase, test *pointInPolygonTest) {
+
+	if test.crosses_antimeridian && t.opts.SkipAntimeridian {
+		return
+	}
+
+	label := fmt.Sprintf("point-in-polygon '%s' (%f, %f)", test.name, test.latitude, test.longitude)
+
+	if test.query != "" {
+		label = fmt.Sprintf("%s?%s", label, test.query)
+	}
+
+	c, err := geo.NewCoordinate(test.longitude, test.latitude)
+
+	if err != nil {
+		t.errorf("%s: failed to create coordinate, %v", label, err)
+		return
+	}
+
+	filters := make([]spatial.Filter, 0)
+
+	if test.query != "" {
+
+		q, err := url.ParseQuery(test.query)
+
+		if err != nil {
+			t.errorf("%s: failed to parse query, %v", label, err)
+			return
+		}
+
+		f, err := filter.NewSPRFilterFromQuery(q)
+
+		if err != nil {
+			t.errorf("%s: failed to create filter, %v", label, err)
+			return
+		}
+
+		filters = append(filters, f)
+	}
+
+	rsp, err := db.PointInPolygon(ctx, c, filters...)
+
+	if err != nil {
+		t.errorf("%s: query failed, %v", label, err)
+		return
+	}
+
+	ids := make([]string, 0)
+
+	for _, s := range rsp.Results() {
+		ids = append(ids, s.Id())
+	}
+
+	t.compareIds(label, test.expected, ids)
+
+	// The channel-based method should return the same results
+
+	rsp_ch := make(chan spr.StandardPlacesResult)
+	err_ch := make(chan error)
+	done_ch := make(chan bool)
+
+	go db.PointInPolygonWithChannels(ctx, rsp_ch, err_ch, done_ch, c, filters...)
+
+	ids = make([]string, 0)
+
+	for working := true; working; {
+		select {
+		case <-done_ch:
+			working = false
+		case s := <-rsp_ch:
+			ids = append(ids, s.Id())
+		case err := <-err_ch:
+			t.errorf("%s (with channels): query failed, %v", label, err)
+			return
+		}
+	}
+
+	t.compareIds(label+" (with channels)", test.expected, ids)
+}
+
+func (t *tester) checkCandidates(ctx context.Context, db database.SpatialDatabase, test *candidatesTest) {
+
+	if test.crosses_antimeridian && t.opts.SkipAntimeridian {
+		return
+	}
+
+	label := fmt.Sprintf("candidates '%s' (%f, %f)", test.name, test.latitude, test.longitude)
+
+	c, err := geo.NewCoordinate(test.longitude, test.latitude)
+
+	if err != nil {
+		t.errorf("%s: failed to create coordinate, %v", label, err)
+		return
+	}
+
+	candidates, err := db.PointInPolygonCandidates(ctx, c)
+
+	if err != nil {
+		t.errorf("%s: query failed, %v", label, err)
+		return
+	}
+
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, candidate := range candidates {
+
+		if candidate.Bounds == nil || !candidate.Bounds.ContainsCoord(*c) {
+			t.errorf("%s: bounds for candidate %s do not contain coordinate", label, candidate.Id)
+		}
+
+		// Features may have more than one candidate, for example multipolygons or
+		// polygons that cross the antimeridian, but they are only counted once
+
+		if seen[candidate.FeatureId] {
+			continue
+		}
+
+		seen[candidate.FeatureId] = true
+		ids = append(ids, candidate.FeatureId)
+	}
+
+	t.compareIds(label, test.expected, ids)
+
+	rsp_ch := make(chan *spatial.PointInPolygonCandidate)
+	err_ch := make(chan error)
+	done_ch := make(chan bool)
+
+	go db.PointInPolygonCandidatesWithChannels(ctx, rsp_ch, err_ch, done_ch, c)
+
+	count := 0
+
+	for working := true; working; {
+		select {
+		case <-done_ch:
+			working = false
+		case <-rsp_ch:
+			count += 1
+		case err := <-err_ch:
+			t.errorf("%s (with channels): query failed, %v", label, err)
+			return
+		}
+	}
+
+	if count != len(candidates) {
+		t.errorf("%s (with channels): expected %d candidates, got %d", label, len(candidates), count)
+	}
+}
+
+func (t *tester) checkRead(ctx context.Context, db database.SpatialDatabase, test *readTest) {
+
+	label := fmt.Sprintf("read '%s' (%s)", test.name, test.uri)
+
+	fh, err := db.Read(ctx, test.uri)
+
+	if test.expected == "" {
+
+		if err == nil {
+			fh.Close()
+			t.errorf("%s: expected an error, got none", label)
+		}
+
+		return
+	}
+
+	if err != nil {
+		t.errorf("%s: read failed, %v", label, err)
+		return
+	}
+
+	defer fh.Close()
+
+	body, err := ioutil.ReadAll(fh)
+
+	if err != nil {
+		t.errorf("%s: failed to read body, %v", label, err)
+		return
+	}
+
+	f, err := loadFixture(test.expected)
+
+	if err != nil {
+		t.errorf("%s: %v", label, err)
+		return
+	}
+
+	if !bytes.Equal(body, f.Bytes()) {
+		t.errorf("%s: body does not match %s", label, test.expected)
+	}
+}
+
+// checkReindex indexes the fixtures in 'db' twice and checks that point-in-polygon queries return the same
+// results as they do when they are indexed once. It then reindexes a newer version of the multipolygon fixture,
+// without its second polygon, and checks that the second polygon no longer matches. If 'db' implements the
+// RemoveFeatureDatabase interface it then checks that removed features are no longer returned.
+func (t *tester) checkReindex(ctx context.Context, db database.SpatialDatabase) {
+
+	for i := 0; i < 2; i++ {
+
+		err := t.indexFixtures(ctx, db)
+
+		if err != nil {
+			t.errorf("reindex: %v", err)
+			return
+		}
+	}
+
+	for _, test := range point_in_polygon_tests {
+
+		reindex_test := *test
+		reindex_test.name = fmt.Sprintf("%s (reindexed)", test.name)
+
+		t.checkPointInPolygon(ctx, db, &reindex_test)
+	}
+
+	// Querying the same fixtures can not tell whether a feature's previous geometry has been replaced,
+	// or whether it is still indexed alongside the new one, so reindex a feature whose geometry has changed
+
+	shrunk, err := loadFixture(shrunk_fixture_name)
+
+	if err != nil {
+		t.errorf("reindex: %v", err)
+		return
+	}
+
+	err = db.IndexFeature(ctx, shrunk)
+
+	if err != nil {
+		t.errorf("reindex: failed to index %s, %v", shrunk_fixture_name, err)
+		return
+	}
+
+	t.checkPointInPolygon(ctx, db, &pointInPolygonTest{
+		name:      "multipolygon (first, shrunk)",
+		longitude: 31.0,
+		latitude:  11.0,
+		expected:  []string{"1002"},
+	})
+
+	t.checkPointInPolygon(ctx, db, &pointInPolygonTest{
+		name:      "multipolygon (second, shrunk)",
+		longitude: 36.0,
+		latitude:  11.0,
+		expected:  []string{},
+	})
+
+	t.checkCandidates(ctx, db, &candidatesTest{
+		name:      "multipolygon (second, shrunk)",
+		longitude: 36.0,
+		latitude:  11.0,
+		expected:  []string{},
+	})
+
+	remover, ok := db.(RemoveFeatureDatabase)
+
+	if !ok {
+		return
+	}
+
+	err = remover.RemoveFeature(ctx, "1001", "")
+
+	if err != nil {
+		t.errorf("remove: failed to remove 1001, %v", err)
+		return
+	}
+
+	t.checkPointInPolygon(ctx, db, &pointInPolygonTest{
+		name:      "polygon (removed)",
+		longitude: 12.0,
+		latitude:  12.0,
+		expected:  []string{"1006"},
+	})
+
+	t.checkCandidates(ctx, db, &candidatesTest{
+		name:      "polygon (removed)",
+		longitude: 12.0,
+		latitude:  12.0,
+		expected:  []string{"1006"},
+	})
+
+	t.checkRead(ctx, db, &readTest{
+		name: "polygon (removed)",
+		uri:  "1001.geojson",
+	})
+}
+
+// compareIds records an error if 'ids' and 'expected' do not contain the same IDs, in any order.
+func (t *tester) compareIds(label string, expected []string, ids []string) {
+
+	sorted_expected := append([]string{}, expected...)
+	sorted_ids := append([]string{}, ids...)
+
+	sort.Strings(sorted_expected)
+	sort.Strings(sorted_ids)
+
+	if strings.Join(sorted_expected, ",") != strings.Join(sorted_ids, ",") {
+		t.errorf("%s: expected %v, got %v", label, sorted_expected, sorted_ids)
+	}
+}
+
+func loadFixture(name string) (geojson.Feature, error) {
+
+	body, err := fixtures.ReadFile(path.Join("fixtures", name))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read fixture %s, %v", name, err)
+	}
+
+	f, err := feature.LoadFeature(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load fixture %s, %v", name, err)
+	}
+
+	// "Plain old" GeoJSON features are indexed the same way the server indexes them
+	// when the -is-wof flag is false
+
+	_, is_geojson := f.(*feature.GeoJSONFeature)
+
+	if is_geojson {
+
+		f, err = mapping.NewMappedFeature(f, fixture_mapping)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to map fixture %s, %v", name, err)
+		}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,191 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// The default number of seconds to wait between checks of the database file when the "watch_dsn" parameter is true.
+const DEFAULT_WATCH_DSN_INTERVAL int = 10
+
+// DSN returns the data source name for the SQLite database that queries are currently performed against.
+func (r *SQLiteSpatialDatabase) DSN() string {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.dsn
+}
+
+// Swap replaces the SQLite database that queries are performed against with the database at 'dsn', or
+// the database's current DSN if empty, without interrupting the service. The new database is validated, using
+// a read-only connection so that nothing is written to a file that is rejected, before it is opened and, for
+// read-write databases, migrated to the current schema. Queries that are already running against the old
+// database are allowed to finish before the swap happens and new queries wait until it is complete, after
+// which the old database is closed.
+func (r *SQLiteSpatialDatabase) Swap(ctx context.Context, dsn string) error {
+
+	if dsn == "" {
+		dsn = r.DSN()
+	}
+
+	err := r.validateSwapDatabase(ctx, dsn)
+
+	if err != nil {
+		return fmt.Errorf("Failed to validate %s, %v", dsn, err)
+	}
+
+	new_db, info, err := r.openSwapDatabase(dsn)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open %s, %v", dsn, err)
+	}
+
+	if !r.read_only {
+
+		err := r.migrateDatabase(ctx, new_db)
+
+		if err != nil {
+			new_db.Close()
+			return fmt.Errorf("Failed to migrate %s, %v", dsn, err)
+		}
+	}
+
+	// Acquiring the write lock waits for any in-flight queries, all of which hold
+	// the read lock, to finish with the old database
+
+	r.mu.Lock()
+
+	old_db := r.db
+
+	r.db = new_db
+	r.dsn = dsn
+	r.dsn_info = info
+
+	// Cached SPR and polygon data belongs to the old database and row IDs are
+	// not stable between databases
+
+	r.gocache.Flush()
+
+	if r.polygon_cache != nil {
+		r.polygon_cache.Flush()
+	}
+
+	r.mu.Unlock()
+
+	err = old_db.Close()
+
+	if err != nil {
+		r.Logger.Warning("Failed to close previous database, %v", err)
+	}
+
+	r.Logger.Status("Swapped database to %s", dsn)
+	return nil
+}
+
+// validateSwapDatabase validates the existing database file at 'path' using a read-only connection.
+func (r *SQLiteSpatialDatabase) validateSwapDatabase(ctx context.Context, path string) error {
+
+	db, err := openReadOnlyDatabase(path, r.immutable)
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	return r.validateDatabase(ctx, db)
+}
+
+// openSwapDatabase opens the existing database file at 'path'. The vendored NewDB function opens files using
+// SQLite's shared cache, which is keyed by path, so a file that has been moved in to place over the database
+// that is currently open would still return the old data. Instead the file is opened with a private cache.
+func (r *SQLiteSpatialDatabase) openSwapDatabase(path string) (*sqlite_database.SQLiteDatabase, os.FileInfo, error) {
+
+	if path == ":memory:" || strings.HasPrefix(path, "file:") {
+		return nil, nil, errors.New("Databases can only be swapped in from a path to an existing file")
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var db *sqlite_database.SQLiteDatabase
+
+	if r.read_only {
+		db, err = openReadOnlyDatabase(path, r.immutable)
+	} else {
+		db, err = sqlite_database.NewDB(fileURI(path, url.Values{"mode": []string{"rw"}}))
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return db, info, nil
+}
+
+// watchDSN checks the database file at regular intervals and swaps it in whenever it has been replaced by
+// a new file, until 'ctx' is cancelled. Changes to the existing file are ignored so new databases should be
+// moved in to place rather than written over the current one.
+func (r *SQLiteSpatialDatabase) watchDSN(ctx context.Context, interval time.Duration) {
+
+	// The last file that failed to validate, so that it isn't retried until it has been replaced
+
+	var failed os.FileInfo
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+
+			// The database may have been swapped to a different file by an admin
+			// request in which case that is the file to watch from now on
+
+			r.mu.RLock()
+			path := r.dsn
+			current := r.dsn_info
+			r.mu.RUnlock()
+
+			info, err := os.Stat(path)
+
+			if err != nil {
+
+				// The file may be missing briefly while it is being replaced
+
+				if !os.IsNotExist(err) {
+					r.Logger.Warning("Failed to stat %s, %v", path, err)
+				}
+
+				continue
+			}
+
+			if current != nil && os.SameFile(current, info) {
+				continue
+			}
+
+			if failed != nil && os.SameFile(failed, info) {
+				continue
+			}
+
+			err = r.Swap(ctx, path)
+
+			if err != nil {
+				r.Logger.Error("Failed to swap database, %v", err)
+				failed = info
+			}
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/spatialtest"
+	"github.com/whosonfirst/go-whosonfirst-spatial/database"
+	"github.com/whosonfirst/go-whosonfirst-spatial/geo"
+	"github.com/whosonfirst/go-whosonfirst-spr/v2"
+	sqlite_database "github.com/whosonfirst/go-whosonfirst-sqlite/database"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSwap(t *testing.T) {
+
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "swap")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	// Two databases which return different results for the same coordinate
+
+	first := filepath.Join(root, "first.db")
+	second := filepath.Join(root, "second.db")
+
+	err = createSwapDatabase(ctx, first, "1006")
+
+	if err != nil {
+		t.Fatalf("Failed to create %s, %v", first, err)
+	}
+
+	err = createSwapDatabase(ctx, second, "1001")
+
+	if err != nil {
+		t.Fatalf("Failed to create %s, %v", second, err)
+	}
+
+	// A database that fails validation because it doesn't have an rtree or spr table
+
+	invalid := filepath.Join(root, "invalid.db")
+
+	invalid_db, err := sqlite_database.NewDB(invalid)
+
+	if err != nil {
+		t.Fatalf("Failed to create %s, %v", invalid, err)
+	}
+
+	conn, err := invalid_db.Conn()
+
+	if err != nil {
+		t.Fatalf("Failed to connect to %s, %v", invalid, err)
+	}
+
+	_, err = conn.Exec("CREATE TABLE other (id INTEGER)")
+
+	if err != nil {
+		t.Fatalf("Failed to create table in %s, %v", invalid, err)
+	}
+
+	invalid_db.Close()
+
+	for _, mode := range []string{"rw", "ro"} {
+
+		uri := fmt.Sprintf("sqlite://?dsn=%s&mode=%s&polygon_cache_size=1", url.QueryEscape(first), mode)
+
+		db, err := database.NewSpatialDatabase(ctx, uri)
+
+		if err != nil {
+			t.Fatalf("%s: failed to create database, %v", mode, err)
+		}
+
+		sqlite_db := db.(*SQLiteSpatialDatabase)
+
+		err = checkSwapResults(ctx, sqlite_db, "1006")
+
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+
+		if sqlite_db.gocache.ItemCount() == 0 {
+			t.Fatalf("%s: expected SPR cache to be populated", mode)
+		}
+
+		if sqlite_db.polygon_cache.Stats().Entries == 0 {
+			t.Fatalf("%s: expected polygon cache to be populated", mode)
+		}
+
+		err = sqlite_db.Swap(ctx, second)
+
+		if err != nil {
+			t.Fatalf("%s: failed to swap database, %v", mode, err)
+		}
+
+		if sqlite_db.DSN() != second {
+			t.Fatalf("%s: expected DSN to be %s but got %s", mode, second, sqlite_db.DSN())
+		}
+
+		if sqlite_db.gocache.ItemCount() != 0 {
+			t.Fatalf("%s: expected SPR cache to be flushed", mode)
+		}
+
+		if sqlite_db.polygon_cache.Stats().Entries != 0 {
+			t.Fatalf("%s: expected polygon cache to be flushed", mode)
+		}
+
+		err = checkSwapResults(ctx, sqlite_db, "1001")
+
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+
+		// Databases that fail to open or validate are rejected and the current database is kept
+
+		for _, dsn := range []string{invalid, filepath.Join(root, "missing.db"), ":memory:"} {
+
+			err = sqlite_db.Swap(ctx, dsn)
+
+			if err == nil {
+				t.Fatalf("%s: expected swapping to %s to fail", mode, dsn)
+			}
+
+			if sqlite_db.DSN() != second {
+				t.Fatalf("%s: expected DSN to still be %s after failing to swap to %s but got %s", mode, second, dsn, sqlite_db.DSN())
+			}
+
+			err = checkSwapResults(ctx, sqlite_db, "1001")
+
+			if err != nil {
+				t.Fatalf("%s: after failing to swap to %s, %v", mode, dsn, err)
+			}
+		}
+
+		// Rejected databases are validated without being written to
+
+		tables, err := swapDatabaseTables(invalid)
+
+		if err != nil {
+			t.Fatalf("%s: failed to list tables in %s, %v", mode, invalid, err)
+		}
+
+		if strings.Join(tables, ",") != "other" {
+			t.Fatalf("%s: expected %s to only contain the other table but got %v", mode, invalid, tables)
+		}
+
+		db.Disconnect(ctx)
+	}
+}
+
+func TestSwapMigrate(t *testing.T) {
+
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "swap")
+
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory, %v", err)
+	}
+
+	defer os.RemoveAll(root)
+
+	first := filepath.Join(root, "first.db")
+	second := filepath.Join(root, "second.db")
+
+	err = createSwapDatabase(ctx, first, "1006")
+
+	if err != nil {
+		t.Fatalf("Failed to create %s, %v", first, err)
+	}
+
+	err = createSwapDatabase(ctx, second, "1001")
+
+	if err != nil {
+		t.Fatalf("Failed to create %s, %v", second, err)
+	}
+
+	// Make the second database look like one created before the rows table was added
+
+	second_db, err := sqlite_database.NewDB(second)
+
+	if err != nil {
+		t.Fatalf("Failed to open %s, %v", second, err)
+	}
+
+	conn, err := second_db.Conn()
+
+	if err != nil {
+		t.Fatalf("Failed to connect to %s, %v", second, err)
+	}
+
+	_, err = conn.Exec("DROP TABLE feature_rows")
+
+	if err != nil {
+		t.Fatalf("Failed to drop feature_rows table from %s, %v", second, err)
+	}
+
+	second_db.Close()
+
+	db, err := database.NewSpatialDatabase(ctx, fmt.Sprintf("sqlite://?dsn=%s", url.QueryEscape(first)))
+
+	if err != nil {
+		t.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Disconnect(ctx)
+
+	err = db.(*SQLiteSpatialDatabase).Swap(ctx, second)
+
+	if err != nil {
+		t.Fatalf("Failed to swap database, %v", err)
+	}
+
+	err = checkSwapResults(ctx, db.(*SQLiteSpatialDatabase), "1001")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := swapDatabaseTables(second)
+
+	if err != nil {
+		t.Fatalf("Failed to list tables in %s, %v", second, err)
+	}
+
+	found := false
+
+	for _, name := range tables {
+
+		if name == "feature_rows" {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.Fatalf("Expected the feature_rows table to be created when swapping to %s", second)
+	}
+}
+
+// createSwapDatabase creates a database at 'path' containing the spatialtest fixtures whose IDs are 'ids'.
+func createSwapDatabase(ctx context.Context, path string, ids ...string) error {
+
+	uri := fmt.Sprintf("sqlite://?dsn=%s", url.QueryEscape(path))
+
+	db, err := spatialtest.NewFixturesDatabase(ctx, uri, ids...)
+
+	if err != nil {
+		return err
+	}
+
+	return db.Disconnect(ctx)
+}
+
+// checkSwapResults returns an error if a point-in-polygon query, and a radius query, for a coordinate inside both
+// 1001 and 1006 don't return 'expected'.
+func checkSwapResults(ctx context.Context, db *SQLiteSpatialDatabase, expected ...string) error {
+
+	coord, err := geo.NewCoordinate(12.0, 12.0)
+
+	if err != nil {
+		return err
+	}
+
+	rsp, err := db.PointInPolygon(ctx, coord)
+
+	if err != nil {
+		return fmt.Errorf("Point in polygon query failed, %v", err)
+	}
+
+	radius_rsp, err := db.PointInPolygonWithRadius(ctx, coord, 1000.0)
+
+	if err != nil {
+		return fmt.Errorf("Radius query failed, %v", err)
+	}
+
+	for _, results := range [][]string{resultIds(rsp.Results()), resultIds(radius_rsp.Results())} {
+
+		if strings.Join(results, ",") != strings.Join(expected, ",") {
+			return fmt.Errorf("Expected %v but got %v", expected, results)
+		}
+	}
+
+	return nil
+}
+
+// swapDatabaseTables returns the sorted names of the tables in the database file at 'path'.
+func swapDatabaseTables(path string) ([]string, error) {
+
+	db, err := openReadOnlyDatabase(path, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query("SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tables := make([]string, 0)
+
+	for rows.Next() {
+
+		var name string
+
+		err := rows.Scan(&name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tables = append(tables, name)
+	}
+
+	return tables, rows.Err()
+}
+
+func resultIds(results []spr.StandardPlacesResult) []string {
+
+	ids := make([]string, len(results))
+
+	for i, r := range results {
+		ids[i] = r.Id()
+	}
+
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,148 @@
+package tables
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-sqlite/utils"
+)
+
+// MetadataTable is a SQLite table for storing key-value metadata about a database, like the version of the
+// schema it was created with and the parameters used to index it.
+type MetadataTable struct {
+	name string
+}
+
+func NewMetadataTable() (*MetadataTable, error) {
+
+	t := MetadataTable{
+		name: "metadata",
+	}
+
+	return &t, nil
+}
+
+func NewMetadataTableWithDatabase(db sqlite.Database) (*MetadataTable, error) {
+
+	t, err := NewMetadataTable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.InitializeTable(db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *MetadataTable) Name() string {
+	return t.name
+}
+
+func (t *MetadataTable) Schema() string {
+
+	sql := `CREATE TABLE %s (
+		key TEXT PRIMARY KEY,
+		value TEXT
+	);`
+
+	return fmt.Sprintf(sql, t.Name())
+}
+
+func (t *MetadataTable) InitializeTable(db sqlite.Database) error {
+
+	return utils.CreateTableIfNecessary(db, t)
+}
+
+// IndexRecord stores each of the key-value pairs in 'i', which is expected to be a map[string]string instance,
+// replacing any existing values.
+func (t *MetadataTable) IndexRecord(db sqlite.Database, i interface{}) error {
+
+	metadata, ok := i.(map[string]string)
+
+	if !ok {
+		return errors.New("Invalid metadata, expected map[string]string")
+	}
+
+	ctx := context.Background()
+
+	for k, v := range metadata {
+
+		err := t.Set(ctx, db, k, v)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get returns all the key-value pairs stored in the table.
+func (t *MetadataTable) Get(ctx context.Context, db sqlite.Database) (map[string]string, error) {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf("SELECT key, value FROM %s", t.Name())
+
+	rows, err := conn.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+
+	for rows.Next() {
+
+		var k string
+		var v string
+
+		err := rows.Scan(&k, &v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		metadata[k] = v
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// Set stores 'value' for 'key', replacing any existing value.
+func (t *MetadataTable) Set(ctx context.Context, db sqlite.Database, key string, value string) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return err
+	}
+
+	q := fmt.Sprintf("INSERT OR REPLACE INTO %s (key, value) VALUES (?, ?)", t.Name())
+
+	_, err = conn.ExecContext(ctx, q, key, value)
+
+	if err != nil {
+		return fmt.Errorf("Failed to set metadata for %s, %v", key, err)
+	}
+
+	return nil
+}
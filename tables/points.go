@@ -0,0 +1,201 @@
+// Package tables provides go-whosonfirst-sqlite tables specific to SQLite-backed spatial databases
+// that are not (yet) part of the go-whosonfirst-sqlite-features package.
+package tables
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/geometry"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"github.com/whosonfirst/go-whosonfirst-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-sqlite-features"
+	"github.com/whosonfirst/go-whosonfirst-sqlite/utils"
+)
+
+type PointsTableOptions struct {
+	IndexAltFiles bool
+	// If not nil, the ID assigned to each row is recorded in this table so that the rows for a feature can be found without scanning the rtree.
+	FeatureRowsTable *FeatureRowsTable
+}
+
+func DefaultPointsTableOptions() (*PointsTableOptions, error) {
+
+	opts := PointsTableOptions{
+		IndexAltFiles: false,
+	}
+
+	return &opts, nil
+}
+
+// PointsTable is a SQLite rtree virtual table for indexing features with Point geometries. Each point
+// is stored as a zero-area bounding box.
+type PointsTable struct {
+	features.FeatureTable
+	name    string
+	options *PointsTableOptions
+}
+
+func NewPointsTable() (sqlite.Table, error) {
+
+	opts, err := DefaultPointsTableOptions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPointsTableWithOptions(opts)
+}
+
+func NewPointsTableWithOptions(opts *PointsTableOptions) (sqlite.Table, error) {
+
+	t := PointsTable{
+		name:    "points",
+		options: opts,
+	}
+
+	return &t, nil
+}
+
+func NewPointsTableWithDatabase(db sqlite.Database) (sqlite.Table, error) {
+
+	opts, err := DefaultPointsTableOptions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPointsTableWithDatabaseAndOptions(db, opts)
+}
+
+func NewPointsTableWithDatabaseAndOptions(db sqlite.Database, opts *PointsTableOptions) (sqlite.Table, error) {
+
+	t, err := NewPointsTableWithOptions(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.InitializeTable(db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *PointsTable) Name() string {
+	return t.name
+}
+
+func (t *PointsTable) Schema() string {
+
+	sql := `CREATE VIRTUAL TABLE %s USING rtree (
+		id,
+		min_x,
+		max_x,
+		min_y,
+		max_y,
+		+wof_id INTEGER,
+		+is_alt TINYINT,
+		+alt_label TEXT,
+		+lastmodified INTEGER
+	);`
+
+	return fmt.Sprintf(sql, t.Name())
+}
+
+func (t *PointsTable) InitializeTable(db sqlite.Database) error {
+
+	return utils.CreateTableIfNecessary(db, t)
+}
+
+func (t *PointsTable) IndexRecord(db sqlite.Database, i interface{}) error {
+	return t.IndexFeature(db, i.(geojson.Feature))
+}
+
+func (t *PointsTable) IndexFeature(db sqlite.Database, f geojson.Feature) error {
+
+	if geometry.Type(f) != "Point" {
+		return nil
+	}
+
+	is_alt := whosonfirst.IsAlt(f)
+
+	if is_alt && !t.options.IndexAltFiles {
+		return nil
+	}
+
+	alt_label := ""
+
+	if is_alt {
+
+		alt_label = whosonfirst.AltLabel(f)
+
+		if alt_label == "" {
+			return errors.New("Missing src:alt_label property")
+		}
+	}
+
+	coords := gjson.GetBytes(f.Bytes(), "geometry.coordinates").Array()
+
+	if len(coords) < 2 {
+		return errors.New("Invalid Point coordinates")
+	}
+
+	x := coords[0].Float()
+	y := coords[1].Float()
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return err
+	}
+
+	sql := fmt.Sprintf(`INSERT OR REPLACE INTO %s (
+		id, min_x, max_x, min_y, max_y, wof_id, is_alt, alt_label, lastmodified
+	) VALUES (
+		NULL, ?, ?, ?, ?, ?, ?, ?, ?
+	)`, t.Name())
+
+	tx, err := conn.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	rsp, err := tx.Exec(sql, x, x, y, y, f.Id(), is_alt, alt_label, whosonfirst.LastModified(f))
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if t.options.FeatureRowsTable != nil {
+
+		row_id, err := rsp.LastInsertId()
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		row := &FeatureRow{
+			Table:     t.Name(),
+			RowId:     row_id,
+			FeatureId: f.Id(),
+			AltLabel:  alt_label,
+		}
+
+		err = t.options.FeatureRowsTable.AddRow(tx, row)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
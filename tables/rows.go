@@ -0,0 +1,207 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-sqlite/utils"
+)
+
+// FeatureRow identifies a row, in an rtree table, that was created for a feature.
+type FeatureRow struct {
+	// The name of the rtree table the row is stored in.
+	Table string
+	// The ID SQLite assigned to the row.
+	RowId int64
+	// The ID of the feature the row was created for.
+	FeatureId string
+	// The alternate geometry label of the feature the row was created for.
+	AltLabel string
+}
+
+// FeatureRowsTable is a SQLite table that maps features to the IDs of the rows created for them in the rtree and
+// points tables. Those rows are assigned new IDs every time a feature is indexed and the auxiliary columns they
+// store feature IDs in can't be indexed, so without this table removing the rows for a feature means scanning
+// the entire rtree.
+type FeatureRowsTable struct {
+	name string
+}
+
+func NewFeatureRowsTable() (*FeatureRowsTable, error) {
+
+	t := FeatureRowsTable{
+		name: "feature_rows",
+	}
+
+	return &t, nil
+}
+
+func NewFeatureRowsTableWithDatabase(db sqlite.Database) (*FeatureRowsTable, error) {
+
+	t, err := NewFeatureRowsTable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.InitializeTable(db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *FeatureRowsTable) Name() string {
+	return t.name
+}
+
+func (t *FeatureRowsTable) Schema() string {
+
+	sql := `CREATE TABLE %s (
+		table_name TEXT NOT NULL,
+		row_id INTEGER NOT NULL,
+		wof_id INTEGER,
+		alt_label TEXT,
+		PRIMARY KEY (table_name, row_id)
+	);
+
+	CREATE INDEX %s_by_feature ON %s (wof_id, alt_label);`
+
+	return fmt.Sprintf(sql, t.Name(), t.Name(), t.Name())
+}
+
+func (t *FeatureRowsTable) InitializeTable(db sqlite.Database) error {
+
+	return utils.CreateTableIfNecessary(db, t)
+}
+
+// IndexRecord stores 'i', which is expected to be a *FeatureRow instance, replacing any existing record
+// for the same row.
+func (t *FeatureRowsTable) IndexRecord(db sqlite.Database, i interface{}) error {
+
+	row, ok := i.(*FeatureRow)
+
+	if !ok {
+		return errors.New("Invalid record, expected *FeatureRow")
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	err = t.AddRow(tx, row)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddRow stores 'row' as part of the transaction 'tx', so that it is only recorded if the row it describes is.
+func (t *FeatureRowsTable) AddRow(tx *sql.Tx, row *FeatureRow) error {
+
+	q := fmt.Sprintf("INSERT OR REPLACE INTO %s (table_name, row_id, wof_id, alt_label) VALUES (?, ?, ?, ?)", t.Name())
+
+	_, err := tx.Exec(q, row.Table, row.RowId, row.FeatureId, row.AltLabel)
+	return err
+}
+
+// Rows returns the rows recorded for the feature whose ID is 'id' and whose alternate geometry label is 'alt_label'.
+func (t *FeatureRowsTable) Rows(ctx context.Context, db sqlite.Database, id string, alt_label string) ([]*FeatureRow, error) {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf("SELECT table_name, row_id FROM %s WHERE wof_id = ? AND alt_label = ?", t.Name())
+
+	rows, err := conn.QueryContext(ctx, q, id, alt_label)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	feature_rows := make([]*FeatureRow, 0)
+
+	for rows.Next() {
+
+		row := &FeatureRow{
+			FeatureId: id,
+			AltLabel:  alt_label,
+		}
+
+		err := rows.Scan(&row.Table, &row.RowId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		feature_rows = append(feature_rows, row)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return feature_rows, nil
+}
+
+// RemoveRows removes the records for the feature whose ID is 'id' and whose alternate geometry label is 'alt_label'.
+// It does not remove the rows they describe.
+func (t *FeatureRowsTable) RemoveRows(ctx context.Context, db sqlite.Database, id string, alt_label string) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return err
+	}
+
+	q := fmt.Sprintf("DELETE FROM %s WHERE wof_id = ? AND alt_label = ?", t.Name())
+
+	_, err = conn.ExecContext(ctx, q, id, alt_label)
+	return err
+}
+
+// Populate records every row in the rtree tables 'tables', which must have "id", "wof_id" and "alt_label"
+// columns. It is used to build the table for databases that were indexed before it existed.
+func (t *FeatureRowsTable) Populate(ctx context.Context, db sqlite.Database, tables ...sqlite.Table) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return err
+	}
+
+	for _, rtree_t := range tables {
+
+		q := fmt.Sprintf("INSERT OR REPLACE INTO %s (table_name, row_id, wof_id, alt_label) SELECT ?, id, wof_id, alt_label FROM %s", t.Name(), rtree_t.Name())
+
+		_, err := conn.ExecContext(ctx, q, rtree_t.Name())
+
+		if err != nil {
+			return fmt.Errorf("Failed to populate %s table from %s table, %v", t.Name(), rtree_t.Name(), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package tables
+
+// https://www.sqlite.org/rtree.html
+
+import (
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/geometry"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"github.com/whosonfirst/go-whosonfirst-spatial-http-sqlite/geo"
+	"github.com/whosonfirst/go-whosonfirst-sqlite"
+	"github.com/whosonfirst/go-whosonfirst-sqlite-features"
+	"github.com/whosonfirst/go-whosonfirst-sqlite/utils"
+)
+
+type RTreeTableOptions struct {
+	IndexAltFiles bool
+	// The encoding used to store geometries. Valid options are geo.GEOMETRY_FORMAT_JSON and geo.GEOMETRY_FORMAT_BINARY.
+	GeometryFormat string
+	// If not nil, the ID assigned to each row is recorded in this table so that the rows for a feature can be found without scanning the rtree.
+	FeatureRowsTable *FeatureRowsTable
+}
+
+func DefaultRTreeTableOptions() (*RTreeTableOptions, error) {
+
+	opts := RTreeTableOptions{
+		IndexAltFiles:  false,
+		GeometryFormat: geo.GEOMETRY_FORMAT_JSON,
+	}
+
+	return &opts, nil
+}
+
+// RTreeTable is a drop-in replacement for the RTreeTable in the go-whosonfirst-sqlite-features package, with
+// the same name and schema, that indexes polygons crossing the antimeridian as two rows, one for each side.
+// Each row's geometry is a copy of the entire polygon, shifted so that it is continuous across the antimeridian
+// (see geo.SplitAntimeridian), so it extends beyond -180 or 180. The row's bounding box is clamped to -180 and
+// 180, so it only matches the coordinates on its side of the antimeridian, which the shifted geometry contains
+// without any special-casing. Geometries may be stored as JSON or using a more compact
+// binary encoding; see the geo.EncodePolygon method for details.
+type RTreeTable struct {
+	features.FeatureTable
+	name    string
+	options *RTreeTableOptions
+}
+
+func NewRTreeTable() (sqlite.Table, error) {
+
+	opts, err := DefaultRTreeTableOptions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRTreeTableWithOptions(opts)
+}
+
+func NewRTreeTableWithOptions(opts *RTreeTableOptions) (sqlite.Table, error) {
+
+	if !geo.IsValidGeometryFormat(opts.GeometryFormat) {
+		return nil, fmt.Errorf("Invalid geometry format '%s'", opts.GeometryFormat)
+	}
+
+	t := RTreeTable{
+		name:    "rtree",
+		options: opts,
+	}
+
+	return &t, nil
+}
+
+func NewRTreeTableWithDatabase(db sqlite.Database) (sqlite.Table, error) {
+
+	opts, err := DefaultRTreeTableOptions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRTreeTableWithDatabaseAndOptions(db, opts)
+}
+
+func NewRTreeTableWithDatabaseAndOptions(db sqlite.Database, opts *RTreeTableOptions) (sqlite.Table, error) {
+
+	t, err := NewRTreeTableWithOptions(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.InitializeTable(db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *RTreeTable) Name() string {
+	return t.name
+}
+
+func (t *RTreeTable) Schema() string {
+
+	sql := `CREATE VIRTUAL TABLE %s USING rtree (
+		id,
+		min_x,
+		max_x,
+		min_y,
+		max_y,
+		+wof_id INTEGER,
+		+is_alt TINYINT,
+		+alt_label TEXT,
+		+geometry BLOB,
+		+lastmodified INTEGER
+	);`
+
+	return fmt.Sprintf(sql, t.Name())
+}
+
+func (t *RTreeTable) InitializeTable(db sqlite.Database) error {
+
+	return utils.CreateTableIfNecessary(db, t)
+}
+
+func (t *RTreeTable) IndexRecord(db sqlite.Database, i interface{}) error {
+	return t.IndexFeature(db, i.(geojson.Feature))
+}
+
+func (t *RTreeTable) IndexFeature(db sqlite.Database, f geojson.Feature) error {
+
+	switch geometry.Type(f) {
+	case "Polygon", "MultiPolygon":
+		// pass
+	default:
+		return nil
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return err
+	}
+
+	wof_id := f.Id()
+	is_alt := whosonfirst.IsAlt(f)
+
+	if is_alt && !t.options.IndexAltFiles {
+		return nil
+	}
+
+	alt_label := ""
+
+	if is_alt {
+
+		alt_label = whosonfirst.AltLabel(f)
+
+		if alt_label == "" {
+			return errors.New("Missing src:alt_label property")
+		}
+	}
+
+	lastmod := whosonfirst.LastModified(f)
+
+	polygons, err := f.Polygons()
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	sql := fmt.Sprintf(`INSERT OR REPLACE INTO %s (
+		id, min_x, max_x, min_y, max_y, wof_id, is_alt, alt_label, geometry, lastmodified
+	) VALUES (
+		NULL, ?, ?, ?, ?, ?, ?, ?, ?, ?
+	)`, t.Name())
+
+	stmt, err := tx.Prepare(sql)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, poly := range polygons {
+
+		points := make([][][]float64, 0)
+
+		exterior_ring := poly.ExteriorRing()
+		exterior_points := make([][]float64, 0)
+
+		for _, c := range exterior_ring.Vertices() {
+			exterior_points = append(exterior_points, []float64{c.X, c.Y})
+		}
+
+		points = append(points, exterior_points)
+
+		for _, interior_ring := range poly.InteriorRings() {
+
+			interior_points := make([][]float64, 0)
+
+			for _, c := range interior_ring.Vertices() {
+				interior_points = append(interior_points, []float64{c.X, c.Y})
+			}
+
+			points = append(points, interior_points)
+		}
+
+		for _, part := range geo.SplitAntimeridian(points) {
+
+			bbox := geo.PolygonBounds(part)
+
+			min_x := bbox.Min.X
+			max_x := bbox.Max.X
+
+			// The geometries for the parts of a polygon that crosses the antimeridian
+			// extend beyond -180 or 180 but their bounding boxes shouldn't
+
+			if min_x < -180.0 {
+				min_x = -180.0
+			}
+
+			if max_x > 180.0 {
+				max_x = 180.0
+			}
+
+			enc, err := geo.EncodePolygon(part, t.options.GeometryFormat)
+
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			// JSON-encoded geometries are stored as text, as they are by the
+			// go-whosonfirst-sqlite-features package, and everything else as a blob
+
+			var geom interface{}
+
+			switch t.options.GeometryFormat {
+			case geo.GEOMETRY_FORMAT_JSON:
+				geom = string(enc)
+			default:
+				geom = enc
+			}
+
+			rsp, err := stmt.Exec(min_x, max_x, bbox.Min.Y, bbox.Max.Y, wof_id, is_alt, alt_label, geom, lastmod)
+
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			if t.options.FeatureRowsTable != nil {
+
+				row_id, err := rsp.LastInsertId()
+
+				if err != nil {
+					tx.Rollback()
+					return err
+				}
+
+				row := &FeatureRow{
+					Table:     t.Name(),
+					RowId:     row_id,
+					FeatureId: wof_id,
+					AltLabel:  alt_label,
+				}
+
+				err = t.options.FeatureRowsTable.AddRow(tx, row)
+
+				if err != nil {
+					tx.Rollback()
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,240 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/whosonfirst/go-whosonfirst-sqlite"
+	"sort"
+	"strings"
+)
+
+// SchemaReport describes the differences between a table in a database and the schema defined by a sqlite.Table instance.
+type SchemaReport struct {
+	// The name of the table.
+	Name string `json:"name"`
+	// Whether or not the table exists in the database.
+	Exists bool `json:"exists"`
+	// The columns defined by the schema that are not present in the database.
+	MissingColumns []string `json:"missing_columns,omitempty"`
+	// The indexes defined by the schema that are not present in the database.
+	MissingIndexes []string `json:"missing_indexes,omitempty"`
+}
+
+// IsOutdated returns true if the table exists but is missing any of the columns or indexes defined by its schema.
+func (r *SchemaReport) IsOutdated() bool {
+	return r.Exists && (len(r.MissingColumns) > 0 || len(r.MissingIndexes) > 0)
+}
+
+// CompareSchema compares the columns and indexes for the table 't' in 'db' with the ones defined by its schema.
+// The schema is inspected by creating it in a temporary in-memory database rather than by parsing the SQL.
+func CompareSchema(ctx context.Context, db sqlite.Database, t sqlite.Table) (*SchemaReport, error) {
+
+	report := &SchemaReport{
+		Name:           t.Name(),
+		MissingColumns: make([]string, 0),
+		MissingIndexes: make([]string, 0),
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := tableExists(ctx, conn, t.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return report, nil
+	}
+
+	report.Exists = true
+
+	// Every connection to a ":memory:" database is a new database so make sure there is only one
+
+	schema_conn, err := sql.Open("sqlite3", ":memory:")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create schema database, %v", err)
+	}
+
+	defer schema_conn.Close()
+
+	schema_conn.SetMaxOpenConns(1)
+
+	_, err = schema_conn.ExecContext(ctx, t.Schema())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create schema for %s table, %v", t.Name(), err)
+	}
+
+	expected_columns, err := tableColumns(ctx, schema_conn, t.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := tableColumns(ctx, conn, t.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	report.MissingColumns = missing(expected_columns, columns)
+
+	expected_indexes, err := tableIndexes(ctx, schema_conn, t.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := tableIndexes(ctx, conn, t.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	report.MissingIndexes = missing(expected_indexes, indexes)
+
+	return report, nil
+}
+
+func tableExists(ctx context.Context, conn *sql.DB, name string) (bool, error) {
+
+	q := "SELECT COUNT(name) FROM sqlite_master WHERE type = 'table' AND name = ?"
+
+	row := conn.QueryRowContext(ctx, q, name)
+
+	var count int
+
+	err := row.Scan(&count)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to determine whether %s table exists, %v", name, err)
+	}
+
+	return count > 0, nil
+}
+
+func tableColumns(ctx context.Context, conn *sql.DB, name string) ([]string, error) {
+
+	// PRAGMA table_info returns: cid, name, type, notnull, dflt_value, pk
+
+	q := fmt.Sprintf("PRAGMA table_info(%s)", quoteIdentifier(name))
+
+	rows, err := conn.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve columns for %s table, %v", name, err)
+	}
+
+	defer rows.Close()
+
+	columns := make([]string, 0)
+
+	for rows.Next() {
+
+		var cid int
+		var column string
+		var column_type string
+		var not_null int
+		var default_value interface{}
+		var pk int
+
+		err := rows.Scan(&cid, &column, &column_type, &not_null, &default_value, &pk)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan columns for %s table, %v", name, err)
+		}
+
+		columns = append(columns, column)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return columns, nil
+}
+
+func tableIndexes(ctx context.Context, conn *sql.DB, name string) ([]string, error) {
+
+	// PRAGMA index_list returns: seq, name, unique, origin, partial
+
+	q := fmt.Sprintf("PRAGMA index_list(%s)", quoteIdentifier(name))
+
+	rows, err := conn.QueryContext(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve indexes for %s table, %v", name, err)
+	}
+
+	defer rows.Close()
+
+	indexes := make([]string, 0)
+
+	for rows.Next() {
+
+		var seq int
+		var index string
+		var unique int
+		var origin string
+		var partial int
+
+		err := rows.Scan(&seq, &index, &unique, &origin, &partial)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan indexes for %s table, %v", name, err)
+		}
+
+		// Indexes that SQLite creates for UNIQUE and PRIMARY KEY constraints are
+		// named after the table so they are covered by the column checks
+
+		if origin != "c" {
+			continue
+		}
+
+		indexes = append(indexes, index)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return indexes, nil
+}
+
+func quoteIdentifier(name string) string {
+	return fmt.Sprintf(`"%s"`, strings.Replace(name, `"`, `""`, -1))
+}
+
+// missing returns the (sorted) values in 'expected' that are not in 'actual'.
+func missing(expected []string, actual []string) []string {
+
+	found := make(map[string]bool)
+
+	for _, v := range actual {
+		found[v] = true
+	}
+
+	missing := make([]string, 0)
+
+	for _, v := range expected {
+
+		if !found[v] {
+			missing = append(missing, v)
+		}
+	}
+
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,67 @@
+// Package timeout provides methods for enforcing the optional query timeout of spatial databases and for
+// signalling the goroutines that perform a query without blocking once it has been cancelled.
+package timeout
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// QueryTimeout returns the value of the 'query_timeout' parameter, a Go duration string, in 'q' or 0 if it is
+// not present. A timeout of 0 means that queries are not timed out.
+func QueryTimeout(q url.Values) (time.Duration, error) {
+
+	str_timeout := q.Get("query_timeout")
+
+	if str_timeout == "" {
+		return 0, nil
+	}
+
+	v, err := time.ParseDuration(str_timeout)
+
+	if err != nil {
+		return 0, fmt.Errorf("Invalid 'query_timeout' parameter, %v", err)
+	}
+
+	if v < 0 {
+		return 0, fmt.Errorf("Invalid 'query_timeout' parameter, must be greater than or equal to zero")
+	}
+
+	return v, nil
+}
+
+// WithQueryTimeout returns a copy of 'ctx' which is cancelled after 'd' has elapsed, if it is greater than 0,
+// along with its cancel function.
+func WithQueryTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, d)
+}
+
+// SendError sends 'err' to 'err_ch' unless 'ctx' is cancelled first, which happens when the caller
+// has stopped listening because of an earlier error.
+func SendError(ctx context.Context, err_ch chan error, err error) {
+
+	select {
+	case <-ctx.Done():
+		// pass
+	case err_ch <- err:
+		// pass
+	}
+}
+
+// SendDone signals 'done_ch' unless 'ctx' is cancelled first.
+func SendDone(ctx context.Context, done_ch chan bool) {
+
+	select {
+	case <-ctx.Done():
+		// pass
+	case done_ch <- true:
+		// pass
+	}
+}
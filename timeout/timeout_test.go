@@ -0,0 +1,91 @@
+package timeout
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestQueryTimeout(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		query    string
+		expected time.Duration
+		invalid  bool
+	}{
+		{name: "none", query: "", expected: 0},
+		{name: "zero", query: "query_timeout=0s", expected: 0},
+		{name: "duration", query: "query_timeout=1500ms", expected: 1500 * time.Millisecond},
+		{name: "negative", query: "query_timeout=-1s", invalid: true},
+		{name: "invalid", query: "query_timeout=soon", invalid: true},
+	}
+
+	for _, test := range tests {
+
+		q, err := url.ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("%s: failed to parse query, %v", test.name, err)
+		}
+
+		d, err := QueryTimeout(q)
+
+		if test.invalid {
+
+			if err == nil {
+				t.Fatalf("%s: expected query timeout to be invalid", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: failed to parse query timeout, %v", test.name, err)
+		}
+
+		if d != test.expected {
+			t.Fatalf("%s: expected %v but got %v", test.name, test.expected, d)
+		}
+	}
+}
+
+func TestWithQueryTimeout(t *testing.T) {
+
+	ctx := context.Background()
+
+	no_timeout_ctx, cancel := WithQueryTimeout(ctx, 0)
+	defer cancel()
+
+	_, ok := no_timeout_ctx.Deadline()
+
+	if ok {
+		t.Fatalf("Expected context without a query timeout not to have a deadline")
+	}
+
+	timeout_ctx, cancel := WithQueryTimeout(ctx, time.Millisecond)
+	defer cancel()
+
+	select {
+	case <-timeout_ctx.Done():
+		// pass
+	case <-time.After(time.Second):
+		t.Fatalf("Expected context to be cancelled once the query timeout elapsed")
+	}
+
+	if timeout_ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("Expected context to have exceeded its deadline, got %v", timeout_ctx.Err())
+	}
+}
+
+func TestSendCancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nothing is listening on these channels so sending would block if the context wasn't checked
+
+	SendError(ctx, make(chan error), context.Canceled)
+	SendDone(ctx, make(chan bool))
+}